@@ -0,0 +1,68 @@
+// Package blob stores the files uploaded by users, such as gift images.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned when getting a blob that does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores blobs under slash separated keys.
+type Store interface {
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	// Get returns the content of the blob with key, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete deletes the blob with key. Deleting a missing blob is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns an S3 compatible store configured from the S3_* environment
+// variables when BLOB_STORE is "s3", or a store in the BLOB_DIR directory
+// otherwise.
+func New() Store {
+	if os.Getenv("BLOB_STORE") == "s3" {
+		log.Println("blob store: s3")
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	}
+
+	dir := os.Getenv("BLOB_DIR")
+	if dir == "" {
+		dir = "blobs"
+	}
+	log.Println("blob store: local")
+	return NewLocal(dir)
+}
+
+// validateKey makes sure key cannot escape the store: it must be made of
+// slash separated segments of letters, digits, dashes, underscores and dots,
+// none of them being "." or "..".
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+				return fmt.Errorf("invalid blob key %q", key)
+			}
+		}
+	}
+	return nil
+}
@@ -4,13 +4,45 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/epot/gifterv2/internal/middleware"
 	"github.com/epot/gifterv2/internal/store"
 	"github.com/markbates/goth/gothic"
 )
 
-func GoogleCallbackHandler(db store.Store) http.HandlerFunc {
+// providerEmailVerified tells whether the provider vouches for the email of
+// the user, with the email_verified claim of OpenID Connect or its Google
+// userinfo equivalent. Providers without such a claim never vouch.
+func providerEmailVerified(rawData map[string]any) bool {
+	for _, claim := range []string{"email_verified", "verified_email"} {
+		switch verified := rawData[claim].(type) {
+		case bool:
+			if verified {
+				return true
+			}
+		case string:
+			if verified == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func OAuthCallbackHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		providerName, err := gothic.GetProviderName(r)
+		if err != nil {
+			http.Error(w, "Unknown provider", http.StatusBadRequest)
+			return
+		}
+
+		// Completing the authentication clears the session, so remember
+		// beforehand if a logged in user asked to link this provider
+		currentUserID, _ := gothic.GetFromSession("user_id", r)
+		linkProvider := popLinkProvider(w, r)
+
 		// Finalize the authentication process
 		user, err := gothic.CompleteUserAuth(w, r)
 		if err != nil {
@@ -19,21 +51,41 @@ func GoogleCallbackHandler(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		// Save user to the database
 		ctx := r.Context()
-		userID, err := db.FindOrCreateUser(ctx, &store.User{
-			Name:    user.Name,
-			Email:   user.Email,
-			Picture: user.AvatarURL,
-		})
-		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			log.Println(err)
-			return
+
+		var userID string
+		if currentUserID != "" && linkProvider == providerName {
+			err = db.LinkIdentity(ctx, currentUserID, providerName, user.UserID, user.Email)
+			if err != nil {
+				if store.IsIdentityAlreadyLinkedError(err) {
+					http.Error(w, "This account is already linked to another user", http.StatusConflict)
+					return
+				}
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			userID = currentUserID
+		} else {
+			// Save user to the database
+			userID, err = db.FindOrCreateUserByIdentity(ctx, providerName, user.UserID, &store.User{
+				Name:    user.Name,
+				Email:   user.Email,
+				Picture: user.AvatarURL,
+			}, providerEmailVerified(user.RawData))
+			if err != nil {
+				if store.IsEmailAlreadyUsedError(err) {
+					http.Error(w, "Email already used, log in with your existing account and link this provider from your profile", http.StatusConflict)
+					return
+				}
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
 		}
 
 		// Save user ID in the session
-		err = gothic.StoreInSession("user_id", userID, r, w)
+		err = startSession(r.Context(), w, r, db, userID, time.Now())
 		if err != nil {
 			http.Error(w, "Failed to save session", http.StatusInternalServerError)
 			log.Println(err)
@@ -57,6 +109,9 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to logout", http.StatusInternalServerError)
 		return
 	}
+	if err := middleware.ClearLogin(w, r); err != nil {
+		log.Println(err)
+	}
 
 	// Redirect to login page
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -8,8 +8,14 @@ import (
 	"net/http"
 )
 
+// Comment is a comment on a gift, with its votes and reactions.
+type Comment struct {
+	store.Comment
+	store.ReactionSummary
+}
+
 type Comments struct {
-	Comments []store.Comment `json:"comments"`
+	Comments []Comment `json:"comments"`
 }
 
 func ListComments(db store.Store) http.HandlerFunc {
@@ -22,18 +28,56 @@ func ListComments(db store.Store) http.HandlerFunc {
 		}
 
 		var (
-			giftID = r.PathValue("gift_id")
-			ctx    = r.Context()
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
 		)
 
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		gift := getGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		// like its name, what others say about a secret gift is part of the
+		// surprise
+		if gift.Content.Secret && gift.Content.ToID == userID {
+			_ = json.NewEncoder(w).Encode(Comments{Comments: []Comment{}})
+			return
+		}
+
 		comments, err := db.ListComments(ctx, giftID)
 		if err != nil {
 			http.Error(w, "Error fetching comments", http.StatusInternalServerError)
 			return
 		}
 
+		commentIDs := make([]string, 0, len(comments))
+		for _, comment := range comments {
+			commentIDs = append(commentIDs, comment.ID)
+		}
+		summaries, err := db.GetReactionSummaries(ctx, store.CommentReactionTarget, commentIDs, userID)
+		if err != nil {
+			http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		result := Comments{Comments: make([]Comment, 0, len(comments))}
+		for _, comment := range comments {
+			result.Comments = append(result.Comments, Comment{Comment: comment, ReactionSummary: summaries[comment.ID]})
+		}
+
 		// Respond with user data
-		_ = json.NewEncoder(w).Encode(Comments{Comments: comments})
+		_ = json.NewEncoder(w).Encode(result)
 	}
 }
 
@@ -82,14 +126,7 @@ func CreateComment(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		hasGift, err := db.HasGift(ctx, giftID, eventID)
-		if err != nil {
-			http.Error(w, "Error checking gift access", http.StatusInternalServerError)
-			return
-		}
-
-		if !hasGift {
-			http.Error(w, "Gift not found", http.StatusBadRequest)
+		if getGift(w, r, db, userID, eventID, giftID) == nil {
 			return
 		}
 
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth/gothic"
+)
+
+// commentTestStore holds a single event with a single gift, and the comments
+// on it. Any other call panics.
+type commentTestStore struct {
+	store.Store
+	gift     store.Gift
+	comments []store.Comment
+}
+
+func (s commentTestStore) ListEvents(context.Context, string, store.EventFilter, time.Time) ([]store.Event, error) {
+	return []store.Event{{ID: s.gift.EventID}}, nil
+}
+
+func (s commentTestStore) GetGift(_ context.Context, eventID string, giftID string) (*store.Gift, error) {
+	if eventID != s.gift.EventID || giftID != s.gift.ID {
+		return nil, nil
+	}
+	return &s.gift, nil
+}
+
+func (s commentTestStore) ListComments(context.Context, string) ([]store.Comment, error) {
+	return s.comments, nil
+}
+
+func (s commentTestStore) ToggleVote(context.Context, store.ReactionTarget, string, string, int, time.Time) (int, error) {
+	return 1, nil
+}
+
+func (s commentTestStore) GetReactionSummary(context.Context, store.ReactionTarget, string, string) (store.ReactionSummary, error) {
+	return store.ReactionSummary{Upvotes: 1, Vote: 1, Reactions: []store.ReactionCount{}}, nil
+}
+
+func (s commentTestStore) GetReactionSummaries(_ context.Context, _ store.ReactionTarget, targetIDs []string, _ string) (map[string]store.ReactionSummary, error) {
+	summaries := make(map[string]store.ReactionSummary)
+	for _, targetID := range targetIDs {
+		summaries[targetID] = store.ReactionSummary{Reactions: []store.ReactionCount{}}
+	}
+	return summaries, nil
+}
+
+// newSessionRequest returns a request from userID, logged in.
+func newSessionRequest(t *testing.T, method string, target string, userID string) *http.Request {
+	t.Helper()
+
+	gothic.Store = sessions.NewCookieStore([]byte("test-session-secret"))
+	login := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, nil)
+	if err := gothic.StoreInSession("user_id", userID, request, login); err != nil {
+		t.Fatalf("StoreInSession() returned %v", err)
+	}
+	for _, cookie := range login.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+func TestListCommentsMasksSecretGifts(t *testing.T) {
+	db := commentTestStore{
+		gift: store.Gift{
+			ID:        "10",
+			EventID:   "1",
+			CreatorID: "2",
+			Content:   store.GiftContent{Name: "Surprise", ToID: "1", Secret: true},
+		},
+		comments: []store.Comment{{ID: "100", Message: "I got it!"}},
+	}
+
+	for userID, expected := range map[string]int{"1": 0, "2": 1} {
+		request := newSessionRequest(t, http.MethodGet, "/api/events/1/gifts/10/comments", userID)
+		request.SetPathValue("event_id", "1")
+		request.SetPathValue("gift_id", "10")
+		response := httptest.NewRecorder()
+		ListComments(db)(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("ListComments() answered %d to user %s", response.Code, userID)
+		}
+		var comments Comments
+		if err := json.NewDecoder(response.Body).Decode(&comments); err != nil {
+			t.Fatalf("failed to decode comments: %v", err)
+		}
+		if len(comments.Comments) != expected {
+			t.Fatalf("expected user %s to see %d comments, got %d", userID, expected, len(comments.Comments))
+		}
+	}
+}
+
+func TestToggleCommentReactionHidesSecretGifts(t *testing.T) {
+	db := commentTestStore{
+		gift: store.Gift{
+			ID:        "10",
+			EventID:   "1",
+			CreatorID: "2",
+			Content:   store.GiftContent{Name: "Surprise", ToID: "1", Secret: true},
+		},
+		comments: []store.Comment{{ID: "100", Message: "I got it!"}},
+	}
+
+	for userID, expected := range map[string]int{"1": http.StatusNotFound, "2": http.StatusOK} {
+		request := newSessionRequest(t, http.MethodPost, "/api/events/1/gifts/10/comments/100/reactions", userID)
+		request.Body = io.NopCloser(strings.NewReader(`{"vote": 1}`))
+		request.SetPathValue("event_id", "1")
+		request.SetPathValue("gift_id", "10")
+		request.SetPathValue("comment_id", "100")
+		response := httptest.NewRecorder()
+		ToggleCommentReaction(db, time.Now)(response, request)
+
+		if response.Code != expected {
+			t.Fatalf("expected ToggleCommentReaction() to answer %d to user %s, got %d", expected, userID, response.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+// RecipientCoverage counts the gifts of a recipient of an event. The counts
+// and the flag are nil for the user asking, who must not know about the
+// gifts they are getting.
+type RecipientCoverage struct {
+	UserID   string `json:"user_id"`
+	Name     string `json:"name"`
+	Proposed *int   `json:"proposed"`
+	Reserved *int   `json:"reserved"`
+	Bought   *int   `json:"bought"`
+	// Uncovered flags the recipients nobody reserved nor bought anything for.
+	Uncovered *bool `json:"uncovered"`
+}
+
+type CoverageReport struct {
+	Recipients []RecipientCoverage `json:"recipients"`
+}
+
+// GetCoverageReport tells, for each participant who can receive gifts in an
+// event, how many gifts are proposed, reserved and bought for them, so that
+// nobody is forgotten.
+func GetCoverageReport(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		coverage, err := db.ListRecipientCoverage(ctx, eventID)
+		if err != nil {
+			http.Error(w, "Error fetching coverage", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		report := CoverageReport{Recipients: []RecipientCoverage{}}
+		for _, recipient := range coverage {
+			if event.Type.HasHonorees() && !recipient.Honoree {
+				continue
+			}
+			result := RecipientCoverage{UserID: recipient.UserID, Name: recipient.Name}
+			if recipient.UserID != userID {
+				uncovered := recipient.Reserved+recipient.Bought == 0
+				result.Proposed = &recipient.Proposed
+				result.Reserved = &recipient.Reserved
+				result.Bought = &recipient.Bought
+				result.Uncovered = &uncovered
+			}
+			report.Recipients = append(report.Recipients, result)
+		}
+
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
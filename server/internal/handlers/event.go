@@ -1,19 +1,27 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/epot/gifterv2/internal/store"
 	"github.com/markbates/goth/gothic"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// RollOverAfter is how long after a recurring event the scheduler creates its
+// next occurrence, leaving time to mark the last gifts as bought.
+const RollOverAfter = 7 * 24 * time.Hour
+
 type Events struct {
 	Events []store.Event `json:"events"`
 }
 
-func GetEvents(db store.Store) http.HandlerFunc {
+// GetEvents lists the events of the user that are not archived, or the ones
+// selected by the filter parameter: upcoming, past or archived.
+func GetEvents(db store.Store, now func() time.Time) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve user ID from session
 		userID, err := gothic.GetFromSession("user_id", r)
@@ -22,8 +30,23 @@ func GetEvents(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		var filter store.EventFilter
+		switch r.URL.Query().Get("filter") {
+		case "":
+			filter = store.ActiveEventFilter
+		case "upcoming":
+			filter = store.UpcomingEventFilter
+		case "past":
+			filter = store.PastEventFilter
+		case "archived":
+			filter = store.ArchivedEventFilter
+		default:
+			http.Error(w, "Unknown filter", http.StatusBadRequest)
+			return
+		}
+
 		ctx := r.Context()
-		events, err := db.ListEvents(ctx, userID)
+		events, err := db.ListEvents(ctx, userID, filter, now())
 		if err != nil {
 			http.Error(w, "Error fetching events", http.StatusInternalServerError)
 			return
@@ -35,8 +58,19 @@ func GetEvents(db store.Store) http.HandlerFunc {
 }
 
 type createEventRequest struct {
-	Name string    `json:"name"`
-	Date time.Time `json:"date"`
+	Name          string               `json:"name"`
+	Date          time.Time            `json:"date"`
+	Description   string               `json:"description"`
+	Type          store.EventType      `json:"event_type"`
+	HonoreeEmails []string             `json:"honoree_emails"`
+	Recurrence    store.RecurrenceRule `json:"recurrence"`
+	// RecurrenceDate defaults to the event date, birthdays need the birth
+	// date of their honoree.
+	RecurrenceDate *time.Time `json:"recurrence_date"`
+	// GroupID optionally adds the members of a group to the event, kept in
+	// sync with it if SyncGroup is true.
+	GroupID   string `json:"group_id"`
+	SyncGroup bool   `json:"sync_group"`
 }
 
 func CreateEvent(db store.Store) http.HandlerFunc {
@@ -58,9 +92,59 @@ func CreateEvent(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		if !req.Type.Valid() {
+			http.Error(w, "Unknown event type", http.StatusBadRequest)
+			return
+		}
+		if !req.Type.HasHonorees() && len(req.HonoreeEmails) > 0 {
+			http.Error(w, "This event type has no honorees", http.StatusBadRequest)
+			return
+		}
+		if req.Type.SingleHonoree() && len(req.HonoreeEmails) > 1 {
+			http.Error(w, "This event type has a single honoree", http.StatusBadRequest)
+			return
+		}
+
+		if !req.Recurrence.Valid() {
+			http.Error(w, "Unknown recurrence", http.StatusBadRequest)
+			return
+		}
+		if req.Recurrence == store.BirthdayRecurrence && req.Type != store.BirthdayEventType {
+			http.Error(w, "Only birthdays can recur on birthdays", http.StatusBadRequest)
+			return
+		}
+		recurrenceDate := req.Date
+		if req.RecurrenceDate != nil {
+			recurrenceDate = *req.RecurrenceDate
+		} else if req.Recurrence == store.BirthdayRecurrence {
+			http.Error(w, "Recurrence date is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.GroupID != "" && getGroupRole(w, r, db, userID, req.GroupID, false) == nil {
+			return
+		}
+
 		ctx := r.Context()
-		err = db.CreateEvent(ctx, userID, req.Name, req.Date)
+		err = db.WithTx(ctx, func(tx store.Store) error {
+			eventID, err := tx.CreateEvent(ctx, userID, req.Name, req.Date, req.Description, req.Type, req.HonoreeEmails, req.Recurrence, recurrenceDate)
+			if err != nil {
+				return err
+			}
+			if req.GroupID == "" {
+				return nil
+			}
+			return tx.AddGroupToEvent(ctx, eventID, req.GroupID, req.SyncGroup)
+		})
 		if err != nil {
+			if store.IsUnknownParticipantError(err) {
+				http.Error(w, "Honoree email does not exist", http.StatusBadRequest)
+				return
+			}
+			if store.IsUnverifiedParticipantError(err) {
+				http.Error(w, "This honoree has not verified their email yet", http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Error creating event", http.StatusInternalServerError)
 			return
 		}
@@ -134,6 +218,68 @@ func AddEventParticipant(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+		err = db.AddEventParticipant(ctx, eventID, req.ParticipantEmail)
+		if err != nil {
+			if store.IsUnknownParticipantError(err) {
+				http.Error(w, "Email does not exist", http.StatusBadRequest)
+				return
+			}
+			if store.IsUnverifiedParticipantError(err) {
+				http.Error(w, "This user has not verified their email yet", http.StatusBadRequest)
+				return
+			}
+			if store.IsAlreadyParticipantError(err) {
+				http.Error(w, "This user already participates in this event", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error adding new participant", http.StatusInternalServerError)
+			return
+		}
+
+		// Respond with user data
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// removeParticipant removes participantID from the event and writes the
+// response.
+func removeParticipant(w http.ResponseWriter, r *http.Request, db store.Store, eventID string, participantID string) {
+	removed, err := db.RemoveEventParticipant(r.Context(), eventID, participantID)
+	if err != nil {
+		if store.IsCreatorCannotLeaveError(err) {
+			http.Error(w, "The creator of the event cannot leave it, delete it instead", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error removing participant", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if !removed {
+		http.Error(w, "Participant not found", http.StatusNotFound)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(nil)
+}
+
+// LeaveEvent removes the user from an event.
+func LeaveEvent(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
 		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
 		if err != nil {
 			http.Error(w, "Error checking event access", http.StatusInternalServerError)
@@ -143,17 +289,247 @@ func AddEventParticipant(db store.Store) http.HandlerFunc {
 			http.Error(w, "Event not found", http.StatusBadRequest)
 			return
 		}
-		err = db.AddEventParticipant(ctx, eventID, req.ParticipantEmail)
+
+		removeParticipant(w, r, db, eventID, userID)
+	}
+}
+
+// RemoveEventParticipant removes a participant from an event. Only the
+// owners of the event can remove participants.
+func RemoveEventParticipant(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		eventID := r.PathValue("event_id")
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		removeParticipant(w, r, db, eventID, r.PathValue("user_id"))
+	}
+}
+
+type rollOverEventResponse struct {
+	EventID string `json:"event_id"`
+}
+
+// RollOverEvent creates the next occurrence of a recurring event ahead of the
+// scheduler. Only the owners of the event can roll it over.
+func RollOverEvent(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		newEventID, err := db.RollOverEvent(ctx, eventID, now())
 		if err != nil {
-			if store.IsUnknownParticipantError(err) {
-				http.Error(w, "Email does not exist", http.StatusBadRequest)
+			if store.IsNotRecurringEventError(err) {
+				http.Error(w, "This event does not recur", http.StatusBadRequest)
 				return
 			}
-			http.Error(w, "Error adding new participant", http.StatusInternalServerError)
+			if store.IsAlreadyRolledOverError(err) {
+				http.Error(w, "This event was already rolled over", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Error rolling over event", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(rollOverEventResponse{EventID: newEventID})
+	}
+}
+
+// getEventAsOwner returns the event if userID owns it, that is if they created
+// it or participate in it as an owner. Otherwise, it writes the error response
+// and returns nil.
+func getEventAsOwner(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string) *store.Event {
+	ctx := r.Context()
+
+	hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil || event == nil {
+		http.Error(w, "Error fetching event", http.StatusInternalServerError)
+		return nil
+	}
+	isOwner, err := isEventOwner(ctx, db, event, userID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !isOwner {
+		http.Error(w, "Only the owners of the event can do this", http.StatusForbidden)
+		return nil
+	}
+
+	return event
+}
+
+// isEventOwner tells whether userID created the event or participates in it
+// as an owner.
+func isEventOwner(ctx context.Context, db store.Store, event *store.Event, userID string) (bool, error) {
+	if event.CreatorID == userID {
+		return true, nil
+	}
+	role, isParticipant, err := db.GetParticipantRole(ctx, event.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	return isParticipant && role == store.OwnerParticipantRole, nil
+}
+
+type updateEventRequest struct {
+	Name        string          `json:"name"`
+	Date        time.Time       `json:"date"`
+	Description string          `json:"description"`
+	Type        store.EventType `json:"event_type"`
+}
+
+func UpdateEvent(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		var req updateEventRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if !req.Type.Valid() {
+			http.Error(w, "Unknown event type", http.StatusBadRequest)
+			return
+		}
+
+		event := getEventAsOwner(w, r, db, userID, eventID)
+		if event == nil {
+			return
+		}
+		if req.Type.SingleHonoree() && len(event.HonoreeIDs) > 1 {
+			http.Error(w, "This event type has a single honoree", http.StatusBadRequest)
+			return
+		}
+		if event.Recurrence == store.BirthdayRecurrence && req.Type != store.BirthdayEventType {
+			http.Error(w, "This event recurs on birthdays", http.StatusBadRequest)
+			return
+		}
+
+		err = db.UpdateEvent(ctx, eventID, req.Name, req.Date, req.Description, req.Type)
+		if err != nil {
+			http.Error(w, "Error updating event", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// ArchiveEvent hides an event from the default listing when archived is
+// true, and brings it back otherwise. Archived events stay readable.
+func ArchiveEvent(db store.Store, archived bool, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		var archivedAt *time.Time
+		if archived {
+			t := now()
+			archivedAt = &t
+		}
+		err = db.ArchiveEvent(ctx, eventID, archivedAt)
+		if err != nil {
+			http.Error(w, "Error archiving event", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// DeleteEvent deletes an event for good, along with everything in it.
+func DeleteEvent(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		err = db.DeleteEvent(ctx, eventID)
+		if err != nil {
+			http.Error(w, "Error deleting event", http.StatusInternalServerError)
+			log.Println(err)
 			return
 		}
 
-		// Respond with user data
 		_ = json.NewEncoder(w).Encode(nil)
 	}
 }
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/epot/gifterv2/internal/token"
+	"github.com/markbates/goth/gothic"
+)
+
+const (
+	exportPurpose = "export"
+	// ExportTTL is how long a background export can be downloaded.
+	ExportTTL = 24 * time.Hour
+	// ExportStaleAfter is how long a background export may stay pending
+	// before it is considered lost, e.g. after a restart.
+	ExportStaleAfter = time.Hour
+	// exportSyncLimit is the number of gifts and comments above which an
+	// export is generated in the background instead of during the request.
+	exportSyncLimit = 500
+	exportTimeout   = 10 * time.Minute
+)
+
+type exportProfile struct {
+	store.User
+	Identities []store.Identity `json:"identities"`
+}
+
+type exportGift struct {
+	Gift
+	EventName string    `json:"event_name"`
+	EventDate time.Time `json:"event_date"`
+}
+
+type exportComment struct {
+	ID        string    `json:"id"`
+	GiftID    string    `json:"gift_id"`
+	EventID   string    `json:"event_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Message   string    `json:"message"`
+}
+
+// toExportGift converts a gift or a wishlist reservation for the export of the
+// personal data of userID. Gifts and wishlist items addressed to the user are
+// masked like in the event until the event is over, at which point the surprise
+// is no longer at risk.
+func toExportGift(ctx context.Context, db store.Store, userID string, gift store.UserGift, now time.Time) (exportGift, error) {
+	masked := gift.Content.ToID == userID && !now.After(gift.EventDate)
+
+	var (
+		g   Gift
+		err error
+	)
+	if gift.WishlistItem {
+		g, err = wishlistItemToGift(ctx, db, gift.EventID, store.EventWishlistItem{
+			WishlistItem: store.WishlistItem{
+				ID:        gift.ID,
+				UserID:    gift.Content.ToID,
+				Name:      gift.Content.Name,
+				URLs:      gift.Content.URLs,
+				CreatedAt: gift.CreatedAt,
+			},
+			Status:  gift.Content.Status,
+			BuyerID: gift.Content.FromID,
+		})
+		if masked && !gift.EventType.HonoreesSeeReservations() {
+			g.Status = store.SecretGiftStatus
+		}
+	} else {
+		viewerID := ""
+		if masked {
+			viewerID = userID
+		}
+		g, err = StoreGiftToGift(ctx, db, viewerID, gift.EventType, gift.Gift)
+	}
+	if err != nil {
+		return exportGift{}, err
+	}
+	if masked {
+		g.FromName = ""
+	}
+
+	return exportGift{
+		Gift:      g,
+		EventName: gift.EventName,
+		EventDate: gift.EventDate,
+	}, nil
+}
+
+// buildExport returns a zip of the personal data of the user.
+func buildExport(ctx context.Context, db store.Store, userID string, now time.Time) ([]byte, error) {
+	user, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+
+	identities, err := db.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := db.ListEvents(ctx, userID, store.AllEventFilter, now)
+	if err != nil {
+		return nil, err
+	}
+
+	gifts, err := db.ListUserGifts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created, received, reserved []exportGift
+	for _, gift := range gifts {
+		if isHiddenFrom(userID, gift.Gift) {
+			continue
+		}
+		g, err := toExportGift(ctx, db, userID, gift, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert gift: %w", err)
+		}
+
+		if gift.CreatorID == userID {
+			created = append(created, g)
+		}
+		if gift.Content.ToID == userID && gift.Content.Status != store.MarkedForDeletionGiftStatus {
+			received = append(received, g)
+		}
+		if gift.Content.FromID != nil && *gift.Content.FromID == userID {
+			reserved = append(reserved, g)
+		}
+	}
+
+	reservations, err := db.ListUserWishlistReservations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, reservation := range reservations {
+		g, err := toExportGift(ctx, db, userID, reservation, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert wishlist reservation: %w", err)
+		}
+
+		if reservation.Content.ToID == userID {
+			received = append(received, g)
+		}
+		if reservation.Content.FromID != nil && *reservation.Content.FromID == userID {
+			reserved = append(reserved, g)
+		}
+	}
+
+	wishlist, err := db.ListWishlistItems(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	userComments, err := db.ListUserComments(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]exportComment, 0, len(userComments))
+	for _, comment := range userComments {
+		comments = append(comments, exportComment{
+			ID:        comment.ID,
+			GiftID:    comment.GiftID,
+			EventID:   comment.EventID,
+			CreatedAt: comment.CreatedAt,
+			Message:   comment.Message,
+		})
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", exportProfile{User: *user, Identities: identities}},
+		{"events.json", events},
+		{"gifts_created.json", created},
+		{"gifts_received.json", received},
+		{"reservations.json", reserved},
+		{"comments.json", comments},
+		{"wishlist.json", wishlist},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", file.name, err)
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// generateExport builds an export in the background and saves it.
+func generateExport(db store.Store, userID string, exportID string, now func() time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	content, err := buildExport(ctx, db, userID, now())
+	if err == nil {
+		err = db.CompleteDataExport(ctx, exportID, content, now().Add(ExportTTL))
+	}
+	if err != nil {
+		log.Printf("Error generating export %s: %v", exportID, err)
+		if err := db.FailDataExport(ctx, exportID); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func writeZip(w http.ResponseWriter, content []byte) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gifter-export.zip"`)
+	_, _ = w.Write(content)
+}
+
+type exportStatus struct {
+	Status      string     `json:"status"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExportUserData returns a zip of the personal data of the user. Large
+// accounts get their export generated in the background: the endpoint then
+// answers 202 until it is ready, and then a temporary download link.
+func ExportUserData(db store.Store, signer *token.Signer, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		count, err := db.CountUserData(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error exporting data", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		if count <= exportSyncLimit {
+			content, err := buildExport(ctx, db, userID, now())
+			if err != nil {
+				http.Error(w, "Error exporting data", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			writeZip(w, content)
+			return
+		}
+
+		latest, err := db.GetLatestDataExport(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error exporting data", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		switch {
+		case latest != nil && latest.Status == store.PendingDataExportStatus && now().Sub(latest.CreatedAt) < ExportStaleAfter:
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(exportStatus{Status: "pending"})
+		case latest != nil && latest.Status == store.ReadyDataExportStatus && latest.ExpiresAt != nil && latest.ExpiresAt.After(now()):
+			tok, err := signer.Sign(token.Claims{Purpose: exportPurpose, UserID: userID, Value: latest.ID}, latest.ExpiresAt.Sub(now()))
+			if err != nil {
+				http.Error(w, "Error exporting data", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(exportStatus{
+				Status:      "ready",
+				DownloadURL: serverURL() + "/api/user/export/download?token=" + url.QueryEscape(tok),
+				ExpiresAt:   latest.ExpiresAt,
+			})
+		default:
+			exportID, created, err := db.CreateDataExport(ctx, userID, now().Add(-ExportStaleAfter))
+			if err != nil {
+				http.Error(w, "Error exporting data", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			// otherwise, a concurrent request already started it
+			if created {
+				go generateExport(db, userID, exportID, now)
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(exportStatus{Status: "pending"})
+		}
+	}
+}
+
+// DownloadUserExport serves an export generated in the background, from the
+// link returned by ExportUserData.
+func DownloadUserExport(db store.Store, signer *token.Signer, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := signer.Verify(exportPurpose, r.URL.Query().Get("token"))
+		if err != nil || claims.UserID != userID {
+			http.Error(w, "Invalid or expired download link", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		content, err := db.GetDataExportContent(ctx, userID, claims.Value, now())
+		if err != nil {
+			http.Error(w, "Error fetching export", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if content == nil {
+			http.Error(w, "Export not found", http.StatusNotFound)
+			return
+		}
+
+		writeZip(w, content)
+	}
+}
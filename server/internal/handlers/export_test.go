@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+)
+
+// exportTestStore answers the queries of StoreGiftToGift, any other call
+// panics.
+type exportTestStore struct {
+	store.Store
+	names map[string]string
+}
+
+func (s exportTestStore) UserIDToName(_ context.Context, userID string, _ map[string]string) (string, error) {
+	return s.names[userID], nil
+}
+
+func (s exportTestStore) GetThankYouNote(context.Context, string) (*store.ThankYouNote, error) {
+	return nil, nil
+}
+
+func (s exportTestStore) GetReactionSummaries(_ context.Context, _ store.ReactionTarget, targetIDs []string, _ string) (map[string]store.ReactionSummary, error) {
+	summaries := make(map[string]store.ReactionSummary)
+	for _, targetID := range targetIDs {
+		summaries[targetID] = store.ReactionSummary{Reactions: []store.ReactionCount{}}
+	}
+	return summaries, nil
+}
+
+func TestToExportGiftMasksUntilEventIsOver(t *testing.T) {
+	ctx := context.Background()
+	db := exportTestStore{names: map[string]string{"1": "Alice", "2": "Bob"}}
+	eventDate := time.Date(2025, time.December, 25, 0, 0, 0, 0, time.UTC)
+	buyerID := "2"
+	gift := store.UserGift{
+		Gift: store.Gift{
+			ID:        "10",
+			CreatorID: "1",
+			Content: store.GiftContent{
+				Name:   "Surprise",
+				ToID:   "1",
+				FromID: &buyerID,
+				Status: store.BoughtGiftStatus,
+				Secret: true,
+			},
+		},
+		EventName: "Christmas",
+		EventDate: eventDate,
+		EventType: store.ChristmasEventType,
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		now      time.Time
+		masked   bool
+		fromName string
+	}{
+		{"recipient before the event", "1", eventDate.Add(-time.Hour), true, ""},
+		{"recipient on the event", "1", eventDate, true, ""},
+		{"recipient after the event", "1", eventDate.Add(time.Hour), false, "Bob"},
+		{"buyer before the event", "2", eventDate.Add(-time.Hour), false, "Bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := toExportGift(ctx, db, tt.userID, gift, tt.now)
+			if err != nil {
+				t.Fatalf("toExportGift() returned %v", err)
+			}
+			if g.FromName != tt.fromName {
+				t.Errorf("expected from name %q, got %q", tt.fromName, g.FromName)
+			}
+			if masked := g.Status == store.SecretGiftStatus && g.Name == ""; masked != tt.masked {
+				t.Errorf("expected masked to be %v, got status %d and name %q", tt.masked, g.Status, g.Name)
+			}
+			if g.EventName != "Christmas" || !g.EventDate.Equal(eventDate) {
+				t.Errorf("unexpected event %s on %s", g.EventName, g.EventDate)
+			}
+		})
+	}
+}
+
+func TestToExportGiftMasksWishlistItemsUntilEventIsOver(t *testing.T) {
+	ctx := context.Background()
+	db := exportTestStore{names: map[string]string{"1": "Alice", "2": "Bob"}}
+	eventDate := time.Date(2025, time.December, 25, 0, 0, 0, 0, time.UTC)
+	buyerID := "2"
+	item := store.UserGift{
+		Gift: store.Gift{
+			ID:        "20",
+			CreatorID: "1",
+			EventID:   "5",
+			Content: store.GiftContent{
+				Name:   "Book",
+				ToID:   "1",
+				FromID: &buyerID,
+				Status: store.BoughtGiftStatus,
+			},
+		},
+		EventName:    "Christmas",
+		EventDate:    eventDate,
+		EventType:    store.ChristmasEventType,
+		WishlistItem: true,
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		now      time.Time
+		status   store.GiftStatus
+		fromName string
+	}{
+		{"owner before the event", "1", eventDate.Add(-time.Hour), store.SecretGiftStatus, ""},
+		{"owner after the event", "1", eventDate.Add(time.Hour), store.BoughtGiftStatus, "Bob"},
+		{"buyer before the event", "2", eventDate.Add(-time.Hour), store.BoughtGiftStatus, "Bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := toExportGift(ctx, db, tt.userID, item, tt.now)
+			if err != nil {
+				t.Fatalf("toExportGift() returned %v", err)
+			}
+			if !g.WishlistItem || g.Name != "Book" || g.EventID != "5" {
+				t.Errorf("unexpected wishlist item %+v", g.Gift)
+			}
+			if g.Status != tt.status || g.FromName != tt.fromName {
+				t.Errorf("expected status %d from %q, got %d from %q", tt.status, tt.fromName, g.Status, g.FromName)
+			}
+		})
+	}
+}
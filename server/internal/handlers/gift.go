@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/epot/gifterv2/internal/mailer"
 	"github.com/epot/gifterv2/internal/store"
 	"github.com/markbates/goth/gothic"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -24,6 +26,21 @@ type Gift struct {
 	CreatedAt    time.Time        `json:"created_at"`
 	EventID      string           `json:"event_id"`
 	Secret       bool             `json:"secret"`
+	Priority     int              `json:"priority"`
+	Price        int64            `json:"price"`
+	Idea         bool             `json:"idea"`
+	// WishlistItem tells whether the gift is a wishlist item bought or
+	// reserved in the event, on the shopping list or among received gifts.
+	WishlistItem bool `json:"wishlist_item,omitempty"`
+	// Purchase and ThankYouNote are only shown to the buyer.
+	Purchase     *store.GiftPurchase `json:"purchase,omitempty"`
+	ThankYouNote *store.ThankYouNote `json:"thank_you_note,omitempty"`
+	// the recipient neither votes nor sees the votes on their gifts
+	store.ReactionSummary
+	// Votes and Voted are the up votes and whether the user up voted, for the
+	// clients of the former votes on ideas.
+	Votes int  `json:"votes"`
+	Voted bool `json:"voted"`
 }
 
 type Gifts struct {
@@ -35,8 +52,12 @@ type createGiftRequest struct {
 	ToID   string   `json:"to_id"`
 	URLs   []string `json:"urls"`
 	Secret bool     `json:"secret"`
+	Idea   bool     `json:"idea"`
 }
 
+// GetGifts lists the gifts of an event, filtered, sorted and paged as told
+// by the query parameters, see parseGiftQuery. The Link header points to the
+// next page, if any.
 func GetGifts(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve user ID from session
@@ -60,24 +81,44 @@ func GetGifts(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		gifts, err := db.ListGifts(ctx, userID, eventID)
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		query, err := parseGiftQuery(r.URL.Query(), userID, *event)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		gifts, next, err := db.QueryGifts(ctx, eventID, query)
 		if err != nil {
 			http.Error(w, "Error fetching gifts", http.StatusInternalServerError)
+			log.Println(err)
 			return
 		}
 
-		result := make([]Gift, 0, len(gifts))
-		for _, gift := range gifts {
-			if gift.Content.Status == store.MarkedForDeletionGiftStatus {
-				continue
-			}
-			g, err := StoreGiftToGift(ctx, db, userID, gift)
+		result, err := StoreGiftsToGifts(ctx, db, userID, event.Type, gifts)
+		if err != nil {
+			http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+			log.Println("Error converting gift:", err)
+			return
+		}
+
+		if next != nil {
+			cursor, err := encodeGiftCursor(query.Sort, *next)
 			if err != nil {
 				http.Error(w, "Error processing gifts", http.StatusInternalServerError)
-				log.Println("Error converting gift:", err)
+				log.Println(err)
 				return
 			}
-			result = append(result, g)
+			nextURL := *r.URL
+			values := nextURL.Query()
+			values.Set("cursor", cursor)
+			nextURL.RawQuery = values.Encode()
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
 		}
 
 		// Respond with user data
@@ -109,10 +150,6 @@ func CreateGift(db store.Store) http.HandlerFunc {
 			http.Error(w, "Gift name is required", http.StatusBadRequest)
 			return
 		}
-		if req.ToID == "" {
-			http.Error(w, "To ID is required", http.StatusBadRequest)
-			return
-		}
 
 		ctx := r.Context()
 
@@ -126,15 +163,40 @@ func CreateGift(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		var urls []string
-		for _, url := range req.URLs {
-			trimmedURL := strings.TrimSpace(url)
-			if trimmedURL != "" {
-				urls = append(urls, trimmedURL)
-			}
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		// a birthday has a single honoree, who receives every gift
+		if req.ToID == "" && event.Type.SingleHonoree() && len(event.HonoreeIDs) == 1 {
+			req.ToID = event.HonoreeIDs[0]
+		}
+		if req.ToID == "" {
+			http.Error(w, "To ID is required", http.StatusBadRequest)
+			return
+		}
+
+		canReceive, err := canReceiveGifts(ctx, db, *event, req.ToID)
+		if err != nil {
+			http.Error(w, "Error checking recipient", http.StatusInternalServerError)
+			return
+		}
+		if !canReceive {
+			http.Error(w, "This user cannot receive gifts in this event", http.StatusBadRequest)
+			return
 		}
 
-		err = db.CreateGift(ctx, userID, req.Name, eventID, req.ToID, urls, req.Secret)
+		if req.Idea {
+			if req.ToID == userID {
+				http.Error(w, "You cannot suggest ideas for yourself", http.StatusBadRequest)
+				return
+			}
+			err = db.CreateGiftIdea(ctx, userID, req.Name, eventID, req.ToID, trimURLs(req.URLs))
+		} else {
+			err = db.CreateGift(ctx, userID, req.Name, eventID, req.ToID, trimURLs(req.URLs), req.Secret)
+		}
 		if err != nil {
 			http.Error(w, "Error creating gift", http.StatusInternalServerError)
 			return
@@ -182,6 +244,10 @@ func UpdateGift(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		if getGift(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
 		err = db.UpdateGift(ctx, userID, giftID, eventID, req.Status)
 		if err != nil {
 			http.Error(w, "Error updating gift", http.StatusInternalServerError)
@@ -192,6 +258,213 @@ func UpdateGift(db store.Store) http.HandlerFunc {
 	}
 }
 
+type editGiftRequest struct {
+	Name     *string   `json:"name"`
+	URLs     *[]string `json:"urls"`
+	ToID     *string   `json:"to_id"`
+	Secret   *bool     `json:"secret"`
+	Priority *int      `json:"priority"`
+	Price    *int64    `json:"price"`
+}
+
+// validateGiftURLs returns urls trimmed, or an error naming the first one
+// that is not an http(s) URL.
+func validateGiftURLs(urls []string) ([]string, error) {
+	trimmed := trimURLs(urls)
+	for _, rawURL := range trimmed {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid URL: %s", rawURL)
+		}
+	}
+	return trimmed, nil
+}
+
+// canEditGift tells whether userID may edit the details of gift: its creator,
+// or its recipient unless it is secret or an idea as they do not even know
+// what it is.
+func canEditGift(userID string, gift store.Gift) bool {
+	return gift.CreatorID == userID || (gift.Content.ToID == userID && !gift.Content.Secret && !gift.Content.Idea)
+}
+
+// isHiddenFrom tells whether gift does not exist for userID: ideas are never
+// shown to their recipient, not even masked.
+func isHiddenFrom(userID string, gift store.Gift) bool {
+	return gift.Content.Idea && gift.Content.ToID == userID
+}
+
+// getGift returns the gift of the event if it is not hidden from userID.
+// Otherwise, it writes the error response and returns nil.
+func getGift(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, giftID string) *store.Gift {
+	gift, err := db.GetGift(r.Context(), eventID, giftID)
+	if err != nil {
+		http.Error(w, "Error fetching gift", http.StatusInternalServerError)
+		log.Println(err)
+		return nil
+	}
+	if gift == nil || isHiddenFrom(userID, *gift) {
+		http.Error(w, "Gift not found", http.StatusNotFound)
+		return nil
+	}
+	return gift
+}
+
+// EditGift changes the details of a gift. Its creator and its recipient can
+// edit its name, URLs, priority and price in cents, only its creator can
+// change its recipient or make it secret. The buyer is emailed when details
+// that matter to them change after they reserved the gift.
+func EditGift(db store.Store, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req editGiftRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				http.Error(w, "Gift name cannot be empty", http.StatusBadRequest)
+				return
+			}
+			req.Name = &name
+		}
+		if req.URLs != nil {
+			urls, err := validateGiftURLs(*req.URLs)
+			if err != nil {
+				http.Error(w, "Gift URLs are invalid: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.URLs = &urls
+		}
+		if req.ToID != nil && *req.ToID == "" {
+			http.Error(w, "To ID cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if req.Priority != nil && (*req.Priority < 0 || *req.Priority > store.MaxGiftPriority) {
+			http.Error(w, fmt.Sprintf("Gift priority must be between 0 and %d", store.MaxGiftPriority), http.StatusBadRequest)
+			return
+		}
+		if req.Price != nil && *req.Price < 0 {
+			http.Error(w, "Gift price cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		gift := getGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		if gift.Content.Status == store.MarkedForDeletionGiftStatus {
+			http.Error(w, "Gift not found", http.StatusNotFound)
+			return
+		}
+
+		if !canEditGift(userID, *gift) {
+			http.Error(w, "Only the creator or the recipient of the gift can edit it", http.StatusForbidden)
+			return
+		}
+		if gift.CreatorID != userID && (req.ToID != nil || req.Secret != nil) {
+			http.Error(w, "Only the creator of the gift can change its recipient or secrecy", http.StatusForbidden)
+			return
+		}
+
+		if req.ToID != nil && *req.ToID == userID && gift.Content.Idea {
+			http.Error(w, "You cannot suggest ideas for yourself", http.StatusBadRequest)
+			return
+		}
+		if req.ToID != nil {
+			canReceive, err := canReceiveGifts(ctx, db, *event, *req.ToID)
+			if err != nil {
+				http.Error(w, "Error checking recipient", http.StatusInternalServerError)
+				return
+			}
+			if !canReceive {
+				http.Error(w, "This user cannot receive gifts in this event", http.StatusBadRequest)
+				return
+			}
+		}
+
+		edited, err := db.EditGift(ctx, giftID, eventID, store.GiftEdit{
+			Name:     req.Name,
+			URLs:     req.URLs,
+			ToID:     req.ToID,
+			Secret:   req.Secret,
+			Priority: req.Priority,
+			Price:    req.Price,
+		})
+		if err != nil {
+			http.Error(w, "Error editing gift", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		if edited.BuyerID != nil && *edited.BuyerID != userID {
+			// the edit is saved, failing to tell the buyer must not undo it
+			if err := notifyGiftBuyer(ctx, db, m, *event, *edited); err != nil {
+				log.Println("Error notifying buyer:", err)
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// notifyGiftBuyer emails the buyer of an edited gift about the change.
+func notifyGiftBuyer(ctx context.Context, db store.Store, m mailer.Mailer, event store.Event, edited store.EditedGift) error {
+	buyer, err := db.GetUserByID(ctx, *edited.BuyerID)
+	if err != nil {
+		return fmt.Errorf("failed to get buyer: %w", err)
+	}
+	if buyer == nil {
+		return nil
+	}
+
+	body := fmt.Sprintf("The gift \"%s\" of the event \"%s\" has changed since you reserved it.", edited.Content.Name, event.Name)
+	if edited.Released {
+		body += " Your reservation was released, reserve it again if you still want to offer it."
+	} else {
+		body += " Check that it is still what you bought."
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      buyer.Email,
+		Subject: "A gift you reserved on Gifter has changed",
+		Body:    body,
+	})
+}
+
 func DeleteGift(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve user ID from session
@@ -226,6 +499,10 @@ func DeleteGift(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		if getGift(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
 		err = db.UpdateGift(ctx, userID, giftID, eventID, store.MarkedForDeletionGiftStatus)
 		if err != nil {
 			http.Error(w, "Error deleting gift", http.StatusInternalServerError)
@@ -236,13 +513,136 @@ func DeleteGift(db store.Store) http.HandlerFunc {
 	}
 }
 
+type transferGiftsRequest struct {
+	GiftIDs          []string `json:"gift_ids"`
+	TargetEventID    string   `json:"target_event_id"`
+	Move             bool     `json:"move"`
+	KeepReservations bool     `json:"keep_reservations"`
+	KeepURLs         *bool    `json:"keep_urls"`
+	KeepComments     *bool    `json:"keep_comments"`
+}
+
+type transferGiftsResponse struct {
+	GiftIDs []string `json:"gift_ids"`
+}
+
+// TransferGifts copies or moves gifts to another event of the user, e.g. to
+// carry the wishes that were not fulfilled at Christmas over to a birthday.
+// URLs and comments are kept unless asked otherwise, reservations are reset
+// unless asked otherwise. Only the creator of a gift can move it, and nobody
+// can carry over the gifts addressed to them by others, which they cannot
+// fully see.
+func TransferGifts(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req transferGiftsRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		if len(req.GiftIDs) == 0 {
+			http.Error(w, "Gift IDs are required", http.StatusBadRequest)
+			return
+		}
+		if req.TargetEventID == "" || req.TargetEventID == eventID {
+			http.Error(w, "Target event must be another event", http.StatusBadRequest)
+			return
+		}
+
+		for _, id := range []string{eventID, req.TargetEventID} {
+			hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, id)
+			if err != nil {
+				http.Error(w, "Error checking event access", http.StatusInternalServerError)
+				return
+			}
+			if !hasAccess {
+				http.Error(w, "Event not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		targetEvent, err := db.GetEvent(ctx, req.TargetEventID)
+		if err != nil || targetEvent == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		gifts, err := db.ListGifts(ctx, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error fetching gifts", http.StatusInternalServerError)
+			return
+		}
+		giftsByID := make(map[string]store.Gift, len(gifts))
+		for _, gift := range gifts {
+			giftsByID[gift.ID] = gift
+		}
+
+		for _, giftID := range req.GiftIDs {
+			gift, ok := giftsByID[giftID]
+			if !ok || gift.Content.Status == store.MarkedForDeletionGiftStatus || isHiddenFrom(userID, gift) {
+				http.Error(w, "Gift not found", http.StatusBadRequest)
+				return
+			}
+			if gift.Content.ToID == userID && gift.CreatorID != userID {
+				http.Error(w, "You cannot transfer gifts addressed to you", http.StatusForbidden)
+				return
+			}
+			if req.Move && gift.CreatorID != userID {
+				http.Error(w, "Only the creator of a gift can move it", http.StatusForbidden)
+				return
+			}
+
+			canReceive, err := canReceiveGifts(ctx, db, *targetEvent, gift.Content.ToID)
+			if err != nil {
+				http.Error(w, "Error checking recipient", http.StatusInternalServerError)
+				return
+			}
+			if !canReceive {
+				http.Error(w, "A recipient cannot receive gifts in the target event", http.StatusBadRequest)
+				return
+			}
+		}
+
+		transfer := store.GiftTransfer{
+			Move:             req.Move,
+			KeepReservations: req.KeepReservations,
+			KeepURLs:         req.KeepURLs == nil || *req.KeepURLs,
+			KeepComments:     req.KeepComments == nil || *req.KeepComments,
+		}
+		giftIDs, err := db.TransferGifts(ctx, userID, req.GiftIDs, eventID, req.TargetEventID, transfer)
+		if err != nil {
+			http.Error(w, "Error transferring gifts", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(transferGiftsResponse{GiftIDs: giftIDs})
+	}
+}
+
 func checkIfUserHasAccessToEvents(
 	ctx context.Context,
 	db store.Store,
 	userID string,
 	eventID string,
 ) (bool, error) {
-	events, err := db.ListEvents(ctx, userID)
+	// archived events stay readable
+	events, err := db.ListEvents(ctx, userID, store.AllEventFilter, time.Now())
 	if err != nil {
 		return false, fmt.Errorf("error fetching events: %w", err)
 	}
@@ -258,7 +658,67 @@ func checkIfUserHasAccessToEvents(
 	return foundEvent, nil
 }
 
-func StoreGiftToGift(ctx context.Context, s store.Store, userID string, gift store.Gift) (g Gift, _ error) {
+// canReceiveGifts tells whether userID may be the recipient of gifts of
+// event: its honorees for events that have some, any participant otherwise.
+func canReceiveGifts(ctx context.Context, db store.Store, event store.Event, userID string) (bool, error) {
+	if event.Type.HasHonorees() {
+		return event.IsHonoree(userID), nil
+	}
+
+	participants, err := db.GetEventParticipants(ctx, event.ID)
+	if err != nil {
+		return false, fmt.Errorf("error fetching participants: %w", err)
+	}
+	for _, participant := range participants {
+		if participant.ID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// giftReactionSummaries returns the votes and reactions on the gifts, by gift
+// ID, at once. The gifts addressed to userID are left out.
+func giftReactionSummaries(ctx context.Context, s store.Store, userID string, gifts []store.Gift) (map[string]store.ReactionSummary, error) {
+	var giftIDs []string
+	for _, gift := range gifts {
+		if gift.Content.ToID != userID {
+			giftIDs = append(giftIDs, gift.ID)
+		}
+	}
+	return s.GetReactionSummaries(ctx, store.GiftReactionTarget, giftIDs, userID)
+}
+
+// StoreGiftsToGifts converts gifts of an event as seen by userID, like
+// StoreGiftToGift, fetching their votes and reactions at once.
+func StoreGiftsToGifts(ctx context.Context, s store.Store, userID string, eventType store.EventType, gifts []store.Gift) ([]Gift, error) {
+	summaries, err := giftReactionSummaries(ctx, s, userID, gifts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Gift, 0, len(gifts))
+	for _, gift := range gifts {
+		g, err := storeGiftToGift(ctx, s, userID, eventType, gift, summaries)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, g)
+	}
+	return result, nil
+}
+
+func StoreGiftToGift(ctx context.Context, s store.Store, userID string, eventType store.EventType, gift store.Gift) (Gift, error) {
+	summaries, err := giftReactionSummaries(ctx, s, userID, []store.Gift{gift})
+	if err != nil {
+		return Gift{}, err
+	}
+	return storeGiftToGift(ctx, s, userID, eventType, gift, summaries)
+}
+
+// storeGiftToGift converts a gift as seen by userID, with its votes and
+// reactions among summaries.
+func storeGiftToGift(ctx context.Context, s store.Store, userID string, eventType store.EventType, gift store.Gift, summaries map[string]store.ReactionSummary) (g Gift, _ error) {
 	var userIDToName = make(map[string]string)
 	g.ID = gift.ID
 	g.EventID = gift.EventID
@@ -286,9 +746,31 @@ func StoreGiftToGift(ctx context.Context, s store.Store, userID string, gift sto
 	g.URLs = gift.Content.URLs
 	g.Name = gift.Content.Name
 	g.Status = gift.Content.Status
+	g.Priority = gift.Content.Priority
+	g.Price = gift.Content.Price
+	g.Idea = gift.Content.Idea
+	if gift.Content.FromID != nil && *gift.Content.FromID == userID {
+		g.Purchase = gift.Content.Purchase
+		g.ThankYouNote, err = s.GetThankYouNote(ctx, gift.ID)
+		if err != nil {
+			return g, err
+		}
+	}
+	g.Reactions = []store.ReactionCount{}
+	if summary, ok := summaries[gift.ID]; ok && gift.Content.ToID != userID {
+		g.ReactionSummary = summary
+		g.Votes = summary.Upvotes
+		g.Voted = summary.Vote == 1
+	}
 
 	if gift.Content.ToID == userID {
-		g.Status = store.SecretGiftStatus
+		if eventType.HonoreesSeeReservations() {
+			// like a registry, the recipient sees whether the gift is
+			// taken but never by whom
+			g.FromName = ""
+		} else {
+			g.Status = store.SecretGiftStatus
+		}
 		g.StatusFrozen = true
 	}
 
@@ -297,6 +779,8 @@ func StoreGiftToGift(ctx context.Context, s store.Store, userID string, gift sto
 		if gift.Content.ToID == userID {
 			g.Name = ""
 			g.URLs = nil
+			g.Priority = 0
+			g.Price = 0
 		}
 	}
 
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+)
+
+// MaxGiftPageSize is the maximum number of gifts of a page.
+const MaxGiftPageSize = 100
+
+var giftSorts = map[string]store.GiftSort{
+	"created":  store.CreatedGiftSort,
+	"priority": store.PriorityGiftSort,
+	"name":     store.NameGiftSort,
+	"price":    store.PriceGiftSort,
+}
+
+// giftPageCursor is the cursor of a page of gifts, only valid with the sort
+// it was made for.
+type giftPageCursor struct {
+	Sort store.GiftSort `json:"sort"`
+	store.GiftCursor
+}
+
+func encodeGiftCursor(sort store.GiftSort, cursor store.GiftCursor) (string, error) {
+	encoded, err := json.Marshal(giftPageCursor{Sort: sort, GiftCursor: cursor})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal gift cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeGiftCursor(sort store.GiftSort, cursor string) (*store.GiftCursor, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded giftPageCursor
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.Sort != sort {
+		return nil, errors.New("cursor of another sort")
+	}
+	if _, err := strconv.Atoi(decoded.ID); err != nil {
+		return nil, err
+	}
+	// the key is compared in SQL, where a value of the wrong type fails
+	switch sort {
+	case store.CreatedGiftSort:
+		_, err = time.Parse(time.DateTime, decoded.Key)
+	case store.PriorityGiftSort, store.PriceGiftSort:
+		_, err = strconv.ParseInt(decoded.Key, 10, 64)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &decoded.GiftCursor, nil
+}
+
+// parseGiftQuery reads the filters, sort and page of a gift list of event
+// from the query parameters of the request:
+//   - recipient: the ID of the recipient of the gifts
+//   - status: the status of the gifts, as seen by userID
+//   - buyer: "me" for the gifts userID reserved or bought
+//   - has_comments: whether the gifts have comments
+//   - sort: created (default), priority, name or price
+//   - limit: the size of the pages, all gifts are returned without it
+//   - cursor: where the page starts, given by the Link header of the
+//     previous page
+//
+// The error is the message for the user when a parameter is invalid.
+func parseGiftQuery(values url.Values, userID string, event store.Event) (store.GiftQuery, error) {
+	query := store.GiftQuery{
+		ViewerID:            userID,
+		HideRecipientStatus: !event.Type.HonoreesSeeReservations(),
+		RecipientID:         values.Get("recipient"),
+	}
+
+	if value := values.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < store.NewGiftStatus || status > store.SecretGiftStatus || status == store.MarkedForDeletionGiftStatus {
+			return query, errors.New("Invalid status")
+		}
+		giftStatus := store.GiftStatus(status)
+		query.Status = &giftStatus
+	}
+
+	switch values.Get("buyer") {
+	case "":
+	case "me":
+		query.BuyerID = userID
+	default:
+		return query, errors.New("Buyer can only be me")
+	}
+
+	if value := values.Get("has_comments"); value != "" {
+		hasComments, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, errors.New("Invalid has_comments")
+		}
+		query.HasComments = &hasComments
+	}
+
+	if value := values.Get("sort"); value != "" {
+		sort, ok := giftSorts[value]
+		if !ok {
+			return query, errors.New("Sort must be created, priority, name or price")
+		}
+		query.Sort = sort
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxGiftPageSize {
+			return query, fmt.Errorf("Limit must be between 1 and %d", MaxGiftPageSize)
+		}
+		query.Limit = limit
+	}
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeGiftCursor(query.Sort, value)
+		if err != nil {
+			return query, errors.New("Invalid cursor")
+		}
+		query.After = cursor
+	}
+
+	return query, nil
+}
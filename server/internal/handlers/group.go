@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+type Groups struct {
+	Groups []store.Group `json:"groups"`
+}
+
+type GroupMembers struct {
+	Members []store.GroupMember `json:"members"`
+}
+
+// getGroupRole returns the role of userID in the group, provided they are a
+// member of it and, if admin is true, one of its admins. Otherwise, it writes
+// the error response and returns nil.
+func getGroupRole(w http.ResponseWriter, r *http.Request, db store.Store, userID string, groupID string, admin bool) *store.GroupRole {
+	role, err := db.GetGroupRole(r.Context(), groupID, userID)
+	if err != nil {
+		http.Error(w, "Error checking group access", http.StatusInternalServerError)
+		log.Println(err)
+		return nil
+	}
+	if role == nil {
+		http.Error(w, "Group not found", http.StatusBadRequest)
+		return nil
+	}
+	if admin && *role != store.AdminGroupRole {
+		http.Error(w, "Only the admins of the group can do this", http.StatusForbidden)
+		return nil
+	}
+	return role
+}
+
+func GetGroups(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		groups, err := db.ListGroups(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Error fetching groups", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(Groups{Groups: groups})
+	}
+}
+
+type groupRequest struct {
+	Name string `json:"name"`
+}
+
+type createGroupResponse struct {
+	ID string `json:"id"`
+}
+
+func CreateGroup(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req groupRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		groupID, err := db.CreateGroup(r.Context(), userID, req.Name)
+		if err != nil {
+			http.Error(w, "Error creating group", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(createGroupResponse{ID: groupID})
+	}
+}
+
+func UpdateGroup(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			groupID = r.PathValue("group_id")
+		)
+
+		var req groupRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		if getGroupRole(w, r, db, userID, groupID, true) == nil {
+			return
+		}
+
+		err = db.RenameGroup(r.Context(), groupID, req.Name)
+		if err != nil {
+			http.Error(w, "Error updating group", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+func DeleteGroup(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		groupID := r.PathValue("group_id")
+		if getGroupRole(w, r, db, userID, groupID, true) == nil {
+			return
+		}
+
+		err = db.DeleteGroup(r.Context(), groupID)
+		if err != nil {
+			http.Error(w, "Error deleting group", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+func GetGroupMembers(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		groupID := r.PathValue("group_id")
+		if getGroupRole(w, r, db, userID, groupID, false) == nil {
+			return
+		}
+
+		members, err := db.GetGroupMembers(r.Context(), groupID)
+		if err != nil {
+			http.Error(w, "Error fetching group members", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(GroupMembers{Members: members})
+	}
+}
+
+type newGroupMemberRequest struct {
+	Email string          `json:"email"`
+	Role  store.GroupRole `json:"role"`
+}
+
+func AddGroupMember(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			groupID = r.PathValue("group_id")
+		)
+
+		var req newGroupMemberRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+		if !req.Role.Valid() {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+
+		if getGroupRole(w, r, db, userID, groupID, true) == nil {
+			return
+		}
+
+		err = db.AddGroupMember(r.Context(), groupID, req.Email, req.Role)
+		if err != nil {
+			if store.IsUnknownParticipantError(err) {
+				http.Error(w, "Email does not exist", http.StatusBadRequest)
+				return
+			}
+			if store.IsUnverifiedParticipantError(err) {
+				http.Error(w, "This user has not verified their email yet", http.StatusBadRequest)
+				return
+			}
+			if store.IsAlreadyGroupMemberError(err) {
+				http.Error(w, "This user is already a member of this group", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error adding group member", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+type updateGroupMemberRequest struct {
+	Role store.GroupRole `json:"role"`
+}
+
+func UpdateGroupMember(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			groupID = r.PathValue("group_id")
+		)
+
+		var req updateGroupMemberRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+		if !req.Role.Valid() {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+
+		if getGroupRole(w, r, db, userID, groupID, true) == nil {
+			return
+		}
+
+		updated, err := db.UpdateGroupMemberRole(r.Context(), groupID, r.PathValue("user_id"), req.Role)
+		if err != nil {
+			if store.IsLastGroupAdminError(err) {
+				http.Error(w, "The group needs at least one admin", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error updating group member", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !updated {
+			http.Error(w, "Group member not found", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// RemoveGroupMember removes a member from a group. Admins can remove anyone,
+// and members can remove themselves to leave the group.
+func RemoveGroupMember(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			groupID  = r.PathValue("group_id")
+			memberID = r.PathValue("user_id")
+		)
+
+		if getGroupRole(w, r, db, userID, groupID, memberID != userID) == nil {
+			return
+		}
+
+		err = db.RemoveGroupMember(r.Context(), groupID, memberID)
+		if err != nil {
+			if store.IsLastGroupAdminError(err) {
+				http.Error(w, "The last admin of the group cannot leave it, delete it instead", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error removing group member", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+type addGroupToEventRequest struct {
+	GroupID string `json:"group_id"`
+	Sync    bool   `json:"sync"`
+}
+
+// AddGroupToEvent adds every member of a group to an event, and optionally
+// keeps the event in sync with the members of the group. Only the owners of
+// the event can add groups they are a member of.
+func AddGroupToEvent(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			eventID = r.PathValue("event_id")
+		)
+
+		var req addGroupToEventRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+		if getGroupRole(w, r, db, userID, req.GroupID, false) == nil {
+			return
+		}
+
+		err = db.AddGroupToEvent(r.Context(), eventID, req.GroupID, req.Sync)
+		if err != nil {
+			http.Error(w, "Error adding group", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+type voteGiftResponse struct {
+	Voted bool `json:"voted"`
+	Votes int  `json:"votes"`
+}
+
+// getGiftIdea returns the idea of the event, which is hidden from its
+// recipient. Otherwise, it writes the error response and returns nil.
+func getGiftIdea(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, giftID string) *store.Gift {
+	hasAccess, err := checkIfUserHasAccessToEvents(r.Context(), db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	gift := getGift(w, r, db, userID, eventID, giftID)
+	if gift == nil {
+		return nil
+	}
+	if gift.Content.Status == store.MarkedForDeletionGiftStatus {
+		http.Error(w, "Gift not found", http.StatusNotFound)
+		return nil
+	}
+	if !gift.Content.Idea {
+		http.Error(w, "This gift is not an idea", http.StatusBadRequest)
+		return nil
+	}
+	return gift
+}
+
+// VoteGiftIdea adds the up vote of the user for an idea, or removes it if
+// they already voted for it.
+//
+// Deprecated: kept for former clients, ToggleGiftReaction votes on any gift.
+func VoteGiftIdea(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		if getGiftIdea(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
+		voted, err := db.ToggleGiftVote(ctx, userID, giftID, now())
+		if err != nil {
+			http.Error(w, "Error voting", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		votes, _, err := db.CountGiftVotes(ctx, giftID, userID)
+		if err != nil {
+			http.Error(w, "Error voting", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(voteGiftResponse{Voted: voted, Votes: votes})
+	}
+}
+
+// PromoteGiftIdea turns an idea into a regular gift, reserved by the user.
+func PromoteGiftIdea(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+		)
+
+		if getGiftIdea(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
+		promoted, err := db.PromoteGiftIdea(r.Context(), userID, giftID, eventID)
+		if err != nil {
+			http.Error(w, "Error promoting idea", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !promoted {
+			http.Error(w, "This idea is not available anymore", http.StatusConflict)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
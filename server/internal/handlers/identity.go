@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/gothic"
+)
+
+type Providers struct {
+	Providers []string `json:"providers"`
+}
+
+// ListProvidersHandler returns the login providers enabled on this server.
+func ListProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	providers := make([]string, 0, len(goth.GetProviders()))
+	for name := range goth.GetProviders() {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+
+	_ = json.NewEncoder(w).Encode(Providers{Providers: providers})
+}
+
+// popLinkProvider returns the provider a link was requested for, if any, and
+// forgets about it.
+func popLinkProvider(w http.ResponseWriter, r *http.Request) string {
+	session, err := gothic.Store.Get(r, linkSessionName)
+	if err != nil {
+		return ""
+	}
+	provider, _ := session.Values["provider"].(string)
+	if provider == "" {
+		return ""
+	}
+
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		log.Println(err)
+	}
+	return provider
+}
+
+type Identities struct {
+	Identities []store.Identity `json:"identities"`
+}
+
+func ListIdentities(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		identities, err := db.ListIdentities(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching identities", http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(Identities{Identities: identities})
+	}
+}
+
+// linkSessionName is the session remembering that an OAuth flow was started
+// to link a provider. It is kept apart from the gothic session as gothic
+// rewrites that one during the flow.
+const linkSessionName = "_gifter_link"
+
+// BeginLinkIdentity starts the OAuth flow of the provider given in the
+// "provider" query parameter, remembering that the resulting identity must be
+// linked to the logged in user instead of logging in.
+func BeginLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	providerName, err := gothic.GetProviderName(r)
+	if err != nil {
+		http.Error(w, "Unknown provider", http.StatusBadRequest)
+		return
+	}
+	if _, err := goth.GetProvider(providerName); err != nil {
+		http.Error(w, "Unknown provider", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := gothic.Store.Get(r, linkSessionName)
+	session.Values["provider"] = providerName
+	err = session.Save(r, w)
+	if err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	gothic.BeginAuthHandler(w, r)
+}
+
+func UnlinkIdentity(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			provider = r.PathValue("provider")
+			ctx      = r.Context()
+		)
+
+		err = db.UnlinkIdentity(ctx, userID, provider)
+		if err != nil {
+			if store.IsLastLoginMethodError(err) {
+				http.Error(w, "Cannot unlink the last login method", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Error unlinking identity", http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/epot/gifterv2/internal/blob"
+	"github.com/epot/gifterv2/internal/imaging"
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+const (
+	// MaxImageSize is the maximum size of an uploaded image file.
+	MaxImageSize = 10 << 20
+	// MaxGiftImages is the maximum number of images of a gift.
+	MaxGiftImages = 10
+)
+
+type GiftImage struct {
+	store.GiftImage
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+type GiftImages struct {
+	Images []GiftImage `json:"images"`
+}
+
+type createGiftImageResponse struct {
+	ID string `json:"id"`
+}
+
+// getVisibleGift returns the gift of the event if userID can see it: not
+// trashed, and neither secret nor an idea if addressed to them. Otherwise, it
+// writes the error response and returns nil.
+func getVisibleGift(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, giftID string) *store.Gift {
+	ctx := r.Context()
+
+	hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	gift := getGift(w, r, db, userID, eventID, giftID)
+	if gift == nil {
+		return nil
+	}
+	if gift.Content.Status == store.MarkedForDeletionGiftStatus || (gift.Content.Secret && gift.Content.ToID == userID) {
+		http.Error(w, "Gift not found", http.StatusNotFound)
+		return nil
+	}
+	return gift
+}
+
+func generateBlobKey(giftID string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	return "gifts/" + giftID + "/" + hex.EncodeToString(raw), nil
+}
+
+func giftImageURL(eventID string, image store.GiftImage) string {
+	return "/api/events/" + eventID + "/gifts/" + image.GiftID + "/images/" + image.ID
+}
+
+func ListGiftImages(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+		)
+
+		if getVisibleGift(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
+		images, err := db.ListGiftImages(r.Context(), giftID)
+		if err != nil {
+			http.Error(w, "Error fetching images", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		result := make([]GiftImage, 0, len(images))
+		for _, image := range images {
+			url := giftImageURL(eventID, image)
+			result = append(result, GiftImage{GiftImage: image, URL: url, ThumbnailURL: url + "/thumbnail"})
+		}
+
+		_ = json.NewEncoder(w).Encode(GiftImages{Images: result})
+	}
+}
+
+// UploadGiftImage attaches the image in the request body to a gift. Only the
+// people who can edit the gift can add images to it. The image is stored
+// re-encoded, without its metadata, along with a thumbnail.
+func UploadGiftImage(db store.Store, blobs blob.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		gift := getVisibleGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		if !canEditGift(userID, *gift) {
+			http.Error(w, "Only the creator or the recipient of the gift can add images", http.StatusForbidden)
+			return
+		}
+
+		images, err := db.ListGiftImages(ctx, giftID)
+		if err != nil {
+			http.Error(w, "Error fetching images", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if len(images) >= MaxGiftImages {
+			http.Error(w, fmt.Sprintf("A gift cannot have more than %d images", MaxGiftImages), http.StatusBadRequest)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImageSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("Images cannot be larger than %d MB", MaxImageSize>>20), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		original, thumbnail, err := imaging.Process(data)
+		if err != nil {
+			if errors.Is(err, imaging.ErrUnsupportedFormat) {
+				http.Error(w, "Only JPEG, PNG and GIF images are supported", http.StatusUnsupportedMediaType)
+				return
+			}
+			if errors.Is(err, imaging.ErrTooLarge) {
+				http.Error(w, "Image dimensions are too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Error processing image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		key, err := generateBlobKey(giftID)
+		if err != nil {
+			http.Error(w, "Error storing image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		image := store.GiftImage{
+			GiftID:               giftID,
+			UploaderID:           userID,
+			BlobKey:              key,
+			ContentType:          original.ContentType,
+			Width:                original.Width,
+			Height:               original.Height,
+			Size:                 len(original.Content),
+			ThumbnailKey:         key + "-thumbnail",
+			ThumbnailContentType: thumbnail.ContentType,
+		}
+
+		err = blobs.Put(ctx, image.BlobKey, original.Content, original.ContentType)
+		if err == nil {
+			err = blobs.Put(ctx, image.ThumbnailKey, thumbnail.Content, thumbnail.ContentType)
+		}
+		if err != nil {
+			http.Error(w, "Error storing image", http.StatusInternalServerError)
+			log.Println(err)
+			deleteImageBlobs(ctx, blobs, image)
+			return
+		}
+
+		imageID, err := db.CreateGiftImage(ctx, image)
+		if err != nil {
+			http.Error(w, "Error storing image", http.StatusInternalServerError)
+			log.Println(err)
+			deleteImageBlobs(ctx, blobs, image)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(createGiftImageResponse{ID: imageID})
+	}
+}
+
+// deleteImageBlobs deletes the blobs of an image that could not be saved,
+// logging failures as there is nothing more to do about them.
+func deleteImageBlobs(ctx context.Context, blobs blob.Store, image store.GiftImage) {
+	for _, key := range []string{image.BlobKey, image.ThumbnailKey} {
+		if err := blobs.Delete(ctx, key); err != nil {
+			log.Println("Error deleting blob:", err)
+		}
+	}
+}
+
+// GetGiftImage serves an image of a gift, or its thumbnail, to the people
+// who can see the gift.
+func GetGiftImage(db store.Store, blobs blob.Store, thumbnail bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		if getVisibleGift(w, r, db, userID, eventID, giftID) == nil {
+			return
+		}
+
+		image, err := db.GetGiftImage(ctx, giftID, r.PathValue("image_id"))
+		if err != nil {
+			http.Error(w, "Error fetching image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if image == nil {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+
+		key, contentType := image.BlobKey, image.ContentType
+		if thumbnail {
+			key, contentType = image.ThumbnailKey, image.ThumbnailContentType
+		}
+		content, err := blobs.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, blob.ErrNotFound) {
+				http.Error(w, "Image not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		defer content.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		if !thumbnail {
+			w.Header().Set("Content-Length", strconv.Itoa(image.Size))
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+		// images never change, but access to them may
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		if _, err := io.Copy(w, content); err != nil {
+			log.Println("Error sending image:", err)
+		}
+	}
+}
+
+// DeleteGiftImage removes an image from a gift. Its uploader and the creator
+// of the gift can do this.
+func DeleteGiftImage(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			imageID = r.PathValue("image_id")
+			ctx     = r.Context()
+		)
+
+		gift := getVisibleGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+
+		image, err := db.GetGiftImage(ctx, giftID, imageID)
+		if err != nil {
+			http.Error(w, "Error fetching image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if image == nil {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		if image.UploaderID != userID && gift.CreatorID != userID {
+			http.Error(w, "Only the uploader of the image or the creator of the gift can delete it", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.DetachGiftImage(ctx, giftID, imageID); err != nil {
+			http.Error(w, "Error deleting image", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+const joinLinkTokenSize = 24
+
+func generateJoinLinkToken() (string, error) {
+	raw := make([]byte, joinLinkTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate join link token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+type JoinLinks struct {
+	Links []store.JoinLink `json:"links"`
+}
+
+type createJoinLinkRequest struct {
+	Role      *store.ParticipantRole `json:"role"`
+	ExpiresAt *time.Time             `json:"expires_at"`
+	MaxUses   *int                   `json:"max_uses"`
+}
+
+type createJoinLinkResponse struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+// CreateJoinLink creates a link to join an event, optionally expiring or
+// limited to a number of uses. Only the owners of the event can create links.
+func CreateJoinLink(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			decoder = json.NewDecoder(r.Body)
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		var req createJoinLinkRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		role := store.ParticipantRole(store.MemberParticipantRole)
+		if req.Role != nil {
+			role = *req.Role
+		}
+		if !role.Valid() {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt != nil {
+			if !req.ExpiresAt.After(now()) {
+				http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+				return
+			}
+			expiresAt := req.ExpiresAt.UTC()
+			req.ExpiresAt = &expiresAt
+		}
+		if req.MaxUses != nil && *req.MaxUses < 1 {
+			http.Error(w, "Max uses must be at least 1", http.StatusBadRequest)
+			return
+		}
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		token, err := generateJoinLinkToken()
+		if err != nil {
+			http.Error(w, "Error creating join link", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		linkID, err := db.CreateJoinLink(ctx, eventID, userID, token, role, req.ExpiresAt, req.MaxUses)
+		if err != nil {
+			http.Error(w, "Error creating join link", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(createJoinLinkResponse{ID: linkID, Token: token})
+	}
+}
+
+// ListJoinLinks lists the links of an event that can still be redeemed.
+func ListJoinLinks(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		links, err := db.ListJoinLinks(ctx, eventID, now())
+		if err != nil {
+			http.Error(w, "Error fetching join links", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(JoinLinks{Links: links})
+	}
+}
+
+func RevokeJoinLink(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			linkID  = r.PathValue("link_id")
+			ctx     = r.Context()
+		)
+
+		if getEventAsOwner(w, r, db, userID, eventID) == nil {
+			return
+		}
+
+		revoked, err := db.RevokeJoinLink(ctx, eventID, linkID, now())
+		if err != nil {
+			http.Error(w, "Error revoking join link", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !revoked {
+			http.Error(w, "Join link not found", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+type redeemJoinLinkResponse struct {
+	EventID string `json:"event_id"`
+}
+
+// RedeemJoinLink makes the user join the event of a join link. Like adding a
+// participant by email, it requires a verified email: anybody can sign up
+// with any email, and other participants must know who they are dealing with.
+func RedeemJoinLink(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if !user.EmailVerified {
+			http.Error(w, "Verify your email before joining events", http.StatusForbidden)
+			return
+		}
+
+		eventID, err := db.RedeemJoinLink(ctx, r.PathValue("token"), userID, now())
+		if err != nil {
+			if store.IsInvalidJoinLinkError(err) {
+				http.Error(w, "Invalid or expired join link", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error joining event", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(redeemJoinLinkResponse{EventID: eventID})
+	}
+}
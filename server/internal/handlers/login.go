@@ -1,20 +1,145 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/epot/gifterv2/internal/loginlimit"
 	"github.com/epot/gifterv2/internal/store"
-	"github.com/markbates/goth/gothic"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// reasons of failed logins in the audit
+const (
+	invalidCredentialsReason  = "invalid_credentials"
+	invalidSecondFactorReason = "invalid_second_factor"
+	throttledReason           = "throttled"
+)
+
+// clientIP returns the IP address of the client of r. Behind a proxy, the
+// router is expected to have resolved it from the forwarding headers.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func accountLimitKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLimitKey(ip string) string {
+	return "ip:" + ip
+}
+
+// allowLogin checks every key and counts the attempt against all of them, or
+// none if any of them must wait. It returns the longest wait.
+func allowLogin(ctx context.Context, limiter loginlimit.Limiter, keys ...string) (time.Duration, error) {
+	var (
+		longest time.Duration
+		allowed []string
+	)
+	for _, key := range keys {
+		wait, err := limiter.Allow(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if wait > 0 {
+			longest = max(longest, wait)
+		} else {
+			allowed = append(allowed, key)
+		}
+	}
+	if longest > 0 {
+		// throttled attempts must not count, take back the others
+		succeedLogin(ctx, limiter, allowed...)
+	}
+	return longest, nil
+}
+
+// succeedLogin takes back the attempt allowLogin counted against every key.
+func succeedLogin(ctx context.Context, limiter loginlimit.Limiter, keys ...string) {
+	for _, key := range keys {
+		if err := limiter.Succeed(ctx, key); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// recordFailedLogin audits a failed attempt, already counted by allowLogin.
+// Throttled attempts are only logged, so that they cannot fill the audit.
+func recordFailedLogin(ctx context.Context, db store.Store, attempt store.FailedLogin) {
+	log.Printf("failed login for %q (user %q) from %s: %s", attempt.Email, attempt.UserID, attempt.IP, attempt.Reason)
+
+	if attempt.Reason == throttledReason {
+		return
+	}
+	if err := db.RecordFailedLogin(ctx, attempt); err != nil {
+		log.Println(err)
+	}
+}
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+}
+
+func passwordLimitKey(userID string) string {
+	return "password:" + userID
+}
+
+// checkPassword tells whether password is the password of the logged in user,
+// throttling wrong guesses like logins, so that a stolen session cannot be
+// used to find the password. Otherwise, it writes the error response and
+// returns false.
+func checkPassword(w http.ResponseWriter, r *http.Request, db store.Store, limiter loginlimit.Limiter, userID string, password string) bool {
+	var (
+		ctx = r.Context()
+		key = passwordLimitKey(userID)
+	)
+
+	wait, err := allowLogin(ctx, limiter, key)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println(err)
+		return false
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return false
+	}
+
+	validPassword, err := db.CheckPassword(ctx, userID, password)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println(err)
+		return false
+	}
+	if !validPassword {
+		http.Error(w, "Invalid password", http.StatusForbidden)
+		return false
+	}
+
+	if err := limiter.Reset(ctx, key); err != nil {
+		log.Println(err)
+	}
+	return true
+}
+
 type loginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-func LoginHandler(db store.Store) http.HandlerFunc {
+func LoginHandler(db store.Store, limiter loginlimit.Limiter, now func() time.Time) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 
@@ -26,8 +151,28 @@ func LoginHandler(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		// Save user to the database
-		ctx := r.Context()
+		var (
+			ctx        = r.Context()
+			ip         = clientIP(r)
+			accountKey = accountLimitKey(req.Email)
+			attempt    = store.FailedLogin{Email: req.Email, IP: ip}
+		)
+
+		// Checked before the password, so that throttled attempts do not
+		// cost a bcrypt comparison
+		wait, err := allowLogin(ctx, limiter, ipLimitKey(ip), accountKey)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if wait > 0 {
+			attempt.Reason = throttledReason
+			recordFailedLogin(ctx, db, attempt)
+			tooManyAttempts(w, wait)
+			return
+		}
+
 		userID, err := db.Login(ctx, req.Email, req.Password)
 		if err != nil {
 			http.Error(w, "Database error", http.StatusInternalServerError)
@@ -35,12 +180,37 @@ func LoginHandler(db store.Store) http.HandlerFunc {
 			return
 		}
 		if userID == "" {
+			attempt.Reason = invalidCredentialsReason
+			recordFailedLogin(ctx, db, attempt)
 			http.Error(w, "Unknown email or password", http.StatusNotFound)
 			return
 		}
 
+		succeedLogin(ctx, limiter, ipLimitKey(ip))
+		if err := limiter.Reset(ctx, accountKey); err != nil {
+			log.Println(err)
+		}
+
+		twoFactor, err := db.GetTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if twoFactor != nil && twoFactor.Enabled {
+			// The session is only issued once the second factor is checked
+			err = startTwoFactorLogin(w, r, userID, now())
+			if err != nil {
+				http.Error(w, "Failed to save session", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(twoFactorRequiredResponse{TwoFactorRequired: true})
+			return
+		}
+
 		// Save user ID in the session
-		err = gothic.StoreInSession("user_id", userID, r, w)
+		err = startSession(r.Context(), w, r, db, userID, now())
 		if err != nil {
 			http.Error(w, "Failed to save session", http.StatusInternalServerError)
 			log.Println(err)
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+type updateGiftPurchaseRequest struct {
+	PurchasedAt    *time.Time `json:"purchased_at"`
+	Store          string     `json:"store"`
+	OrderReference string     `json:"order_reference"`
+	Carrier        string     `json:"carrier"`
+	TrackingNumber string     `json:"tracking_number"`
+	TrackingURL    string     `json:"tracking_url"`
+	Delivered      bool       `json:"delivered"`
+}
+
+// UpdateGiftPurchase records where the user bought a gift and how it is
+// delivered. Only the buyer of a bought gift can track it.
+func UpdateGiftPurchase(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req updateGiftPurchaseRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		purchase := store.GiftPurchase{
+			PurchasedAt:    req.PurchasedAt,
+			Store:          strings.TrimSpace(req.Store),
+			OrderReference: strings.TrimSpace(req.OrderReference),
+			Carrier:        strings.TrimSpace(req.Carrier),
+			TrackingNumber: strings.TrimSpace(req.TrackingNumber),
+		}
+		if req.TrackingURL != "" {
+			urls, err := validateGiftURLs([]string{req.TrackingURL})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(urls) > 0 {
+				purchase.TrackingURL = urls[0]
+			}
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		gift := getGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+
+		if req.Delivered {
+			// keep when it was first marked delivered
+			if gift.Content.Purchase != nil && gift.Content.Purchase.DeliveredAt != nil {
+				purchase.DeliveredAt = gift.Content.Purchase.DeliveredAt
+			} else {
+				deliveredAt := now().UTC()
+				purchase.DeliveredAt = &deliveredAt
+			}
+		}
+
+		updated, err := db.UpdateGiftPurchase(ctx, userID, giftID, eventID, purchase)
+		if err != nil {
+			http.Error(w, "Error updating purchase", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !updated {
+			http.Error(w, "You can only track the gifts you bought", http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(purchase)
+	}
+}
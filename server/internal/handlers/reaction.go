@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+// AllowedReactions are the emojis users react with.
+var AllowedReactions = []string{"👍", "❤️", "😂", "🎉", "😮", "🤔"}
+
+// toggleReactionRequest toggles either a vote, 1 or -1, or a reaction.
+type toggleReactionRequest struct {
+	Vote  int    `json:"vote"`
+	Emoji string `json:"emoji"`
+}
+
+// decodeToggleReactionRequest decodes and validates the request. Otherwise,
+// it writes the error response and returns false.
+func decodeToggleReactionRequest(w http.ResponseWriter, r *http.Request) (toggleReactionRequest, bool) {
+	var req toggleReactionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		log.Println(err)
+		return req, false
+	}
+
+	if (req.Vote == 0) == (req.Emoji == "") {
+		http.Error(w, "Either a vote or an emoji is required", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Vote != 0 && req.Vote != 1 && req.Vote != -1 {
+		http.Error(w, "Vote must be 1 or -1", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Emoji != "" && !slices.Contains(AllowedReactions, req.Emoji) {
+		http.Error(w, "Invalid emoji", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// toggleReaction applies the request to the target and responds with its
+// votes and reactions.
+func toggleReaction(ctx context.Context, w http.ResponseWriter, db store.Store, target store.ReactionTarget, targetID string, userID string, req toggleReactionRequest, now time.Time) {
+	var err error
+	if req.Vote != 0 {
+		_, err = db.ToggleVote(ctx, target, targetID, userID, req.Vote, now)
+	} else {
+		_, err = db.ToggleReaction(ctx, target, targetID, userID, req.Emoji, now)
+	}
+	if err != nil {
+		http.Error(w, "Error reacting", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	summary, err := db.GetReactionSummary(ctx, target, targetID, userID)
+	if err != nil {
+		http.Error(w, "Error reacting", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(summary)
+}
+
+// getReactableGift returns the gift of the event the user can vote and react
+// on. Otherwise, it writes the error response and returns nil.
+func getReactableGift(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, giftID string) *store.Gift {
+	hasAccess, err := checkIfUserHasAccessToEvents(r.Context(), db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	gift := getGift(w, r, db, userID, eventID, giftID)
+	if gift == nil {
+		return nil
+	}
+	if gift.Content.Status == store.MarkedForDeletionGiftStatus {
+		http.Error(w, "Gift not found", http.StatusNotFound)
+		return nil
+	}
+	return gift
+}
+
+// ToggleGiftReaction toggles the vote or the reaction of the user on a gift.
+// The recipient of the gift cannot vote nor react on it.
+func ToggleGiftReaction(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeToggleReactionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+		)
+
+		gift := getReactableGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		if gift.Content.ToID == userID {
+			http.Error(w, "You cannot vote on your own gifts", http.StatusForbidden)
+			return
+		}
+
+		toggleReaction(r.Context(), w, db, store.GiftReactionTarget, giftID, userID, req, now())
+	}
+}
+
+// ToggleCommentReaction toggles the vote or the reaction of the user on a
+// comment of a gift. The recipient of a secret gift does not see its comments,
+// so they cannot react on them either.
+func ToggleCommentReaction(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeToggleReactionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var (
+			eventID   = r.PathValue("event_id")
+			giftID    = r.PathValue("gift_id")
+			commentID = r.PathValue("comment_id")
+			ctx       = r.Context()
+		)
+
+		gift := getReactableGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		if gift.Content.Secret && gift.Content.ToID == userID {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		comments, err := db.ListComments(ctx, giftID)
+		if err != nil {
+			http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !slices.ContainsFunc(comments, func(comment store.Comment) bool { return comment.ID == commentID }) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		toggleReaction(ctx, w, db, store.CommentReactionTarget, commentID, userID, req, now())
+	}
+}
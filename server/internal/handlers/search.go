@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+const (
+	// MaxSearchResults is the maximum number of gifts returned by a search.
+	MaxSearchResults = 50
+	// MaxSearchQueryLength is the maximum length of a search query, in
+	// characters.
+	MaxSearchQueryLength = 200
+)
+
+// SearchResult is a gift matching a search. The highlights are HTML, with the
+// matched words wrapped in <mark> tags.
+type SearchResult struct {
+	Gift             Gift     `json:"gift"`
+	EventName        string   `json:"event_name"`
+	NameHighlight    string   `json:"name_highlight"`
+	MatchedURLs      []string `json:"matched_urls"`
+	CommentHighlight string   `json:"comment_highlight,omitempty"`
+}
+
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+}
+
+// Search looks for gifts by name, URL or comments across the events of the
+// user. The gifts are masked like in the gift lists of their events, and the
+// surprises of the user never match.
+func Search(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Query is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(query) > MaxSearchQueryLength {
+			http.Error(w, "Query is too long", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+
+		matches, err := db.SearchGifts(ctx, userID, query, MaxSearchResults)
+		if err != nil {
+			http.Error(w, "Error searching gifts", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		// the store already leaves them out, never risk spoiling one
+		matches = slices.DeleteFunc(matches, func(match store.GiftSearchResult) bool {
+			return (match.Gift.Content.Secret && match.Gift.Content.ToID == userID) || isHiddenFrom(userID, match.Gift)
+		})
+		gifts := make([]store.Gift, 0, len(matches))
+		for _, match := range matches {
+			gifts = append(gifts, match.Gift)
+		}
+		summaries, err := giftReactionSummaries(ctx, db, userID, gifts)
+		if err != nil {
+			http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+			log.Println("Error converting gift:", err)
+			return
+		}
+
+		results := make([]SearchResult, 0, len(matches))
+		for _, match := range matches {
+			g, err := storeGiftToGift(ctx, db, userID, match.EventType, match.Gift, summaries)
+			if err != nil {
+				http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+				log.Println("Error converting gift:", err)
+				return
+			}
+			result := SearchResult{
+				Gift:          g,
+				EventName:     match.EventName,
+				NameHighlight: match.NameHighlight,
+				MatchedURLs:   match.MatchedURLs,
+			}
+			if match.CommentHighlight != nil && match.Gift.Content.ToID != userID {
+				result.CommentHighlight = *match.CommentHighlight
+			}
+			results = append(results, result)
+		}
+
+		_ = json.NewEncoder(w).Encode(SearchResults{Results: results})
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/epot/gifterv2/internal/middleware"
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+// RecentLoginMaxAge is how long after logging in users without a password
+// may change their email.
+const RecentLoginMaxAge = 10 * time.Minute
+
+// startSession logs userID in. The session ends when the session version of
+// the user changes.
+func startSession(ctx context.Context, w http.ResponseWriter, r *http.Request, db store.Store, userID string, now time.Time) error {
+	version, _, err := db.GetSessionVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := middleware.SaveLogin(w, r, userID, version, now); err != nil {
+		return err
+	}
+	return gothic.StoreInSession("user_id", userID, r, w)
+}
+
+// keepSession keeps the session of userID going after their session version
+// changed, e.g. when they changed their password from it.
+func keepSession(ctx context.Context, w http.ResponseWriter, r *http.Request, db store.Store, userID string) error {
+	version, _, err := db.GetSessionVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return middleware.SaveLogin(w, r, userID, version, middleware.LoggedInAt(r, userID))
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+type ShoppingListRecipient struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Gifts []Gift `json:"gifts"`
+}
+
+type ShoppingListEvent struct {
+	ID         string                  `json:"id"`
+	Name       string                  `json:"name"`
+	Date       time.Time               `json:"date"`
+	Recipients []ShoppingListRecipient `json:"recipients"`
+}
+
+type ShoppingList struct {
+	Events []ShoppingListEvent `json:"events"`
+}
+
+type markGiftsBoughtRequest struct {
+	GiftIDs       []string                    `json:"gift_ids"`
+	WishlistItems []store.WishlistReservation `json:"wishlist_items"`
+}
+
+type markGiftsBoughtResponse struct {
+	GiftIDs       []string                    `json:"gift_ids"`
+	WishlistItems []store.WishlistReservation `json:"wishlist_items"`
+}
+
+// GetShoppingList lists the gifts and wishlist items the user reserved or
+// bought across all events, grouped by event and recipient.
+func GetShoppingList(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+
+		gifts, err := db.ListShoppingList(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching shopping list", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		var storeGifts []store.Gift
+		for _, gift := range gifts {
+			if !gift.WishlistItem {
+				storeGifts = append(storeGifts, gift.Gift)
+			}
+		}
+		summaries, err := giftReactionSummaries(ctx, db, userID, storeGifts)
+		if err != nil {
+			http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+			log.Println("Error converting gift:", err)
+			return
+		}
+
+		// the gifts come sorted by event then recipient
+		list := ShoppingList{Events: []ShoppingListEvent{}}
+		for _, gift := range gifts {
+			var g Gift
+			if gift.WishlistItem {
+				g, err = wishlistItemToGift(ctx, db, gift.EventID, store.EventWishlistItem{
+					WishlistItem: store.WishlistItem{
+						ID:        gift.ID,
+						UserID:    gift.Content.ToID,
+						Name:      gift.Content.Name,
+						URLs:      gift.Content.URLs,
+						CreatedAt: gift.CreatedAt,
+					},
+					Status:  gift.Content.Status,
+					BuyerID: gift.Content.FromID,
+				})
+			} else {
+				g, err = storeGiftToGift(ctx, db, userID, gift.EventType, gift.Gift, summaries)
+			}
+			if err != nil {
+				http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+				log.Println("Error converting gift:", err)
+				return
+			}
+
+			if len(list.Events) == 0 || list.Events[len(list.Events)-1].ID != gift.EventID {
+				list.Events = append(list.Events, ShoppingListEvent{
+					ID:   gift.EventID,
+					Name: gift.EventName,
+					Date: gift.EventDate,
+				})
+			}
+			event := &list.Events[len(list.Events)-1]
+			if len(event.Recipients) == 0 || event.Recipients[len(event.Recipients)-1].ID != gift.Content.ToID {
+				event.Recipients = append(event.Recipients, ShoppingListRecipient{
+					ID:   gift.Content.ToID,
+					Name: g.ToName,
+				})
+			}
+			recipient := &event.Recipients[len(event.Recipients)-1]
+			recipient.Gifts = append(recipient.Gifts, g)
+		}
+
+		_ = json.NewEncoder(w).Encode(list)
+	}
+}
+
+// MarkGiftsBought marks gifts and wishlist items the user reserved as bought,
+// at once. It responds with the gifts and wishlist items it marked, the
+// others being not reserved by the user.
+func MarkGiftsBought(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req markGiftsBoughtRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		if len(req.GiftIDs) == 0 && len(req.WishlistItems) == 0 {
+			http.Error(w, "Gift IDs or wishlist items are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		var resp markGiftsBoughtResponse
+		err = db.WithTx(ctx, func(tx store.Store) error {
+			var err error
+			if len(req.GiftIDs) > 0 {
+				resp.GiftIDs, err = tx.MarkGiftsBought(ctx, userID, req.GiftIDs)
+				if err != nil {
+					return err
+				}
+			}
+			if len(req.WishlistItems) > 0 {
+				resp.WishlistItems, err = tx.MarkWishlistItemsBought(ctx, userID, req.WishlistItems)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, "Error updating gifts", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if resp.GiftIDs == nil {
+			resp.GiftIDs = []string{}
+		}
+		if resp.WishlistItems == nil {
+			resp.WishlistItems = []store.WishlistReservation{}
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/epot/gifterv2/internal/mailer"
 	"github.com/epot/gifterv2/internal/store"
-	"github.com/markbates/goth/gothic"
+	"github.com/epot/gifterv2/internal/token"
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 type signupRequest struct {
@@ -15,7 +17,7 @@ type signupRequest struct {
 	Password string `json:"password"`
 }
 
-func SignupHandler(db store.Store) http.HandlerFunc {
+func SignupHandler(db store.Store, m mailer.Mailer, signer *token.Signer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 
@@ -40,8 +42,15 @@ func SignupHandler(db store.Store) http.HandlerFunc {
 			return
 		}
 
+		// The account is usable right away, but other users cannot add it
+		// to their events until the email is verified
+		err = sendVerificationEmail(ctx, m, signer, userID, req.Email)
+		if err != nil {
+			log.Println(err)
+		}
+
 		// Save user ID in the session
-		err = gothic.StoreInSession("user_id", userID, r, w)
+		err = startSession(r.Context(), w, r, db, userID, time.Now())
 		if err != nil {
 			http.Error(w, "Failed to save session", http.StatusInternalServerError)
 			log.Println(err)
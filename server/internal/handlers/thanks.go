@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/epot/gifterv2/internal/mailer"
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+// MaxThankYouNoteLength is the maximum length of a thank-you note, in
+// characters.
+const MaxThankYouNoteLength = 2000
+
+// ReceivedGift is a gift the user received, unmasked now that the event is
+// over.
+type ReceivedGift struct {
+	Gift
+	ThankYouNote *store.ThankYouNote `json:"thank_you_note,omitempty"`
+}
+
+type ReceivedGifts struct {
+	Gifts []ReceivedGift `json:"gifts"`
+}
+
+type sendThankYouNoteRequest struct {
+	Message string `json:"message"`
+}
+
+// isGiven tells whether somebody bought gift, and so gave it. A reserved gift
+// may still not be bought.
+func isGiven(gift store.Gift) bool {
+	return gift.Content.FromID != nil && gift.Content.Status == store.BoughtGiftStatus
+}
+
+// decodeThankYouNote decodes and validates the message of a thank-you note.
+// Otherwise, it writes the error response and returns false.
+func decodeThankYouNote(w http.ResponseWriter, r *http.Request) (string, bool) {
+	decoder := json.NewDecoder(r.Body)
+	var req sendThankYouNoteRequest
+	err := decoder.Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		log.Println(err)
+		return "", false
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		http.Error(w, "Message is required", http.StatusBadRequest)
+		return "", false
+	}
+	if utf8.RuneCountInString(message) > MaxThankYouNoteLength {
+		http.Error(w, "Message is too long", http.StatusBadRequest)
+		return "", false
+	}
+	return message, true
+}
+
+// getOverEvent returns the event the user participates in if its date is
+// past. Otherwise, it writes the error response and returns nil.
+func getOverEvent(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, now time.Time) *store.Event {
+	ctx := r.Context()
+
+	hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil || event == nil {
+		http.Error(w, "Error fetching event", http.StatusInternalServerError)
+		return nil
+	}
+	if !now.After(event.Date) {
+		http.Error(w, "Gifts are revealed once the event is over", http.StatusForbidden)
+		return nil
+	}
+	return event
+}
+
+// GetReceivedGifts lists the gifts the user received in an event and who
+// gave them, once the event is over. They include the items of their wishlist
+// bought in the event.
+func GetReceivedGifts(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		event := getOverEvent(w, r, db, userID, eventID, now())
+		if event == nil {
+			return
+		}
+
+		// only the bought gifts addressed to the user, ideas do not exist
+		// for them
+		bought := store.GiftStatus(store.BoughtGiftStatus)
+		gifts, _, err := db.QueryGifts(ctx, eventID, store.GiftQuery{ViewerID: userID, RecipientID: userID, Status: &bought})
+		if err != nil {
+			http.Error(w, "Error fetching gifts", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		received := ReceivedGifts{Gifts: []ReceivedGift{}}
+		for _, gift := range gifts {
+			if !isGiven(gift) {
+				continue
+			}
+			// converted as seen by somebody else, the surprise is over
+			g, err := StoreGiftToGift(ctx, db, "", event.Type, gift)
+			if err != nil {
+				http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+				log.Println("Error converting gift:", err)
+				return
+			}
+			note, err := db.GetThankYouNote(ctx, gift.ID)
+			if err != nil {
+				http.Error(w, "Error fetching thank-you notes", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			received.Gifts = append(received.Gifts, ReceivedGift{Gift: g, ThankYouNote: note})
+		}
+
+		items, err := listEventWishlistItems(ctx, db, *event)
+		if err != nil {
+			http.Error(w, "Error fetching wishlists", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		for _, item := range items {
+			if item.UserID != userID || item.BuyerID == nil || item.Status != store.BoughtGiftStatus {
+				continue
+			}
+			g, err := wishlistItemToGift(ctx, db, eventID, item)
+			if err != nil {
+				http.Error(w, "Error processing wishlists", http.StatusInternalServerError)
+				log.Println("Error converting wishlist item:", err)
+				return
+			}
+			note, err := db.GetWishlistThankYouNote(ctx, eventID, item.ID)
+			if err != nil {
+				http.Error(w, "Error fetching thank-you notes", http.StatusInternalServerError)
+				log.Println(err)
+				return
+			}
+			received.Gifts = append(received.Gifts, ReceivedGift{Gift: g, ThankYouNote: note})
+		}
+
+		_ = json.NewEncoder(w).Encode(received)
+	}
+}
+
+// SendThankYouNote writes the thank-you note of the recipient of a gift to
+// its giver, once the event is over, and emails it to them.
+func SendThankYouNote(db store.Store, m mailer.Mailer, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		message, ok := decodeThankYouNote(w, r)
+		if !ok {
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		event := getOverEvent(w, r, db, userID, eventID, now())
+		if event == nil {
+			return
+		}
+
+		gift := getGift(w, r, db, userID, eventID, giftID)
+		if gift == nil {
+			return
+		}
+		if gift.Content.Status == store.MarkedForDeletionGiftStatus {
+			http.Error(w, "Gift not found", http.StatusNotFound)
+			return
+		}
+		if gift.Content.ToID != userID {
+			http.Error(w, "You can only thank for the gifts you received", http.StatusForbidden)
+			return
+		}
+		if !isGiven(*gift) {
+			http.Error(w, "Nobody gave this gift", http.StatusBadRequest)
+			return
+		}
+
+		err = db.SetThankYouNote(ctx, userID, giftID, message, now())
+		if err != nil {
+			http.Error(w, "Error sending thank-you note", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		// the note is saved, failing to email it must not undo it
+		if err := notifyGiftGiver(ctx, db, m, *event, *gift.Content.FromID, userID, gift.Content.Name, message); err != nil {
+			log.Println("Error notifying giver:", err)
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// SendWishlistThankYouNote writes the thank-you note of the owner of a
+// wishlist item bought in an event to its buyer, once the event is over, and
+// emails it to them.
+func SendWishlistThankYouNote(db store.Store, m mailer.Mailer, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		message, ok := decodeThankYouNote(w, r)
+		if !ok {
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			itemID  = r.PathValue("item_id")
+			ctx     = r.Context()
+		)
+
+		event := getOverEvent(w, r, db, userID, eventID, now())
+		if event == nil {
+			return
+		}
+
+		items, err := listEventWishlistItems(ctx, db, *event)
+		if err != nil {
+			http.Error(w, "Error fetching wishlists", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		var found *store.EventWishlistItem
+		for _, item := range items {
+			if item.ID == itemID {
+				found = &item
+				break
+			}
+		}
+		if found == nil {
+			http.Error(w, "Wishlist item not found", http.StatusNotFound)
+			return
+		}
+		if found.UserID != userID {
+			http.Error(w, "You can only thank for the gifts you received", http.StatusForbidden)
+			return
+		}
+		if found.BuyerID == nil || found.Status != store.BoughtGiftStatus {
+			http.Error(w, "Nobody gave this gift", http.StatusBadRequest)
+			return
+		}
+
+		set, err := db.SetWishlistThankYouNote(ctx, userID, eventID, itemID, message, now())
+		if err != nil {
+			http.Error(w, "Error sending thank-you note", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		// released meanwhile
+		if !set {
+			http.Error(w, "Nobody gave this gift", http.StatusBadRequest)
+			return
+		}
+
+		// the note is saved, failing to email it must not undo it
+		if err := notifyGiftGiver(ctx, db, m, *event, *found.BuyerID, userID, found.Name, message); err != nil {
+			log.Println("Error notifying giver:", err)
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// notifyGiftGiver emails the thank-you note of recipientID for the gift
+// named giftName to its giver.
+func notifyGiftGiver(ctx context.Context, db store.Store, m mailer.Mailer, event store.Event, giverID string, recipientID string, giftName string, message string) error {
+	giver, err := db.GetUserByID(ctx, giverID)
+	if err != nil {
+		return fmt.Errorf("failed to get giver: %w", err)
+	}
+	if giver == nil {
+		return nil
+	}
+	recipient, err := db.GetUserByID(ctx, recipientID)
+	if err != nil {
+		return fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if recipient == nil {
+		return nil
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      giver.Email,
+		Subject: fmt.Sprintf("%s thanks you for your gift on Gifter", recipient.Name),
+		Body:    fmt.Sprintf("%s wrote about \"%s\" of the event \"%s\":\n\n%s", recipient.Name, giftName, event.Name, message),
+	})
+}
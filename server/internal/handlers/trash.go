@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+// GiftRetention is how long deleted gifts stay in the trash of their event,
+// where they can be restored, before being purged.
+const GiftRetention = 30 * 24 * time.Hour
+
+type TrashedGift struct {
+	Gift
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type TrashedGifts struct {
+	Gifts []TrashedGift `json:"gifts"`
+}
+
+// canSeeTrashedGift tells whether userID may see a gift in the trash: not if
+// somebody else offered it to them, the surprise must hold even once deleted.
+func canSeeTrashedGift(userID string, gift store.Gift) bool {
+	return gift.Content.ToID != userID || gift.CreatorID == userID
+}
+
+// getTrashedGift returns the gift of the event in the trash since since, if
+// userID can see it. Otherwise, it writes the error response and returns nil.
+func getTrashedGift(w http.ResponseWriter, r *http.Request, db store.Store, userID string, eventID string, giftID string, since time.Time) *store.Gift {
+	ctx := r.Context()
+
+	hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+	if err != nil {
+		http.Error(w, "Error checking event access", http.StatusInternalServerError)
+		return nil
+	}
+	if !hasAccess {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return nil
+	}
+
+	gifts, err := db.ListTrashedGifts(ctx, eventID, since)
+	if err != nil {
+		http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+		log.Println(err)
+		return nil
+	}
+	for _, gift := range gifts {
+		if gift.ID == giftID && canSeeTrashedGift(userID, gift) {
+			return &gift
+		}
+	}
+
+	http.Error(w, "Gift not found in the trash", http.StatusNotFound)
+	return nil
+}
+
+// GetTrashedGifts lists the gifts of an event that can still be restored.
+func GetTrashedGifts(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		gifts, err := db.ListTrashedGifts(ctx, eventID, now().Add(-GiftRetention))
+		if err != nil {
+			http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		gifts = slices.DeleteFunc(gifts, func(gift store.Gift) bool {
+			return !canSeeTrashedGift(userID, gift)
+		})
+		converted, err := StoreGiftsToGifts(ctx, db, userID, event.Type, gifts)
+		if err != nil {
+			http.Error(w, "Error processing gifts", http.StatusInternalServerError)
+			log.Println("Error converting gift:", err)
+			return
+		}
+
+		result := make([]TrashedGift, 0, len(gifts))
+		for i, gift := range gifts {
+			result = append(result, TrashedGift{
+				Gift:      converted[i],
+				DeletedAt: *gift.DeletedAt,
+				PurgeAt:   gift.DeletedAt.Add(GiftRetention),
+			})
+		}
+
+		_ = json.NewEncoder(w).Encode(TrashedGifts{Gifts: result})
+	}
+}
+
+// RestoreGift takes a gift out of the trash, available again, provided its
+// recipient can still receive gifts in the event.
+func RestoreGift(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+			since   = now().Add(-GiftRetention)
+		)
+
+		gift := getTrashedGift(w, r, db, userID, eventID, giftID, since)
+		if gift == nil {
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+		canReceive, err := canReceiveGifts(ctx, db, *event, gift.Content.ToID)
+		if err != nil {
+			http.Error(w, "Error checking recipient", http.StatusInternalServerError)
+			return
+		}
+		if !canReceive {
+			http.Error(w, "The recipient of this gift cannot receive gifts in this event anymore", http.StatusBadRequest)
+			return
+		}
+
+		restored, err := db.RestoreGift(ctx, giftID, eventID, since)
+		if err != nil {
+			http.Error(w, "Error restoring gift", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !restored {
+			http.Error(w, "Gift not found in the trash", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// DeleteTrashedGift permanently deletes a gift in the trash, before it is
+// purged. Only the creator of the gift or the owners of the event can do this.
+func DeleteTrashedGift(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			giftID  = r.PathValue("gift_id")
+			ctx     = r.Context()
+		)
+
+		// expired gifts not purged yet can be deleted as well
+		gift := getTrashedGift(w, r, db, userID, eventID, giftID, time.Time{})
+		if gift == nil {
+			return
+		}
+
+		if gift.CreatorID != userID {
+			event, err := db.GetEvent(ctx, eventID)
+			if err != nil || event == nil {
+				http.Error(w, "Error fetching event", http.StatusInternalServerError)
+				return
+			}
+			isOwner, err := isEventOwner(ctx, db, event, userID)
+			if err != nil {
+				http.Error(w, "Error checking event access", http.StatusInternalServerError)
+				return
+			}
+			if !isOwner {
+				http.Error(w, "Only the creator of the gift or the owners of the event can delete it permanently", http.StatusForbidden)
+				return
+			}
+		}
+
+		deleted, err := db.DeleteTrashedGift(ctx, giftID, eventID)
+		if err != nil {
+			http.Error(w, "Error deleting gift", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Gift not found in the trash", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/epot/gifterv2/internal/loginlimit"
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/epot/gifterv2/internal/totp"
+	"github.com/markbates/goth/gothic"
+)
+
+const (
+	totpIssuer        = "Gifter"
+	recoveryCodeCount = 10
+
+	// twoFactorSessionName is the session holding a login waiting for its
+	// second factor. The user is only logged in once it is completed.
+	twoFactorSessionName = "_gifter_2fa"
+	twoFactorLoginMaxAge = 5 * time.Minute
+)
+
+func twoFactorLimitKey(userID string) string {
+	return "2fa:" + userID
+}
+
+type twoFactorRequiredResponse struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+}
+
+// startTwoFactorLogin remembers that userID passed the password check and
+// must now provide a second factor.
+func startTwoFactorLogin(w http.ResponseWriter, r *http.Request, userID string, now time.Time) error {
+	session, _ := gothic.Store.Get(r, twoFactorSessionName)
+	session.Values["user_id"] = userID
+	session.Values["started_at"] = now.Unix()
+	session.Options.MaxAge = int(twoFactorLoginMaxAge / time.Second)
+	return session.Save(r, w)
+}
+
+// pendingTwoFactorLogin returns the user waiting for their second factor, or
+// an empty string if there is none or it expired.
+func pendingTwoFactorLogin(r *http.Request, now time.Time) string {
+	session, err := gothic.Store.Get(r, twoFactorSessionName)
+	if err != nil {
+		return ""
+	}
+	userID, _ := session.Values["user_id"].(string)
+	startedAt, _ := session.Values["started_at"].(int64)
+	if userID == "" || now.Sub(time.Unix(startedAt, 0)) > twoFactorLoginMaxAge {
+		return ""
+	}
+	return userID
+}
+
+func clearTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	session, err := gothic.Store.Get(r, twoFactorSessionName)
+	if err != nil {
+		return
+	}
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		log.Println(err)
+	}
+}
+
+// verifySecondFactor checks either a TOTP code or a recovery code of the user,
+// consuming it so it cannot be used twice.
+func verifySecondFactor(ctx context.Context, db store.Store, userID string, secret string, code string, recoveryCode string, now time.Time) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(secret, code, now)
+		if !ok {
+			return false, nil
+		}
+		return db.UseTOTPStep(ctx, userID, step)
+	}
+	if recoveryCode != "" {
+		return db.UseRecoveryCode(ctx, userID, totp.HashRecoveryCode(recoveryCode))
+	}
+	return false, nil
+}
+
+type twoFactorLoginRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorLoginHandler completes a password login of a user with two factor
+// authentication enabled.
+func TwoFactorLoginHandler(db store.Store, limiter loginlimit.Limiter, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := pendingTwoFactorLogin(r, now())
+		if userID == "" {
+			http.Error(w, "Login expired", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			ctx        = r.Context()
+			ip         = clientIP(r)
+			accountKey = twoFactorLimitKey(userID)
+			attempt    = store.FailedLogin{UserID: userID, IP: ip}
+		)
+
+		wait, err := allowLogin(ctx, limiter, ipLimitKey(ip), accountKey)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if wait > 0 {
+			attempt.Reason = throttledReason
+			recordFailedLogin(ctx, db, attempt)
+			tooManyAttempts(w, wait)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req twoFactorLoginRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		twoFactor, err := db.GetTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if twoFactor == nil || !twoFactor.Enabled {
+			http.Error(w, "Login expired", http.StatusUnauthorized)
+			return
+		}
+
+		valid, err := verifySecondFactor(ctx, db, userID, twoFactor.Secret, req.Code, req.RecoveryCode, now())
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !valid {
+			attempt.Reason = invalidSecondFactorReason
+			recordFailedLogin(ctx, db, attempt)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		succeedLogin(ctx, limiter, ipLimitKey(ip))
+		if err := limiter.Reset(ctx, accountKey); err != nil {
+			log.Println(err)
+		}
+		clearTwoFactorLogin(w, r)
+
+		// Save user ID in the session
+		err = startSession(r.Context(), w, r, db, userID, now())
+		if err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		// Redirect to the secure area
+		redirectSecure := os.Getenv("REDIRECT_SECURE")
+		if redirectSecure == "" {
+			redirectSecure = "http://localhost:5173/events"
+		}
+
+		http.Redirect(w, r, redirectSecure, http.StatusFound)
+	}
+}
+
+type enrollTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+type enrollTwoFactorResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollTwoFactor starts the two factor enrollment of a password account. The
+// returned secret is only enabled once a code is confirmed.
+func EnrollTwoFactor(db store.Store, limiter loginlimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req enrollTwoFactorRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		ctx := r.Context()
+		if !checkPassword(w, r, db, limiter, userID, req.Password) {
+			return
+		}
+
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil || user == nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		if user.TwoFactorEnabled {
+			http.Error(w, "Two factor authentication is already enabled", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := newTwoFactorEnrollment(user.Email)
+		if err != nil {
+			http.Error(w, "Error generating secret", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		hashes := make([]string, 0, len(resp.RecoveryCodes))
+		for _, code := range resp.RecoveryCodes {
+			hashes = append(hashes, totp.HashRecoveryCode(code))
+		}
+
+		err = db.StartTwoFactorEnrollment(ctx, userID, resp.Secret, hashes)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func newTwoFactorEnrollment(email string) (enrollTwoFactorResponse, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return enrollTwoFactorResponse{}, err
+	}
+	recoveryCodes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return enrollTwoFactorResponse{}, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	return enrollTwoFactorResponse{
+		Secret:        secret,
+		OTPAuthURI:    totp.URI(totpIssuer, email, secret),
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+type confirmTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTwoFactor enables two factor authentication once the user proved
+// their authenticator app generates valid codes.
+func ConfirmTwoFactor(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req confirmTwoFactorRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		ctx := r.Context()
+		twoFactor, err := db.GetTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if twoFactor == nil || twoFactor.Secret == "" {
+			http.Error(w, "No two factor enrollment in progress", http.StatusBadRequest)
+			return
+		}
+		if twoFactor.Enabled {
+			http.Error(w, "Two factor authentication is already enabled", http.StatusBadRequest)
+			return
+		}
+
+		valid, err := verifySecondFactor(ctx, db, userID, twoFactor.Secret, req.Code, "", now())
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !valid {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+
+		err = db.EnableTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+type disableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTwoFactor turns two factor authentication off. The user must provide
+// both their password and a current code or a recovery code.
+func DisableTwoFactor(db store.Store, limiter loginlimit.Limiter, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req disableTwoFactorRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		ctx := r.Context()
+		if !checkPassword(w, r, db, limiter, userID, req.Password) {
+			return
+		}
+
+		twoFactor, err := db.GetTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if twoFactor == nil || !twoFactor.Enabled {
+			http.Error(w, "Two factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+
+		valid, err := verifySecondFactor(ctx, db, userID, twoFactor.Secret, req.Code, req.RecoveryCode, now())
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !valid {
+			http.Error(w, "Invalid code", http.StatusForbidden)
+			return
+		}
+
+		err = db.DisableTwoFactor(ctx, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -2,9 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/epot/gifterv2/internal/loginlimit"
+	"github.com/epot/gifterv2/internal/mailer"
+	"github.com/epot/gifterv2/internal/middleware"
 	"github.com/epot/gifterv2/internal/store"
+	"github.com/epot/gifterv2/internal/token"
 	"github.com/markbates/goth/gothic"
 )
 
@@ -33,3 +43,297 @@ func GetUserHandler(db store.Store) http.HandlerFunc {
 		_ = json.NewEncoder(w).Encode(user)
 	}
 }
+
+type updateUserRequest struct {
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+func UpdateUserHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req updateUserRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Picture = strings.TrimSpace(req.Picture)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if req.Picture != "" {
+			pictureURL, err := url.Parse(req.Picture)
+			if err != nil || (pictureURL.Scheme != "https" && pictureURL.Scheme != "http") {
+				http.Error(w, "Picture must be an http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := r.Context()
+		err = db.UpdateUserProfile(ctx, userID, req.Name, req.Picture)
+		if err != nil {
+			http.Error(w, "Error updating user", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func ChangePasswordHandler(db store.Store, limiter loginlimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req changePasswordRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		if req.NewPassword == "" {
+			http.Error(w, "New password is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		if !checkPassword(w, r, db, limiter, userID, req.OldPassword) {
+			return
+		}
+
+		err = db.ChangePassword(ctx, userID, req.NewPassword)
+		if err != nil {
+			http.Error(w, "Error changing password", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		// the other sessions end, this one goes on
+		err = keepSession(ctx, w, r, db, userID)
+		if err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+const changeEmailPurpose = "change_email"
+
+type changeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// ChangeEmailHandler starts an email change. The new email replaces the
+// current one once verified through the link sent to it. Users confirm who
+// they are with their password, or by having logged in recently if they have
+// none.
+func ChangeEmailHandler(db store.Store, m mailer.Mailer, signer *token.Signer, limiter loginlimit.Limiter, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req changeEmailRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+		if err != nil {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.HasPassword {
+			if !checkPassword(w, r, db, limiter, userID, req.Password) {
+				return
+			}
+		} else if now().Sub(middleware.LoggedInAt(r, userID)) > RecentLoginMaxAge {
+			// without a password, only a fresh login proves who asks
+			http.Error(w, "Log in again to change your email", http.StatusForbidden)
+			return
+		}
+
+		err = db.RequestEmailChange(ctx, userID, address.Address)
+		if err != nil {
+			if store.IsEmailAlreadyUsedError(err) {
+				http.Error(w, "Email already used", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		tok, err := signer.Sign(token.Claims{Purpose: changeEmailPurpose, UserID: userID, Value: address.Address}, verifyEmailTTL)
+		if err != nil {
+			http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		err = m.Send(ctx, mailer.Message{
+			To:      address.Address,
+			Subject: "Confirm your new Gifter email",
+			Body:    "Open the following link to use this email for your Gifter account, it is valid for 48 hours:\n\n" + serverURL() + "/auth/verify/email?token=" + url.QueryEscape(tok),
+		})
+		if err != nil {
+			http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// ConfirmEmailChangeHandler switches the user to their new email from the
+// link sent to it.
+func ConfirmEmailChangeHandler(db store.Store, signer *token.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := signer.Verify(changeEmailPurpose, r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		changed, err := db.ConfirmEmailChange(ctx, claims.UserID, claims.Value)
+		if err != nil {
+			if store.IsEmailAlreadyUsedError(err) {
+				http.Error(w, "Email already used", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !changed {
+			// another email change was requested since the link was sent
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		// Redirect to the secure area
+		redirectSecure := os.Getenv("REDIRECT_SECURE")
+		if redirectSecure == "" {
+			redirectSecure = "http://localhost:5173/events"
+		}
+
+		http.Redirect(w, r, redirectSecure, http.StatusFound)
+	}
+}
+
+type deleteUserRequest struct {
+	// Password is required from password accounts.
+	Password string `json:"password"`
+	// ConfirmEmail is required from accounts without a password.
+	ConfirmEmail string `json:"confirm_email"`
+}
+
+// DeleteUserHandler deletes the account of the user, see
+// store.Store.DeleteAccount for what happens to their events and gifts.
+func DeleteUserHandler(db store.Store, limiter loginlimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+
+		var req deleteUserRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		ctx := r.Context()
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.HasPassword {
+			if !checkPassword(w, r, db, limiter, userID, req.Password) {
+				return
+			}
+		} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+			http.Error(w, "Email confirmation does not match", http.StatusForbidden)
+			return
+		}
+
+		err = db.DeleteAccount(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error deleting user", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		err = gothic.Logout(w, r)
+		if err != nil {
+			log.Println(err)
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epot/gifterv2/internal/loginlimit"
+	"github.com/epot/gifterv2/internal/store"
+)
+
+// passwordTestStore only knows the password of its user, any other call
+// panics.
+type passwordTestStore struct {
+	store.Store
+	password string
+}
+
+func (s passwordTestStore) CheckPassword(_ context.Context, _ string, password string) (bool, error) {
+	return password == s.password, nil
+}
+
+func TestChangePasswordThrottlesWrongPasswords(t *testing.T) {
+	db := passwordTestStore{password: "right"}
+	handler := ChangePasswordHandler(db, loginlimit.NewMemory(loginlimit.DefaultPolicy, time.Now))
+	changePassword := func(oldPassword string) *httptest.ResponseRecorder {
+		t.Helper()
+		request := newSessionRequest(t, http.MethodPost, "/api/user/password", "1")
+		request.Body = io.NopCloser(strings.NewReader(`{"old_password": "` + oldPassword + `", "new_password": "new"}`))
+		response := httptest.NewRecorder()
+		handler(response, request)
+		return response
+	}
+
+	for range loginlimit.DefaultPolicy.FreeAttempts + 1 {
+		if response := changePassword("wrong"); response.Code != http.StatusForbidden {
+			t.Fatalf("expected a wrong password to be refused, got %d", response.Code)
+		}
+	}
+	// even the right password must wait now
+	response := changePassword("right")
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the guesses to be throttled, got %d", response.Code)
+	}
+}
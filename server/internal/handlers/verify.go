@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/epot/gifterv2/internal/loginlimit"
+	"github.com/epot/gifterv2/internal/mailer"
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/epot/gifterv2/internal/token"
+	"github.com/markbates/goth/gothic"
+)
+
+const (
+	verifyEmailPurpose = "verify_email"
+	verifyEmailTTL     = 48 * time.Hour
+)
+
+// serverURL returns the public URL of this server, used in links sent by email.
+func serverURL() string {
+	u := os.Getenv("SERVER_URL")
+	if u == "" {
+		u = "http://localhost:8100"
+	}
+	return u
+}
+
+// sendVerificationEmail emails a link proving the user owns email.
+func sendVerificationEmail(ctx context.Context, m mailer.Mailer, signer *token.Signer, userID string, email string) error {
+	tok, err := signer.Sign(token.Claims{Purpose: verifyEmailPurpose, UserID: userID, Value: email}, verifyEmailTTL)
+	if err != nil {
+		return fmt.Errorf("failed to sign verification token: %w", err)
+	}
+
+	link := serverURL() + "/auth/verify?token=" + url.QueryEscape(tok)
+	return m.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Gifter email",
+		Body:    "Open the following link to verify your email, it is valid for 48 hours:\n\n" + link,
+	})
+}
+
+// VerifyEmailHandler marks an email as verified from the link sent to it.
+func VerifyEmailHandler(db store.Store, signer *token.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := signer.Verify(verifyEmailPurpose, r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		verified, err := db.VerifyEmail(ctx, claims.UserID, claims.Value)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !verified {
+			// the email changed since the link was sent
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		// Redirect to the secure area
+		redirectSecure := os.Getenv("REDIRECT_SECURE")
+		if redirectSecure == "" {
+			redirectSecure = "http://localhost:5173/events"
+		}
+
+		http.Redirect(w, r, redirectSecure, http.StatusFound)
+	}
+}
+
+// ResendVerificationEmail sends a new verification link. Sends are counted by
+// the limiter so that the endpoint cannot be used to flood a mailbox.
+func ResendVerificationEmail(db store.Store, m mailer.Mailer, signer *token.Signer, limiter loginlimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		user, err := db.GetUserByID(ctx, userID)
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if user.EmailVerified {
+			http.Error(w, "Email already verified", http.StatusBadRequest)
+			return
+		}
+
+		limitKey := "verify:" + userID
+		// every resend counts, successful or not
+		wait, err := limiter.Allow(ctx, limitKey)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(w, wait)
+			return
+		}
+
+		err = sendVerificationEmail(ctx, m, signer, user.ID, user.Email)
+		if err != nil {
+			http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
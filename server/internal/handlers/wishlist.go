@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/epot/gifterv2/internal/store"
+	"github.com/markbates/goth/gothic"
+)
+
+type Wishlist struct {
+	Items []store.WishlistItem `json:"items"`
+}
+
+// EventWishlistItem is a wishlist item as seen in an event, shaped like a
+// gift addressed to the owner of the wishlist.
+type EventWishlistItem struct {
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	URLs         []string         `json:"urls"`
+	ToID         string           `json:"to_id"`
+	ToName       string           `json:"to_name"`
+	FromName     string           `json:"from_name"`
+	Status       store.GiftStatus `json:"status"`
+	StatusFrozen bool             `json:"status_frozen"`
+}
+
+type EventWishlist struct {
+	Items []EventWishlistItem `json:"items"`
+}
+
+type wishlistItemRequest struct {
+	Name string   `json:"name"`
+	URLs []string `json:"urls"`
+}
+
+type createWishlistItemResponse struct {
+	ID string `json:"id"`
+}
+
+// trimURLs returns urls without surrounding spaces, leaving out empty ones.
+func trimURLs(urls []string) []string {
+	var trimmed []string
+	for _, url := range urls {
+		trimmedURL := strings.TrimSpace(url)
+		if trimmedURL != "" {
+			trimmed = append(trimmed, trimmedURL)
+		}
+	}
+	return trimmed
+}
+
+func GetWishlist(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		items, err := db.ListWishlistItems(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Error fetching wishlist", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(Wishlist{Items: items})
+	}
+}
+
+func CreateWishlistItem(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req wishlistItemRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := db.CreateWishlistItem(r.Context(), userID, req.Name, trimURLs(req.URLs))
+		if err != nil {
+			http.Error(w, "Error creating wishlist item", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(createWishlistItemResponse{ID: itemID})
+	}
+}
+
+func UpdateWishlistItem(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req wishlistItemRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := db.UpdateWishlistItem(r.Context(), userID, r.PathValue("item_id"), req.Name, trimURLs(req.URLs))
+		if err != nil {
+			http.Error(w, "Error updating wishlist item", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !updated {
+			http.Error(w, "Wishlist item not found", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// RelistWishlistItem offers a wishlist item again in the events where it was
+// not bought, once it was bought in one.
+func RelistWishlistItem(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		relisted, err := db.RelistWishlistItem(r.Context(), userID, r.PathValue("item_id"), now())
+		if err != nil {
+			http.Error(w, "Error relisting wishlist item", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !relisted {
+			http.Error(w, "Wishlist item not found", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+func DeleteWishlistItem(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		deleted, err := db.DeleteWishlistItem(r.Context(), userID, r.PathValue("item_id"))
+		if err != nil {
+			http.Error(w, "Error deleting wishlist item", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Wishlist item not found", http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
+
+// listEventWishlistItems returns the wishlist items of the participants who
+// can receive gifts in the event.
+func listEventWishlistItems(ctx context.Context, db store.Store, event store.Event) ([]store.EventWishlistItem, error) {
+	items, err := db.ListEventWishlistItems(ctx, event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []store.EventWishlistItem
+	for _, item := range items {
+		// only participants are listed, any of them receives gifts in events
+		// without honorees
+		if event.Type.HasHonorees() && !event.IsHonoree(item.UserID) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// toEventWishlistItem converts a wishlist item for userID, masking its
+// reservation to its owner like for the gifts addressed to them.
+func toEventWishlistItem(ctx context.Context, db store.Store, userID string, eventType store.EventType, item store.EventWishlistItem, userIDToName map[string]string) (i EventWishlistItem, _ error) {
+	i.ID = item.ID
+	i.Name = item.Name
+	i.URLs = item.URLs
+	i.ToID = item.UserID
+	i.Status = item.Status
+
+	toName, err := db.UserIDToName(ctx, item.UserID, userIDToName)
+	if err != nil {
+		return i, fmt.Errorf("failed to get to name: %w", err)
+	}
+	i.ToName = toName
+	if item.BuyerID != nil {
+		fromName, err := db.UserIDToName(ctx, *item.BuyerID, userIDToName)
+		if err != nil {
+			return i, fmt.Errorf("failed to get from name: %w", err)
+		}
+		i.FromName = fromName
+		i.StatusFrozen = *item.BuyerID != userID
+	}
+
+	if item.UserID == userID {
+		if eventType.HonoreesSeeReservations() {
+			i.FromName = ""
+		} else {
+			i.Status = store.SecretGiftStatus
+		}
+		i.StatusFrozen = true
+	}
+
+	return i, nil
+}
+
+// wishlistItemToGift converts a wishlist item of the event shaped like a gift
+// addressed to its owner, as seen by its buyer. Unlike gifts, it has no
+// reactions.
+func wishlistItemToGift(ctx context.Context, db store.Store, eventID string, item store.EventWishlistItem) (Gift, error) {
+	userIDToName := make(map[string]string)
+	toName, err := db.UserIDToName(ctx, item.UserID, userIDToName)
+	if err != nil {
+		return Gift{}, fmt.Errorf("failed to get to name: %w", err)
+	}
+	var fromName string
+	if item.BuyerID != nil {
+		fromName, err = db.UserIDToName(ctx, *item.BuyerID, userIDToName)
+		if err != nil {
+			return Gift{}, fmt.Errorf("failed to get from name: %w", err)
+		}
+	}
+	return Gift{
+		ID:           item.ID,
+		Name:         item.Name,
+		Status:       item.Status,
+		CreatorName:  toName,
+		ToName:       toName,
+		FromName:     fromName,
+		URLs:         item.URLs,
+		CreatedAt:    item.CreatedAt,
+		EventID:      eventID,
+		WishlistItem: true,
+		ReactionSummary: store.ReactionSummary{
+			Reactions: []store.ReactionCount{},
+		},
+	}, nil
+}
+
+// GetEventWishlists lists the wishlist items offered in an event.
+func GetEventWishlists(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			ctx     = r.Context()
+		)
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		items, err := listEventWishlistItems(ctx, db, *event)
+		if err != nil {
+			http.Error(w, "Error fetching wishlists", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		userIDToName := make(map[string]string)
+		result := make([]EventWishlistItem, 0, len(items))
+		for _, item := range items {
+			// its owner deleted it, it is only kept for its buyer
+			if item.Deleted && item.UserID == userID {
+				continue
+			}
+			i, err := toEventWishlistItem(ctx, db, userID, event.Type, item, userIDToName)
+			if err != nil {
+				http.Error(w, "Error processing wishlists", http.StatusInternalServerError)
+				log.Println("Error converting wishlist item:", err)
+				return
+			}
+			result = append(result, i)
+		}
+
+		_ = json.NewEncoder(w).Encode(EventWishlist{Items: result})
+	}
+}
+
+type reserveWishlistItemRequest struct {
+	Status store.GiftStatus `json:"status"`
+}
+
+// ReserveWishlistItem reserves, buys or releases a wishlist item in an event.
+// The reservation only holds in this event.
+func ReserveWishlistItem(db store.Store, now func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve user ID from session
+		userID, err := gothic.GetFromSession("user_id", r)
+		if err != nil || userID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var req reserveWishlistItemRequest
+		err = decoder.Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			log.Println(err)
+			return
+		}
+		if req.Status != store.NewGiftStatus && req.Status != store.AboutToBeBoughtGiftStatus && req.Status != store.BoughtGiftStatus {
+			http.Error(w, "Unknown status", http.StatusBadRequest)
+			return
+		}
+
+		var (
+			eventID = r.PathValue("event_id")
+			itemID  = r.PathValue("item_id")
+			ctx     = r.Context()
+		)
+
+		hasAccess, err := checkIfUserHasAccessToEvents(ctx, db, userID, eventID)
+		if err != nil {
+			http.Error(w, "Error checking event access", http.StatusInternalServerError)
+			return
+		}
+		if !hasAccess {
+			http.Error(w, "Event not found", http.StatusBadRequest)
+			return
+		}
+
+		event, err := db.GetEvent(ctx, eventID)
+		if err != nil || event == nil {
+			http.Error(w, "Error fetching event", http.StatusInternalServerError)
+			return
+		}
+
+		items, err := listEventWishlistItems(ctx, db, *event)
+		if err != nil {
+			http.Error(w, "Error fetching wishlists", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		var found *store.EventWishlistItem
+		for _, item := range items {
+			if item.ID == itemID {
+				found = &item
+				break
+			}
+		}
+		if found == nil {
+			http.Error(w, "Wishlist item not found", http.StatusNotFound)
+			return
+		}
+		if found.UserID == userID {
+			http.Error(w, "You cannot reserve items of your own wishlist", http.StatusForbidden)
+			return
+		}
+
+		err = db.ReserveWishlistItem(ctx, userID, eventID, itemID, req.Status, now())
+		if err != nil {
+			if store.IsWishlistItemUnavailableError(err) {
+				http.Error(w, "This item is not available anymore", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Error updating wishlist item", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(nil)
+	}
+}
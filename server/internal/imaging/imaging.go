@@ -0,0 +1,159 @@
+// Package imaging validates and normalizes the images uploaded by users.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxPixels bounds the size of decoded images, so that a small file
+	// cannot expand into gigabytes of memory.
+	MaxPixels = 40_000_000
+	// ThumbnailSize is the size of the box thumbnails fit in.
+	ThumbnailSize = 320
+
+	jpegQuality          = 90
+	thumbnailJPEGQuality = 80
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image is too large")
+)
+
+// Image is an encoded image.
+type Image struct {
+	Content     []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Process decodes an uploaded image and encodes it again, which drops its
+// metadata such as EXIF location, and a thumbnail of it. The format is
+// sniffed from the content, not trusted from the client. JPEG images are
+// rotated according to their EXIF orientation beforehand, as it is lost with
+// the metadata. GIF images are converted to PNG, keeping their first frame.
+func Process(data []byte) (original Image, thumbnail Image, _ error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return original, thumbnail, fmt.Errorf("%w: %s", ErrUnsupportedFormat, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return original, thumbnail, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return original, thumbnail, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+
+	var img image.Image
+	switch contentType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err == nil {
+			img = orient(img, jpegOrientation(data))
+		}
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return original, thumbnail, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	original, err = encode(img, contentType == "image/jpeg", jpegQuality)
+	if err != nil {
+		return original, thumbnail, err
+	}
+
+	bounds := img.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), ThumbnailSize)
+	if width != bounds.Dx() || height != bounds.Dy() {
+		img = resize(img, width, height)
+	}
+	thumbnail, err = encode(img, contentType == "image/jpeg", thumbnailJPEGQuality)
+	if err != nil {
+		return original, thumbnail, err
+	}
+
+	return original, thumbnail, nil
+}
+
+// encode encodes img as JPEG, or as PNG to keep its transparency.
+func encode(img image.Image, asJPEG bool, quality int) (Image, error) {
+	var (
+		buf         bytes.Buffer
+		err         error
+		contentType string
+	)
+	if asJPEG {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	return Image{
+		Content:     buf.Bytes(),
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}, nil
+}
+
+// fit returns the size of a width x height image scaled down to fit in a
+// size x size box, keeping its aspect ratio.
+func fit(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// resize scales src down to width x height, averaging the source pixels
+// covered by each destination pixel.
+func resize(src image.Image, width int, height int) *image.RGBA64 {
+	bounds := src.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := src.At(sx, sy).RGBA()
+					r += uint64(sr)
+					g += uint64(sg)
+					b += uint64(sb)
+					a += uint64(sa)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
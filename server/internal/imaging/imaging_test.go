@@ -0,0 +1,144 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves returns a width x height image, red on its left half and blue on its
+// right half.
+func halves(width int, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with orientation after the start
+// of image marker of a JPEG.
+func withOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	_ = binary.Write(&tiff, binary.BigEndian, uint16(42))
+	_ = binary.Write(&tiff, binary.BigEndian, uint32(8))
+	_ = binary.Write(&tiff, binary.BigEndian, uint16(1))
+	_ = binary.Write(&tiff, binary.BigEndian, uint16(exifOrientationTag))
+	_ = binary.Write(&tiff, binary.BigEndian, uint16(3))
+	_ = binary.Write(&tiff, binary.BigEndian, uint32(1))
+	_ = binary.Write(&tiff, binary.BigEndian, orientation)
+	_ = binary.Write(&tiff, binary.BigEndian, uint16(0))
+	_ = binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestProcessRotatesAndStripsEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, halves(40, 20), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := withOrientation(t, buf.Bytes(), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("expected orientation 6, got %d", jpegOrientation(data))
+	}
+
+	original, thumbnail, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process() returned %v", err)
+	}
+	if original.ContentType != "image/jpeg" || original.Width != 20 || original.Height != 40 {
+		t.Fatalf("expected an upright 20x40 JPEG, got %s %dx%d", original.ContentType, original.Width, original.Height)
+	}
+	if bytes.Contains(original.Content, []byte("Exif")) {
+		t.Fatal("expected the EXIF segment to be stripped")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(original.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the left half of the stored image is its top half once upright
+	if !isRed(img.At(10, 5)) || isRed(img.At(10, 35)) {
+		t.Fatal("expected the image to be rotated a quarter turn clockwise")
+	}
+	if thumbnail.Width != 20 || thumbnail.Height != 40 {
+		t.Fatalf("expected small images to keep their size, got %dx%d", thumbnail.Width, thumbnail.Height)
+	}
+}
+
+func TestProcessThumbnail(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(1000, 500)); err != nil {
+		t.Fatal(err)
+	}
+
+	original, thumbnail, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process() returned %v", err)
+	}
+	if original.ContentType != "image/png" || original.Width != 1000 || original.Height != 500 {
+		t.Fatalf("unexpected original %s %dx%d", original.ContentType, original.Width, original.Height)
+	}
+	if thumbnail.ContentType != "image/png" || thumbnail.Width != ThumbnailSize || thumbnail.Height != ThumbnailSize/2 {
+		t.Fatalf("unexpected thumbnail %s %dx%d", thumbnail.ContentType, thumbnail.Width, thumbnail.Height)
+	}
+	img, err := png.Decode(bytes.NewReader(thumbnail.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isRed(img.At(10, 10)) || isRed(img.At(ThumbnailSize-10, 10)) {
+		t.Fatal("expected the thumbnail to look like the original")
+	}
+}
+
+func TestProcessRefusesOtherContent(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"html":      []byte("<html><script>alert(1)</script></html>"),
+		"truncated": {0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n', 0, 0},
+	} {
+		if _, _, err := Process(data); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Fatalf("expected %s to be refused, got %v", name, err)
+		}
+	}
+
+	// a header claiming a huge image
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100_000)
+	binary.BigEndian.PutUint32(data[20:], 100_000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, _, err := Process(data); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected the huge image to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Package loginlimit slows down brute-force attacks on logins by tracking
+// failed attempts per key (client IP or account) and making callers wait
+// exponentially longer, up to a temporary lockout, after repeated failures.
+package loginlimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter tracks failed login attempts.
+type Limiter interface {
+	// Allow returns how long the caller must wait before attempting to log
+	// in again with key, or 0 if it may try now. An allowed attempt counts as
+	// failed right away, in the same step as the check, so that concurrent
+	// attempts cannot all get through: Succeed takes it back.
+	Allow(ctx context.Context, key string) (time.Duration, error)
+	// Succeed takes back an attempt counted by Allow, which succeeded.
+	Succeed(ctx context.Context, key string) error
+	// Reset forgets the failed attempts of key, after a successful login.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how long to wait after a number of failed attempts.
+type Policy struct {
+	// FreeAttempts is the number of failures allowed without any delay.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past FreeAttempts. It
+	// doubles with every following failure.
+	BaseDelay time.Duration
+	// LockoutAttempts is the number of failures after which the key is
+	// locked out for LockoutDuration.
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// DefaultPolicy lets 5 attempts through, then backs off from 1 second on and
+// locks out for 15 minutes after 10 failures.
+var DefaultPolicy = Policy{
+	FreeAttempts:    5,
+	BaseDelay:       time.Second,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// RetryAfter returns how long to wait at time now after failures failed
+// attempts, the last of which happened at lastFailure.
+func (p Policy) RetryAfter(failures int, lastFailure time.Time, now time.Time) time.Duration {
+	if failures <= p.FreeAttempts || now.Sub(lastFailure) > p.Window {
+		return 0
+	}
+
+	var delay time.Duration
+	if failures >= p.LockoutAttempts {
+		delay = p.LockoutDuration
+	} else {
+		delay = p.BaseDelay << (failures - p.FreeAttempts - 1)
+		if delay > p.LockoutDuration {
+			delay = p.LockoutDuration
+		}
+	}
+
+	wait := lastFailure.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Expired tells whether failures whose last one happened at lastFailure can be
+// forgotten at time now.
+func (p Policy) Expired(lastFailure time.Time, now time.Time) bool {
+	return now.Sub(lastFailure) > p.Window
+}
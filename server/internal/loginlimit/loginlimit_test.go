@@ -0,0 +1,175 @@
+package loginlimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// fakeFailureStore mimics the SQL implementation of FailureStore.
+type fakeFailureStore struct {
+	failures map[string]attempts
+}
+
+func (s *fakeFailureStore) ChargeLoginFailure(_ context.Context, key string, allow func(failures int, lastFailure time.Time) bool, at time.Time, since time.Time) (bool, error) {
+	a := s.failures[key]
+	if !allow(a.failures, a.lastFailure) {
+		return false, nil
+	}
+	if a.lastFailure.Before(since) {
+		a.failures = 0
+	}
+	a.failures++
+	a.lastFailure = at
+	s.failures[key] = a
+	return true, nil
+}
+
+func (s *fakeFailureStore) RefundLoginFailure(_ context.Context, key string) error {
+	if a, ok := s.failures[key]; ok && a.failures > 0 {
+		a.failures--
+		s.failures[key] = a
+	}
+	return nil
+}
+
+func (s *fakeFailureStore) ResetLoginFailures(_ context.Context, key string) error {
+	delete(s.failures, key)
+	return nil
+}
+
+func TestLimiters(t *testing.T) {
+	newLimiters := map[string]func(clock *fakeClock) Limiter{
+		"memory": func(clock *fakeClock) Limiter {
+			return NewMemory(DefaultPolicy, clock.Now)
+		},
+		"store": func(clock *fakeClock) Limiter {
+			return NewStore(DefaultPolicy, clock.Now, &fakeFailureStore{failures: make(map[string]attempts)})
+		},
+	}
+
+	for name, newLimiter := range newLimiters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &fakeClock{now: time.Date(2025, 12, 24, 20, 0, 0, 0, time.UTC)}
+			limiter := newLimiter(clock)
+
+			// allowed attempts count as failed until they succeed
+			allow := func() time.Duration {
+				t.Helper()
+				wait, err := limiter.Allow(ctx, "ip:127.0.0.1")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return wait
+			}
+
+			for range DefaultPolicy.FreeAttempts + 1 {
+				if wait := allow(); wait != 0 {
+					t.Fatalf("expected free attempts to be allowed, got %s", wait)
+				}
+			}
+
+			// backoff doubles with every failure, refused attempts do not count
+			if wait := allow(); wait != time.Second {
+				t.Fatalf("expected to wait 1s, got %s", wait)
+			}
+			clock.now = clock.now.Add(time.Second)
+			if wait := allow(); wait != 0 {
+				t.Fatalf("expected backoff to be over, got %s", wait)
+			}
+			if wait := allow(); wait != 2*time.Second {
+				t.Fatalf("expected to wait 2s, got %s", wait)
+			}
+
+			// other keys are not affected
+			if wait, _ := limiter.Allow(ctx, "ip:10.0.0.1"); wait != 0 {
+				t.Fatalf("expected other key not to wait, got %s", wait)
+			}
+
+			for i := range DefaultPolicy.LockoutAttempts - DefaultPolicy.FreeAttempts - 2 {
+				clock.now = clock.now.Add(2 * time.Second << i)
+				if wait := allow(); wait != 0 {
+					t.Fatalf("expected backoff to be over, got %s", wait)
+				}
+			}
+			if wait := allow(); wait != DefaultPolicy.LockoutDuration {
+				t.Fatalf("expected lockout, got %s", wait)
+			}
+
+			clock.now = clock.now.Add(DefaultPolicy.LockoutDuration)
+			if wait := allow(); wait != 0 {
+				t.Fatalf("expected lockout to be over, got %s", wait)
+			}
+
+			// failures are forgotten after the window
+			clock.now = clock.now.Add(DefaultPolicy.Window + time.Second)
+			for range DefaultPolicy.FreeAttempts + 1 {
+				if wait := allow(); wait != 0 {
+					t.Fatalf("expected failures to be forgotten, got %s", wait)
+				}
+			}
+
+			if err := limiter.Reset(ctx, "ip:127.0.0.1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for range DefaultPolicy.FreeAttempts + 1 {
+				if wait := allow(); wait != 0 {
+					t.Fatalf("expected reset to clear the failures, got %s", wait)
+				}
+			}
+
+			if err := limiter.Succeed(ctx, "ip:127.0.0.1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if wait := allow(); wait != 0 {
+				t.Fatalf("expected the successful attempt to be taken back, got %s", wait)
+			}
+			if wait := allow(); wait != time.Second {
+				t.Fatalf("expected to wait 1s, got %s", wait)
+			}
+		})
+	}
+}
+
+func TestMemoryAllowIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2025, 12, 24, 20, 0, 0, 0, time.UTC)}
+	limiter := NewMemory(DefaultPolicy, clock.Now)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Allow(ctx, "ip:127.0.0.1")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != DefaultPolicy.FreeAttempts+1 {
+		t.Fatalf("expected %d concurrent attempts to get through, got %d", DefaultPolicy.FreeAttempts+1, allowed)
+	}
+}
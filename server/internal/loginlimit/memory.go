@@ -0,0 +1,78 @@
+package loginlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// memoryLimiter keeps failed attempts in memory. It is only suitable for
+// deployments running a single instance.
+type memoryLimiter struct {
+	policy Policy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	attempts map[string]*attempts
+}
+
+// NewMemory returns a Limiter keeping its state in memory.
+func NewMemory(policy Policy, now func() time.Time) Limiter {
+	return &memoryLimiter{
+		policy:   policy,
+		now:      now,
+		attempts: make(map[string]*attempts),
+	}
+}
+
+func (l *memoryLimiter) Allow(_ context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &attempts{}
+		l.attempts[key] = a
+	}
+	if wait := l.policy.RetryAfter(a.failures, a.lastFailure, now); wait > 0 {
+		return wait, nil
+	}
+	a.failures++
+	a.lastFailure = now
+	return 0, nil
+}
+
+func (l *memoryLimiter) Succeed(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if a, ok := l.attempts[key]; ok && a.failures > 0 {
+		a.failures--
+	}
+	return nil
+}
+
+func (l *memoryLimiter) Reset(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+	return nil
+}
+
+// prune forgets expired attempts so the map does not grow forever.
+func (l *memoryLimiter) prune(now time.Time) {
+	for key, a := range l.attempts {
+		if l.policy.Expired(a.lastFailure, now) {
+			delete(l.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package loginlimit
+
+import (
+	"context"
+	"time"
+)
+
+// FailureStore persists failed login attempts, so that every instance of the
+// server shares them.
+type FailureStore interface {
+	ResetLoginFailures(ctx context.Context, key string) error
+	// ChargeLoginFailure adds a failure at time at, starting over from 1 if
+	// the previous failures happened before since, provided allow accepts the
+	// failures of key so far. The check and the addition happen atomically.
+	// It returns whether the failure was added.
+	ChargeLoginFailure(ctx context.Context, key string, allow func(failures int, lastFailure time.Time) bool, at time.Time, since time.Time) (bool, error)
+	// RefundLoginFailure removes a failure of key.
+	RefundLoginFailure(ctx context.Context, key string) error
+}
+
+type storeLimiter struct {
+	policy Policy
+	now    func() time.Time
+	store  FailureStore
+}
+
+// NewStore returns a Limiter keeping its state in s, for deployments running
+// several instances.
+func NewStore(policy Policy, now func() time.Time, s FailureStore) Limiter {
+	return &storeLimiter{
+		policy: policy,
+		now:    now,
+		store:  s,
+	}
+}
+
+func (l *storeLimiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	var (
+		now  = l.now()
+		wait time.Duration
+	)
+	allow := func(failures int, lastFailure time.Time) bool {
+		wait = l.policy.RetryAfter(failures, lastFailure, now)
+		return wait == 0
+	}
+	if _, err := l.store.ChargeLoginFailure(ctx, key, allow, now, now.Add(-l.policy.Window)); err != nil {
+		return 0, err
+	}
+	return wait, nil
+}
+
+func (l *storeLimiter) Succeed(ctx context.Context, key string) error {
+	return l.store.RefundLoginFailure(ctx, key)
+}
+
+func (l *storeLimiter) Reset(ctx context.Context, key string) error {
+	return l.store.ResetLoginFailures(ctx, key)
+}
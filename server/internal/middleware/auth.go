@@ -2,12 +2,21 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 
 	"github.com/markbates/goth/gothic"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware rejects the requests of users who are not logged in, or
+// whose session ended since they logged in.
+func AuthMiddleware(versions SessionVersions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authMiddleware(versions, next)
+	}
+}
+
+func authMiddleware(versions SessionVersions, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve user ID from the session
 		userID, err := gothic.GetFromSession("user_id", r)
@@ -16,6 +25,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		version, active, err := versions.GetSessionVersion(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+		if !active || version != sessionVersion(r, userID) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		// Refresh the session's lifetime
 		session, _ := gothic.Store.Get(r, gothic.SessionName)
 		session.Options.MaxAge = 86400 // Extend by 1 day (adjust as needed)
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth/gothic"
+)
+
+type fakeSessionVersions map[string]int
+
+func (v fakeSessionVersions) GetSessionVersion(_ context.Context, userID string) (int, bool, error) {
+	version, ok := v[userID]
+	return version, ok, nil
+}
+
+func TestAuthMiddlewareEndsOldSessions(t *testing.T) {
+	gothic.Store = sessions.NewCookieStore([]byte("test-session-secret"))
+	versions := fakeSessionVersions{"1": 0}
+
+	// log in, like the login handlers do
+	login := httptest.NewRecorder()
+	loginRequest := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	if err := SaveLogin(login, loginRequest, "1", versions["1"], time.Now()); err != nil {
+		t.Fatalf("SaveLogin() returned %v", err)
+	}
+	if err := gothic.StoreInSession("user_id", "1", loginRequest, login); err != nil {
+		t.Fatalf("StoreInSession() returned %v", err)
+	}
+
+	handler := AuthMiddleware(versions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func() int {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodGet, "/api/user", nil)
+		for _, cookie := range login.Result().Cookies() {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	if code := get(); code != http.StatusNoContent {
+		t.Fatalf("expected the session to be valid, got %d", code)
+	}
+	versions["1"]++
+	if code := get(); code != http.StatusUnauthorized {
+		t.Fatalf("expected the session to end with its version, got %d", code)
+	}
+	delete(versions, "1")
+	if code := get(); code != http.StatusUnauthorized {
+		t.Fatalf("expected the session of a deleted user to end, got %d", code)
+	}
+}
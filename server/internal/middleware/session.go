@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/markbates/goth/gothic"
+)
+
+// loginSessionName is the session remembering how the user logged in, next
+// to the user ID stored by gothic.
+const loginSessionName = "_gifter_login"
+
+// SessionVersions tells the version of the sessions of users, which changes
+// whenever their sessions must end, e.g. after a password change.
+type SessionVersions interface {
+	// GetSessionVersion returns the session version of the user, and false
+	// if the user does not exist anymore.
+	GetSessionVersion(ctx context.Context, userID string) (int, bool, error)
+}
+
+// SaveLogin remembers that userID logged in at loggedInAt, when their
+// sessions were at version.
+func SaveLogin(w http.ResponseWriter, r *http.Request, userID string, version int, loggedInAt time.Time) error {
+	session, _ := gothic.Store.Get(r, loginSessionName)
+	session.Values["user_id"] = userID
+	session.Values["session_version"] = version
+	session.Values["logged_in_at"] = loggedInAt.Unix()
+	return session.Save(r, w)
+}
+
+// ClearLogin forgets how the user logged in, when they log out.
+func ClearLogin(w http.ResponseWriter, r *http.Request) error {
+	session, _ := gothic.Store.Get(r, loginSessionName)
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+// sessionVersion returns the session version userID logged in with. Sessions
+// started before versions existed are at version 0.
+func sessionVersion(r *http.Request, userID string) int {
+	session, err := gothic.Store.Get(r, loginSessionName)
+	if err != nil {
+		return 0
+	}
+	if loggedInUserID, _ := session.Values["user_id"].(string); loggedInUserID != userID {
+		return 0
+	}
+	version, _ := session.Values["session_version"].(int)
+	return version
+}
+
+// LoggedInAt returns when userID logged in, or the zero time if unknown.
+func LoggedInAt(r *http.Request, userID string) time.Time {
+	session, err := gothic.Store.Get(r, loginSessionName)
+	if err != nil {
+		return time.Time{}
+	}
+	if loggedInUserID, _ := session.Values["user_id"].(string); loggedInUserID != userID {
+		return time.Time{}
+	}
+	loggedInAt, ok := session.Values["logged_in_at"].(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(loggedInAt, 0)
+}
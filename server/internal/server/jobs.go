@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/epot/gifterv2/internal/handlers"
+	"github.com/epot/gifterv2/internal/store"
+)
+
+// job is a maintenance task run periodically in the background.
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+func (s *Server) jobs() []job {
+	return []job{
+		{
+			name:     "purge data exports",
+			interval: time.Hour,
+			run: func(ctx context.Context) error {
+				now := time.Now()
+				deleted, err := s.db.DeleteExpiredDataExports(ctx, now, now.Add(-handlers.ExportStaleAfter))
+				if err != nil {
+					return err
+				}
+				if deleted > 0 {
+					log.Printf("purged %d data exports", deleted)
+				}
+				return nil
+			},
+		},
+		{
+			name:     "purge trashed gifts",
+			interval: time.Hour,
+			run: func(ctx context.Context) error {
+				deleted, err := s.db.PurgeTrashedGifts(ctx, time.Now().Add(-handlers.GiftRetention))
+				if err != nil {
+					return err
+				}
+				if deleted > 0 {
+					log.Printf("purged %d trashed gifts", deleted)
+				}
+				return nil
+			},
+		},
+		{
+			name:     "purge detached gift images",
+			interval: time.Hour,
+			run: func(ctx context.Context) error {
+				images, err := s.db.ListDetachedGiftImages(ctx)
+				if err != nil {
+					return err
+				}
+				// an image that fails is retried next time, the others go on
+				var (
+					errs   []error
+					purged int
+				)
+			images:
+				for _, image := range images {
+					for _, key := range []string{image.BlobKey, image.ThumbnailKey} {
+						if err := s.blobs.Delete(ctx, key); err != nil {
+							log.Printf("Error purging gift image %s: %v", image.ID, err)
+							errs = append(errs, err)
+							continue images
+						}
+					}
+					if err := s.db.DeleteGiftImage(ctx, image.ID); err != nil {
+						log.Printf("Error purging gift image %s: %v", image.ID, err)
+						errs = append(errs, err)
+						continue
+					}
+					purged++
+				}
+				if purged > 0 {
+					log.Printf("purged %d gift images", purged)
+				}
+				return errors.Join(errs...)
+			},
+		},
+		{
+			name:     "roll over recurring events",
+			interval: time.Hour,
+			run: func(ctx context.Context) error {
+				now := time.Now()
+				eventIDs, err := s.db.ListEventsToRollOver(ctx, now.Add(-handlers.RollOverAfter))
+				if err != nil {
+					return err
+				}
+				// an event that fails is retried next time, the others go on
+				var errs []error
+				for _, eventID := range eventIDs {
+					newEventID, err := s.db.RollOverEvent(ctx, eventID, now)
+					if err != nil {
+						if store.IsAlreadyRolledOverError(err) {
+							// rolled over manually in the meantime
+							continue
+						}
+						log.Printf("Error rolling over event %s: %v", eventID, err)
+						errs = append(errs, err)
+						continue
+					}
+					log.Printf("rolled over event %s to %s", eventID, newEventID)
+				}
+				return errors.Join(errs...)
+			},
+		},
+	}
+}
+
+// startJobs runs every job in its own goroutine until ctx is done.
+func (s *Server) startJobs(ctx context.Context) {
+	for _, j := range s.jobs() {
+		go func() {
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := j.run(ctx); err != nil {
+						log.Printf("Error running job %s: %v", j.name, err)
+					}
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/epot/gifterv2/internal/blob"
+	"github.com/epot/gifterv2/internal/store"
+)
+
+var errJob = errors.New("job failure")
+
+// jobTestStore answers the queries of the jobs, failing for the IDs in fail.
+// Any other call panics.
+type jobTestStore struct {
+	store.Store
+	fail     map[string]bool
+	rolled   []string
+	deleted  []string
+	eventIDs []string
+	images   []store.GiftImage
+}
+
+func (s *jobTestStore) ListEventsToRollOver(context.Context, time.Time) ([]string, error) {
+	return s.eventIDs, nil
+}
+
+func (s *jobTestStore) RollOverEvent(_ context.Context, eventID string, _ time.Time) (string, error) {
+	if s.fail[eventID] {
+		return "", errJob
+	}
+	s.rolled = append(s.rolled, eventID)
+	return "next-" + eventID, nil
+}
+
+func (s *jobTestStore) ListDetachedGiftImages(context.Context) ([]store.GiftImage, error) {
+	return s.images, nil
+}
+
+func (s *jobTestStore) DeleteGiftImage(_ context.Context, imageID string) error {
+	s.deleted = append(s.deleted, imageID)
+	return nil
+}
+
+// jobTestBlobs fails to delete the blobs in fail.
+type jobTestBlobs struct {
+	blob.Store
+	fail map[string]bool
+}
+
+func (b jobTestBlobs) Delete(_ context.Context, key string) error {
+	if b.fail[key] {
+		return errJob
+	}
+	return nil
+}
+
+func runJob(t *testing.T, s *Server, name string) error {
+	t.Helper()
+
+	for _, j := range s.jobs() {
+		if j.name == name {
+			return j.run(context.Background())
+		}
+	}
+	t.Fatalf("no job %s", name)
+	return nil
+}
+
+func TestRollOverJobGoesOnAfterFailures(t *testing.T) {
+	db := &jobTestStore{eventIDs: []string{"1", "2", "3"}, fail: map[string]bool{"2": true}}
+	s := &Server{db: db}
+
+	err := runJob(t, s, "roll over recurring events")
+	if !errors.Is(err, errJob) {
+		t.Fatalf("expected the failure to be returned, got %v", err)
+	}
+	if !slices.Equal(db.rolled, []string{"1", "3"}) {
+		t.Fatalf("expected the other events to roll over, got %v", db.rolled)
+	}
+}
+
+func TestPurgeImagesJobGoesOnAfterFailures(t *testing.T) {
+	db := &jobTestStore{images: []store.GiftImage{
+		{ID: "1", BlobKey: "a", ThumbnailKey: "a-thumb"},
+		{ID: "2", BlobKey: "b", ThumbnailKey: "b-thumb"},
+		{ID: "3", BlobKey: "c", ThumbnailKey: "c-thumb"},
+	}}
+	s := &Server{db: db, blobs: jobTestBlobs{fail: map[string]bool{"b-thumb": true}}}
+
+	err := runJob(t, s, "purge detached gift images")
+	if !errors.Is(err, errJob) {
+		t.Fatalf("expected the failure to be returned, got %v", err)
+	}
+	// the image whose thumbnail is left is kept to be retried
+	if !slices.Equal(db.deleted, []string{"1", "3"}) {
+		t.Fatalf("expected the other images to be purged, got %v", db.deleted)
+	}
+}
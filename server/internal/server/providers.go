@@ -0,0 +1,94 @@
+package server
+
+import (
+	"log"
+	"os"
+
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/microsoftonline"
+	"github.com/markbates/goth/providers/openidConnect"
+)
+
+// providerConfig describes an OAuth/OIDC login provider that can be enabled
+// through environment variables. A provider is only registered when its
+// client id, client secret and callback URL are all set.
+type providerConfig struct {
+	// envPrefix is the prefix of the environment variables configuring the
+	// provider, e.g. GOOGLE for GOOGLE_CLIENT_ID.
+	envPrefix string
+	// extraEnv lists additional environment variables the provider requires.
+	extraEnv []string
+	build    func(clientID, clientSecret, callbackURL string, extra map[string]string) (goth.Provider, error)
+}
+
+// providerRegistry lists every login provider the server knows how to build.
+var providerRegistry = []providerConfig{
+	{
+		envPrefix: "GOOGLE",
+		build: func(clientID, clientSecret, callbackURL string, _ map[string]string) (goth.Provider, error) {
+			return google.New(clientID, clientSecret, callbackURL, "email", "profile"), nil
+		},
+	},
+	{
+		envPrefix: "GITHUB",
+		build: func(clientID, clientSecret, callbackURL string, _ map[string]string) (goth.Provider, error) {
+			return github.New(clientID, clientSecret, callbackURL, "read:user", "user:email"), nil
+		},
+	},
+	{
+		envPrefix: "MICROSOFT",
+		build: func(clientID, clientSecret, callbackURL string, _ map[string]string) (goth.Provider, error) {
+			return microsoftonline.New(clientID, clientSecret, callbackURL, "User.Read"), nil
+		},
+	},
+	{
+		envPrefix: "OIDC",
+		extraEnv:  []string{"OIDC_DISCOVERY_URL"},
+		build: func(clientID, clientSecret, callbackURL string, extra map[string]string) (goth.Provider, error) {
+			return openidConnect.New(clientID, clientSecret, callbackURL, extra["OIDC_DISCOVERY_URL"], "openid", "email", "profile")
+		},
+	},
+}
+
+// configuredProviders builds every provider of the registry whose environment
+// variables are set, skipping (and logging) the others.
+func configuredProviders() []goth.Provider {
+	var providers []goth.Provider
+
+	for _, config := range providerRegistry {
+		clientID := os.Getenv(config.envPrefix + "_CLIENT_ID")
+		clientSecret := os.Getenv(config.envPrefix + "_CLIENT_SECRET")
+		callbackURL := os.Getenv(config.envPrefix + "_CALLBACK_URL")
+
+		if clientID == "" || clientSecret == "" || callbackURL == "" {
+			log.Printf("%s OAuth environment variables are not set, skipping provider", config.envPrefix)
+			continue
+		}
+
+		extra := make(map[string]string, len(config.extraEnv))
+		missingExtra := false
+		for _, key := range config.extraEnv {
+			extra[key] = os.Getenv(key)
+			if extra[key] == "" {
+				log.Printf("%s is not set, skipping %s provider", key, config.envPrefix)
+				missingExtra = true
+			}
+		}
+		if missingExtra {
+			continue
+		}
+
+		provider, err := config.build(clientID, clientSecret, callbackURL, extra)
+		if err != nil {
+			log.Printf("Error configuring %s provider: %v", config.envPrefix, err)
+			continue
+		}
+
+		log.Println("login provider enabled: ", provider.Name())
+		providers = append(providers, provider)
+	}
+
+	return providers
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/epot/gifterv2/internal/handlers"
 	"github.com/epot/gifterv2/internal/middleware"
@@ -13,6 +15,11 @@ import (
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		// Resolve the client IP from the headers set by the proxy, used
+		// by the login limiter
+		r.Use(chimiddleware.RealIP)
+	}
 	r.Use(chimiddleware.Logger)
 
 	r.Use(cors.Handler(cors.Options{
@@ -28,25 +35,92 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Get("/health", handlers.HealthHandler(s.db))
 
 	// Authentication routes
-	r.Post("/auth/login", handlers.LoginHandler(s.db))
-	r.Post("/auth/signup", handlers.SignupHandler(s.db))
+	r.Post("/auth/login", handlers.LoginHandler(s.db, s.loginLimiter, time.Now))
+	r.Post("/auth/login/2fa", handlers.TwoFactorLoginHandler(s.db, s.loginLimiter, time.Now))
+	r.Post("/auth/signup", handlers.SignupHandler(s.db, s.mailer, s.signer))
+	r.Get("/auth/verify", handlers.VerifyEmailHandler(s.db, s.signer))
+	r.Get("/auth/verify/email", handlers.ConfirmEmailChangeHandler(s.db, s.signer))
 	r.Get("/auth", gothic.BeginAuthHandler)
-	r.Get("/auth/callback", handlers.GoogleCallbackHandler(s.db))
+	r.Get("/auth/callback", handlers.OAuthCallbackHandler(s.db))
+	r.Get("/auth/providers", handlers.ListProvidersHandler)
 	r.Get("/auth/logout", handlers.LogoutHandler)
 
 	// API routes (protected)
-	r.With(middleware.AuthMiddleware).Get("/api/user", handlers.GetUserHandler(s.db))
-	r.With(middleware.AuthMiddleware).Get("/api/events", handlers.GetEvents(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/create", handlers.CreateEvent(s.db))
-	r.With(middleware.AuthMiddleware).Get("/api/events/{event_id}/participants", handlers.GetEventParticipants(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/participants/create", handlers.AddEventParticipant(s.db))
-	r.With(middleware.AuthMiddleware).Get("/api/events/{event_id}/gifts", handlers.GetGifts(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/gifts/create", handlers.CreateGift(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/gifts/{gift_id}/update", handlers.UpdateGift(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/gifts/{gift_id}/delete", handlers.DeleteGift(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/gifts/{gift_id}/update", handlers.UpdateGift(s.db))
-	r.With(middleware.AuthMiddleware).Get("/api/events/{event_id}/gifts/{gift_id}/comments", handlers.ListComments(s.db))
-	r.With(middleware.AuthMiddleware).Post("/api/events/{event_id}/gifts/{gift_id}/comments/create", handlers.CreateComment(s.db))
+	auth := middleware.AuthMiddleware(s.db)
+	r.With(auth).Get("/api/user", handlers.GetUserHandler(s.db))
+	r.With(auth).Post("/api/user/update", handlers.UpdateUserHandler(s.db))
+	r.With(auth).Post("/api/user/password", handlers.ChangePasswordHandler(s.db, s.loginLimiter))
+	r.With(auth).Post("/api/user/email", handlers.ChangeEmailHandler(s.db, s.mailer, s.signer, s.loginLimiter, time.Now))
+	r.With(auth).Post("/api/user/delete", handlers.DeleteUserHandler(s.db, s.loginLimiter))
+	r.With(auth).Get("/api/user/export", handlers.ExportUserData(s.db, s.signer, time.Now))
+	r.With(auth).Get("/api/user/export/download", handlers.DownloadUserExport(s.db, s.signer, time.Now))
+	r.With(auth).Post("/api/user/verify/resend", handlers.ResendVerificationEmail(s.db, s.mailer, s.signer, s.loginLimiter))
+	r.With(auth).Get("/api/user/wishlist", handlers.GetWishlist(s.db))
+	r.With(auth).Post("/api/user/wishlist/create", handlers.CreateWishlistItem(s.db))
+	r.With(auth).Post("/api/user/wishlist/{item_id}/update", handlers.UpdateWishlistItem(s.db))
+	r.With(auth).Post("/api/user/wishlist/{item_id}/relist", handlers.RelistWishlistItem(s.db, time.Now))
+	r.With(auth).Post("/api/user/wishlist/{item_id}/delete", handlers.DeleteWishlistItem(s.db))
+	r.With(auth).Get("/api/user/shopping-list", handlers.GetShoppingList(s.db))
+	r.With(auth).Post("/api/user/shopping-list/bought", handlers.MarkGiftsBought(s.db))
+	r.With(auth).Get("/api/user/identities", handlers.ListIdentities(s.db))
+	r.With(auth).Get("/api/user/identities/link", handlers.BeginLinkIdentity)
+	r.With(auth).Post("/api/user/identities/{provider}/delete", handlers.UnlinkIdentity(s.db))
+	r.With(auth).Post("/api/user/2fa/enroll", handlers.EnrollTwoFactor(s.db, s.loginLimiter))
+	r.With(auth).Post("/api/user/2fa/confirm", handlers.ConfirmTwoFactor(s.db, time.Now))
+	r.With(auth).Post("/api/user/2fa/disable", handlers.DisableTwoFactor(s.db, s.loginLimiter, time.Now))
+	r.With(auth).Get("/api/groups", handlers.GetGroups(s.db))
+	r.With(auth).Post("/api/groups/create", handlers.CreateGroup(s.db))
+	r.With(auth).Post("/api/groups/{group_id}/update", handlers.UpdateGroup(s.db))
+	r.With(auth).Post("/api/groups/{group_id}/delete", handlers.DeleteGroup(s.db))
+	r.With(auth).Get("/api/groups/{group_id}/members", handlers.GetGroupMembers(s.db))
+	r.With(auth).Post("/api/groups/{group_id}/members/create", handlers.AddGroupMember(s.db))
+	r.With(auth).Post("/api/groups/{group_id}/members/{user_id}/update", handlers.UpdateGroupMember(s.db))
+	r.With(auth).Post("/api/groups/{group_id}/members/{user_id}/delete", handlers.RemoveGroupMember(s.db))
+	r.With(auth).Get("/api/search", handlers.Search(s.db))
+	r.With(auth).Get("/api/events", handlers.GetEvents(s.db, time.Now))
+	r.With(auth).Post("/api/events/create", handlers.CreateEvent(s.db))
+	r.With(auth).Post("/api/events/{event_id}/update", handlers.UpdateEvent(s.db))
+	r.With(auth).Post("/api/events/{event_id}/archive", handlers.ArchiveEvent(s.db, true, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/unarchive", handlers.ArchiveEvent(s.db, false, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/delete", handlers.DeleteEvent(s.db))
+	r.With(auth).Post("/api/events/{event_id}/rollover", handlers.RollOverEvent(s.db, time.Now))
+	r.With(auth).Get("/api/events/{event_id}/participants", handlers.GetEventParticipants(s.db))
+	r.With(auth).Post("/api/events/{event_id}/participants/create", handlers.AddEventParticipant(s.db))
+	r.With(auth).Post("/api/events/{event_id}/participants/{user_id}/delete", handlers.RemoveEventParticipant(s.db))
+	r.With(auth).Post("/api/events/{event_id}/leave", handlers.LeaveEvent(s.db))
+	r.With(auth).Post("/api/events/{event_id}/groups/create", handlers.AddGroupToEvent(s.db))
+	r.With(auth).Get("/api/events/{event_id}/links", handlers.ListJoinLinks(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/links/create", handlers.CreateJoinLink(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/links/{link_id}/revoke", handlers.RevokeJoinLink(s.db, time.Now))
+	r.With(auth).Post("/api/join/{token}", handlers.RedeemJoinLink(s.db, time.Now))
+	r.With(auth).Get("/api/events/{event_id}/gifts", handlers.GetGifts(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/create", handlers.CreateGift(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/transfer", handlers.TransferGifts(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/update", handlers.UpdateGift(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/edit", handlers.EditGift(s.db, s.mailer))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/delete", handlers.DeleteGift(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/vote", handlers.VoteGiftIdea(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/reactions/toggle", handlers.ToggleGiftReaction(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/promote", handlers.PromoteGiftIdea(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/purchase", handlers.UpdateGiftPurchase(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/thanks", handlers.SendThankYouNote(s.db, s.mailer, time.Now))
+	r.With(auth).Get("/api/events/{event_id}/received", handlers.GetReceivedGifts(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/update", handlers.UpdateGift(s.db))
+	r.With(auth).Get("/api/events/{event_id}/coverage", handlers.GetCoverageReport(s.db))
+	r.With(auth).Get("/api/events/{event_id}/wishlists", handlers.GetEventWishlists(s.db))
+	r.With(auth).Post("/api/events/{event_id}/wishlists/{item_id}/update", handlers.ReserveWishlistItem(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/wishlists/{item_id}/thanks", handlers.SendWishlistThankYouNote(s.db, s.mailer, time.Now))
+	r.With(auth).Get("/api/events/{event_id}/trash", handlers.GetTrashedGifts(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/trash/{gift_id}/restore", handlers.RestoreGift(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/trash/{gift_id}/delete", handlers.DeleteTrashedGift(s.db))
+	r.With(auth).Get("/api/events/{event_id}/gifts/{gift_id}/images", handlers.ListGiftImages(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/images/create", handlers.UploadGiftImage(s.db, s.blobs))
+	r.With(auth).Get("/api/events/{event_id}/gifts/{gift_id}/images/{image_id}", handlers.GetGiftImage(s.db, s.blobs, false))
+	r.With(auth).Get("/api/events/{event_id}/gifts/{gift_id}/images/{image_id}/thumbnail", handlers.GetGiftImage(s.db, s.blobs, true))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/images/{image_id}/delete", handlers.DeleteGiftImage(s.db))
+	r.With(auth).Get("/api/events/{event_id}/gifts/{gift_id}/comments", handlers.ListComments(s.db))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/comments/{comment_id}/reactions/toggle", handlers.ToggleCommentReaction(s.db, time.Now))
+	r.With(auth).Post("/api/events/{event_id}/gifts/{gift_id}/comments/create", handlers.CreateComment(s.db))
 
 	return r
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,33 +9,34 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/epot/gifterv2/internal/blob"
+	"github.com/epot/gifterv2/internal/loginlimit"
+	"github.com/epot/gifterv2/internal/mailer"
 	"github.com/epot/gifterv2/internal/store"
+	"github.com/epot/gifterv2/internal/token"
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
 )
 
 var (
 	isProduction = os.Getenv("ENV") == "production"
+	// sessionSecret also signs the tokens of the links sent by email
+	sessionSecret string
 )
 
 type Server struct {
-	port int
-	db   store.Store
+	port         int
+	db           store.Store
+	loginLimiter loginlimit.Limiter
+	mailer       mailer.Mailer
+	signer       *token.Signer
+	blobs        blob.Store
 }
 
 func init() {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	callbackURL := os.Getenv("GOOGLE_CALLBACK_URL")
-
-	if clientID == "" || clientSecret == "" || callbackURL == "" {
-		log.Println("Error: Google OAuth environment variables are not set in .env")
-	}
-
 	// Configure session store
-	sessionSecret := os.Getenv("SESSION_SECRET")
+	sessionSecret = os.Getenv("SESSION_SECRET")
 	if sessionSecret == "" {
 		sessionSecret = "default-session-secret"
 	}
@@ -60,17 +62,32 @@ func init() {
 
 	gothic.Store = store
 
-	// Configure Google provider
-	goth.UseProviders(
-		google.New(clientID, clientSecret, callbackURL, "email", "profile"),
-	)
+	// Configure every login provider set up in the environment
+	goth.UseProviders(configuredProviders()...)
+}
+
+// newLoginLimiter returns the limiter of failed logins. Attempts are tracked
+// in memory unless LOGIN_LIMITER is set to "store", which shares them between
+// instances through the database.
+func newLoginLimiter(db store.Store) loginlimit.Limiter {
+	if os.Getenv("LOGIN_LIMITER") == "store" {
+		log.Println("login limiter: store")
+		return loginlimit.NewStore(loginlimit.DefaultPolicy, time.Now, db)
+	}
+	log.Println("login limiter: memory")
+	return loginlimit.NewMemory(loginlimit.DefaultPolicy, time.Now)
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	db := store.New(isProduction)
 	NewServer := &Server{
-		port: port,
-		db:   store.New(isProduction),
+		port:         port,
+		db:           db,
+		loginLimiter: newLoginLimiter(db),
+		mailer:       mailer.New(),
+		signer:       token.NewSigner([]byte(sessionSecret), time.Now),
+		blobs:        blob.New(),
 	}
 
 	// Declare Server config
@@ -82,5 +99,10 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Run the maintenance jobs until the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	NewServer.startJobs(jobsCtx)
+	server.RegisterOnShutdown(stopJobs)
+
 	return server
 }
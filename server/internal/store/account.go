@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DeletedUserName is the name shown in place of a deleted user on the
+// gifts and comments they leave behind.
+const DeletedUserName = "Deleted user"
+
+func (s *store) UpdateUserProfile(ctx context.Context, userID string, name string, picture string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET name = $1, picture = NULLIF($2, '') WHERE id = $3", name, picture, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+	return nil
+}
+
+func (s *store) ChangePassword(ctx context.Context, userID string, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// the sessions of whoever knew the old password end
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET password_hash = $1, session_version = session_version + 1 WHERE id = $2", hash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+// GetSessionVersion returns the version of the sessions of the user, which
+// changes whenever they must end. It returns false if the user was deleted.
+func (s *store) GetSessionVersion(ctx context.Context, userID string) (int, bool, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, "SELECT session_version FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get session version: %w", err)
+	}
+	return version, true, nil
+}
+
+// RequestEmailChange records email as the pending new email of the user. The
+// current email is kept until the new one is verified.
+func (s *store) RequestEmailChange(ctx context.Context, userID string, email string) error {
+	var existingUserID string
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1", email).Scan(&existingUserID)
+	if err == nil {
+		return NewEmailAlreadyUsedError(fmt.Errorf("email %s already used", email))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET pending_email = $1 WHERE id = $2", email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to request email change: %w", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange replaces the email of the user by their pending one,
+// provided it is still email. It returns false otherwise.
+func (s *store) ConfirmEmailChange(ctx context.Context, userID string, email string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET email = pending_email, pending_email = NULL, email_verified = true WHERE id = $1 AND pending_email = $2", userID, email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return false, NewEmailAlreadyUsedError(pgErr)
+		}
+		return false, fmt.Errorf("failed to confirm email change: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to confirm email change: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// DeleteAccount deletes the account of a user. The user row itself is kept,
+// anonymized, so that what they contributed to other users' events survives:
+//   - events they created are handed over to their oldest other participant,
+//     or deleted if they were alone in it,
+//   - they leave every event,
+//   - gifts addressed to them are deleted,
+//   - gifts they reserved but did not buy yet are released, bought ones and
+//     gifts and comments they created are kept under DeletedUserName,
+//   - their wishlist is deleted, and wishlist items they reserved but did not
+//     buy yet are released,
+//   - they leave their groups, which are handed over to their oldest other
+//     member if they were the last admin, or deleted if they were alone in it,
+//   - the join links they created, their data exports and the failed logins
+//     recorded for their email are deleted,
+//   - their login methods are removed so that nobody can log in as them.
+func (s *store) DeleteAccount(ctx context.Context, userID string) error {
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(
+			ctx,
+			`
+		UPDATE events SET creator_id = (
+			SELECT participants.user_id
+			FROM participants
+			WHERE participants.event_id = events.id AND participants.user_id != $1
+			ORDER BY participants.id ASC
+			LIMIT 1
+		)
+		WHERE events.creator_id = $1
+			AND EXISTS (SELECT 1 FROM participants WHERE participants.event_id = events.id AND participants.user_id != $1)
+	`,
+			userID)
+		if err != nil {
+			return fmt.Errorf("failed to transfer events: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM events WHERE creator_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete events: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM participants WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to leave events: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM gifts WHERE content::jsonb->>'to' = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete gifts to user: %w", err)
+		}
+
+		err = s.updateGiftContents(ctx, releaseReservation, "SELECT id, content FROM gifts WHERE content::jsonb->>'from' = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to release reservations: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_items WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete wishlist: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_reservations WHERE buyer_id = $1 AND status = $2", userID, AboutToBeBoughtGiftStatus)
+		if err != nil {
+			return fmt.Errorf("failed to release wishlist reservations: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM user_identities WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete identities: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM failed_logins WHERE user_id = $1 OR lower(email) = (SELECT lower(email) FROM users WHERE id = $1)", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete failed logins: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM data_exports WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete data exports: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM join_links WHERE creator_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete join links: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+		UPDATE group_members SET role = $2
+		WHERE group_members.id IN (
+			SELECT (
+				SELECT others.id
+				FROM group_members others
+				WHERE others.group_id = mine.group_id AND others.user_id != $1
+				ORDER BY others.id ASC
+				LIMIT 1
+			)
+			FROM group_members mine
+			WHERE mine.user_id = $1 AND mine.role = $2
+				AND NOT EXISTS (
+					SELECT 1 FROM group_members admins
+					WHERE admins.group_id = mine.group_id AND admins.user_id != $1 AND admins.role = $2
+				)
+		)
+	`,
+			userID, AdminGroupRole)
+		if err != nil {
+			return fmt.Errorf("failed to hand over groups: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+		DELETE FROM user_groups
+		WHERE EXISTS (SELECT 1 FROM group_members WHERE group_members.group_id = user_groups.id AND group_members.user_id = $1)
+			AND NOT EXISTS (SELECT 1 FROM group_members WHERE group_members.group_id = user_groups.id AND group_members.user_id != $1)
+	`,
+			userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete groups: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM group_members WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to leave groups: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+		UPDATE users SET
+			name = $2,
+			email = 'deleted-' || id || '@deleted.invalid',
+			pending_email = NULL,
+			picture = NULL,
+			password_hash = '',
+			totp_secret = NULL,
+			totp_enabled = false,
+			totp_last_step = NULL,
+			session_version = session_version + 1,
+			deleted_at = $3
+		WHERE id = $1
+	`,
+			userID, DeletedUserName, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionVersion(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	userID, err := s.Signup(ctx, "Sessions", "session-version@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Signup() returned %v", err)
+	}
+
+	version, active, err := s.GetSessionVersion(ctx, userID)
+	if err != nil || !active || version != 0 {
+		t.Fatalf("GetSessionVersion() returned %d, %v, %v", version, active, err)
+	}
+
+	if err := s.ChangePassword(ctx, userID, "password456"); err != nil {
+		t.Fatalf("ChangePassword() returned %v", err)
+	}
+	version, active, err = s.GetSessionVersion(ctx, userID)
+	if err != nil || !active || version != 1 {
+		t.Fatalf("expected a password change to end the sessions, got %d, %v, %v", version, active, err)
+	}
+
+	if err := s.DeleteAccount(ctx, userID); err != nil {
+		t.Fatalf("DeleteAccount() returned %v", err)
+	}
+	_, active, err = s.GetSessionVersion(ctx, userID)
+	if err != nil || active {
+		t.Fatalf("expected the sessions of a deleted account to end, got %v, %v", active, err)
+	}
+}
+
+func TestDeleteAccountDeletesPersonalData(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	userID := event.CreatorID
+
+	handedOverID, err := s.CreateGroup(ctx, userID, "Family")
+	if err != nil {
+		t.Fatalf("CreateGroup() returned %v", err)
+	}
+	if err := s.AddGroupMember(ctx, handedOverID, event.FriendEmail, MemberGroupRole); err != nil {
+		t.Fatalf("AddGroupMember() returned %v", err)
+	}
+	aloneID, err := s.CreateGroup(ctx, userID, "Alone")
+	if err != nil {
+		t.Fatalf("CreateGroup() returned %v", err)
+	}
+	if _, err := s.CreateJoinLink(ctx, event.ID, userID, "delete-account-token", MemberParticipantRole, nil, nil); err != nil {
+		t.Fatalf("CreateJoinLink() returned %v", err)
+	}
+	if _, _, err := s.CreateDataExport(ctx, userID, time.Now()); err != nil {
+		t.Fatalf("CreateDataExport() returned %v", err)
+	}
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByID() returned %v, %v", user, err)
+	}
+	if err := s.RecordFailedLogin(ctx, FailedLogin{Email: user.Email, IP: "127.0.0.1", Reason: "wrong password"}); err != nil {
+		t.Fatalf("RecordFailedLogin() returned %v", err)
+	}
+
+	if err := s.DeleteAccount(ctx, userID); err != nil {
+		t.Fatalf("DeleteAccount() returned %v", err)
+	}
+
+	if count := countRows(t, s, "SELECT count(*) FROM group_members WHERE user_id = $1", userID); count != 0 {
+		t.Fatalf("expected the user to leave their groups, got %d memberships", count)
+	}
+	role, err := s.GetGroupRole(ctx, handedOverID, event.FriendID)
+	if err != nil || role == nil || *role != AdminGroupRole {
+		t.Fatalf("expected the group to be handed over, got %v, %v", role, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM user_groups WHERE id = $1", aloneID); count != 0 {
+		t.Fatalf("expected the group left empty to be deleted, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM join_links WHERE creator_id = $1", userID); count != 0 {
+		t.Fatalf("expected the join links to be deleted, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM data_exports WHERE user_id = $1", userID); count != 0 {
+		t.Fatalf("expected the data exports to be deleted, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM failed_logins WHERE email = $1", user.Email); count != 0 {
+		t.Fatalf("expected the failed logins to be deleted, got %d", count)
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecipientCoverage counts the gifts of an event for one of its participants.
+// Reservations of their wishlist items for the event count as gifts too.
+type RecipientCoverage struct {
+	UserID   string
+	Name     string
+	Honoree  bool
+	Proposed int
+	Reserved int
+	Bought   int
+}
+
+// giftCountColumn counts the gifts of the event $1 with status for the
+// participant.
+func giftCountColumn(status GiftStatus) string {
+	return fmt.Sprintf(
+		"(SELECT count(*) FROM gifts WHERE gifts.event_id = $1 AND gifts.content::jsonb->>'to' = participants.user_id::text AND (gifts.content::jsonb->>'status')::int = %d)",
+		status)
+}
+
+// wishlistCountColumn counts the reservations with status of the wishlist
+// items of the participant in the event $1.
+func wishlistCountColumn(status GiftStatus) string {
+	return fmt.Sprintf(
+		"(SELECT count(*) FROM wishlist_reservations JOIN wishlist_items ON wishlist_reservations.item_id = wishlist_items.id WHERE wishlist_reservations.event_id = $1 AND wishlist_items.user_id = participants.user_id AND wishlist_reservations.status = %d)",
+		status)
+}
+
+// ListRecipientCoverage returns how many gifts are proposed, reserved and
+// bought for each participant of an event, by name.
+func (s *store) ListRecipientCoverage(ctx context.Context, eventID string) ([]RecipientCoverage, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		participants.user_id,
+		users.name,
+		participants.honoree,
+		`+giftCountColumn(NewGiftStatus)+`,
+		`+giftCountColumn(AboutToBeBoughtGiftStatus)+` + `+wishlistCountColumn(AboutToBeBoughtGiftStatus)+`,
+		`+giftCountColumn(BoughtGiftStatus)+` + `+wishlistCountColumn(BoughtGiftStatus)+`
+    FROM participants
+    JOIN users ON participants.user_id = users.id
+    WHERE participants.event_id = $1
+	ORDER BY users.name, participants.user_id
+`,
+		eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recipient coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []RecipientCoverage
+
+	for rows.Next() {
+		var recipient RecipientCoverage
+		err = rows.Scan(&recipient.UserID, &recipient.Name, &recipient.Honoree, &recipient.Proposed, &recipient.Reserved, &recipient.Bought)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning recipient coverage: %w", err)
+		}
+
+		coverage = append(coverage, recipient)
+	}
+
+	return coverage, nil
+}
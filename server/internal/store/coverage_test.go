@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListRecipientCoverage(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf", "Hat", "Gloves")
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+
+	if err := s.UpdateGift(ctx, friendID, event.GiftIDs["Scarf"], eventID, BoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if err := s.UpdateGift(ctx, creatorID, event.GiftIDs["Hat"], eventID, MarkedForDeletionGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+
+	itemID, err := s.CreateWishlistItem(ctx, friendID, "Book", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, creatorID, eventID, itemID, AboutToBeBoughtGiftStatus, time.Now()); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+
+	coverage, err := s.ListRecipientCoverage(ctx, eventID)
+	if err != nil || len(coverage) != 2 {
+		t.Fatalf("ListRecipientCoverage() returned %v, %v", coverage, err)
+	}
+	for _, recipient := range coverage {
+		var expected RecipientCoverage
+		switch recipient.UserID {
+		case creatorID:
+			expected = RecipientCoverage{Proposed: 1, Bought: 1}
+		case friendID:
+			expected = RecipientCoverage{Reserved: 1}
+		}
+		if recipient.Proposed != expected.Proposed || recipient.Reserved != expected.Reserved || recipient.Bought != expected.Bought {
+			t.Fatalf("unexpected coverage %+v", recipient)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,38 +15,172 @@ type EventType int
 
 const (
 	ChristmasEventType = iota
+	BirthdayEventType
+	RegistryEventType
+	BabyShowerEventType
+	GenericEventType
 )
 
+// Valid tells whether t is a known event type.
+func (t EventType) Valid() bool {
+	return t >= ChristmasEventType && t <= GenericEventType
+}
+
+// HasHonorees tells whether the event is organized for some of its
+// participants, the honorees, who receive all of its gifts. Other events let
+// every participant offer gifts to every other one.
+func (t EventType) HasHonorees() bool {
+	return t == BirthdayEventType || t == RegistryEventType || t == BabyShowerEventType
+}
+
+// SingleHonoree tells whether the event has exactly one honoree.
+func (t EventType) SingleHonoree() bool {
+	return t == BirthdayEventType
+}
+
+// HonoreesSeeReservations tells whether honorees see which of their gifts are
+// reserved or bought, without knowing by whom, as with a wedding registry.
+func (t EventType) HonoreesSeeReservations() bool {
+	return t == RegistryEventType || t == BabyShowerEventType
+}
+
+// EventFilter selects the events returned by ListEvents.
+type EventFilter int
+
+const (
+	// ActiveEventFilter selects the events that are not archived.
+	ActiveEventFilter = iota
+	// UpcomingEventFilter selects the active events that did not happen yet.
+	UpcomingEventFilter
+	// PastEventFilter selects the active events that already happened.
+	PastEventFilter
+	// ArchivedEventFilter selects the archived events.
+	ArchivedEventFilter
+	// AllEventFilter selects every event.
+	AllEventFilter
+)
+
+// condition returns the SQL condition on events selecting the filtered
+// events at now.
+func (f EventFilter) condition(now time.Time) (string, []any) {
+	switch f {
+	case UpcomingEventFilter:
+		return "events.archived_at IS NULL AND events.date >= $2", []any{now.UTC()}
+	case PastEventFilter:
+		return "events.archived_at IS NULL AND events.date < $2", []any{now.UTC()}
+	case ArchivedEventFilter:
+		return "events.archived_at IS NOT NULL", nil
+	case AllEventFilter:
+		return "true", nil
+	default:
+		return "events.archived_at IS NULL", nil
+	}
+}
+
 type ParticipantRole int
 
 const (
+	// OwnerParticipantRole lets a participant manage the event along with its
+	// creator: add and remove participants, share join links, edit, archive
+	// and roll over the event.
 	OwnerParticipantRole = iota
+	// MemberParticipantRole only lets a participant take part in the event.
+	MemberParticipantRole
 )
 
+// Valid tells whether r is a known participant role.
+func (r ParticipantRole) Valid() bool {
+	return r == OwnerParticipantRole || r == MemberParticipantRole
+}
+
 type Event struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	CreatorName string    `json:"creator_name"`
-	Date        time.Time `json:"date"`
-	Type        EventType `json:"event_type"`
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	CreatorName string         `json:"creator_name"`
+	Date        time.Time      `json:"date"`
+	Type        EventType      `json:"event_type"`
+	Description string         `json:"description"`
+	ArchivedAt  *time.Time     `json:"archived_at,omitempty"`
+	HonoreeIDs  []string       `json:"honoree_ids"`
+	CreatorID   string         `json:"creator_id"`
+	Recurrence  RecurrenceRule `json:"recurrence"`
+	// RecurrenceDate is the date the occurrences of a recurring event are
+	// anniversaries of.
+	RecurrenceDate *time.Time `json:"recurrence_date,omitempty"`
+	// NextEventID is the next occurrence of the event, once rolled over.
+	NextEventID *string `json:"next_event_id,omitempty"`
 }
 
-func (s *store) ListEvents(ctx context.Context, userID string) ([]Event, error) {
+// IsHonoree tells whether userID is one of the honorees of the event.
+func (e Event) IsHonoree(userID string) bool {
+	return slices.Contains(e.HonoreeIDs, userID)
+}
+
+// honoreeIDsColumn selects the comma separated honorees of events.
+const honoreeIDsColumn = `coalesce((SELECT string_agg(honorees.user_id::text, ',') FROM participants honorees WHERE honorees.event_id = events.id AND honorees.honoree), '')`
+
+func splitHonoreeIDs(honoreeIDs string) []string {
+	if honoreeIDs == "" {
+		return []string{}
+	}
+	return strings.Split(honoreeIDs, ",")
+}
+
+// eventColumns are the columns scanned by scanEvent, from events joined with
+// the users who created them.
+const eventColumns = `
+		events.id,
+		events.creator_id,
+		events.name,
+		events.date,
+		events.type,
+		events.description,
+		events.archived_at,
+		users.name,
+		` + honoreeIDsColumn + `,
+		events.recurrence,
+		events.recurrence_date,
+		events.next_event_id`
+
+func scanEvent(row interface{ Scan(dest ...any) error }) (Event, error) {
+	var (
+		event          Event
+		archivedAt     sql.NullTime
+		honoreeIDs     string
+		recurrenceDate sql.NullTime
+		nextEventID    sql.NullString
+	)
+	err := row.Scan(&event.ID, &event.CreatorID, &event.Name, &event.Date, &event.Type, &event.Description, &archivedAt, &event.CreatorName, &honoreeIDs, &event.Recurrence, &recurrenceDate, &nextEventID)
+	if err != nil {
+		return Event{}, err
+	}
+	event.HonoreeIDs = splitHonoreeIDs(honoreeIDs)
+	if archivedAt.Valid {
+		event.ArchivedAt = &archivedAt.Time
+	}
+	if recurrenceDate.Valid {
+		event.RecurrenceDate = &recurrenceDate.Time
+	}
+	if nextEventID.Valid {
+		event.NextEventID = &nextEventID.String
+	}
+	return event, nil
+}
+
+// ListEvents returns the events userID participates in selected by filter at
+// now.
+func (s *store) ListEvents(ctx context.Context, userID string, filter EventFilter, now time.Time) ([]Event, error) {
+	condition, args := filter.condition(now)
 	rows, err := s.db.QueryContext(
 		ctx,
 		`
-	SELECT 
-		events.id, 
-		events.name, 
-		events.date, 
-		events.type, 
-		users.name
+	SELECT `+eventColumns+`
     FROM events 
     JOIN users ON events.creator_id = users.id
     JOIN participants ON events.id = participants.event_id
-    WHERE participants.user_id = $1
+    WHERE participants.user_id = $1 AND `+condition+`
 `,
-		userID)
+		append([]any{userID}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list events: %w", err)
 	}
@@ -51,8 +189,7 @@ func (s *store) ListEvents(ctx context.Context, userID string) ([]Event, error)
 	var events []Event
 
 	for rows.Next() {
-		var event Event
-		err = rows.Scan(&event.ID, &event.Name, &event.Date, &event.Type, &event.CreatorName)
+		event, err := scanEvent(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning event: %w", err)
 		}
@@ -67,37 +204,130 @@ func (s *store) ListEvents(ctx context.Context, userID string) ([]Event, error)
 	return events, nil
 }
 
-func (s *store) CreateEvent(ctx context.Context, userID string, eventName string, eventDate time.Time) (finalErr error) {
-	txn, err := s.db.BeginTx(ctx, nil)
+func (s *store) GetEvent(ctx context.Context, eventID string) (*Event, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`
+	SELECT `+eventColumns+`
+    FROM events
+    JOIN users ON events.creator_id = users.id
+    WHERE events.id = $1
+`,
+		eventID)
+	event, err := scanEvent(row)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get event: %w", err)
 	}
 
-	defer func() {
-		if finalErr != nil {
-			errRollback := txn.Rollback()
-			if errRollback != nil {
-				finalErr = fmt.Errorf("error rolling back transaction: %w (after %w)", errRollback, err)
-			}
-			finalErr = fmt.Errorf("error running transaction: %w", err)
+	return &event, nil
+}
+
+// CreateEvent creates an event owned by userID. Events with honorees get the
+// users with honoreeEmails as honorees, or their creator if there is none.
+// Recurring events repeat on the anniversaries of recurrenceDate. It returns
+// the ID of the event.
+func (s *store) CreateEvent(ctx context.Context, userID string, eventName string, eventDate time.Time, eventDescription string, eventType EventType, honoreeEmails []string, recurrence RecurrenceRule, recurrenceDate time.Time) (string, error) {
+	var honoreeIDs []string
+	for _, email := range honoreeEmails {
+		honoreeID, err := s.findParticipantByEmail(ctx, email)
+		if err != nil {
+			return "", err
 		}
-	}()
+		if !slices.Contains(honoreeIDs, honoreeID) {
+			honoreeIDs = append(honoreeIDs, honoreeID)
+		}
+	}
+	if eventType.HasHonorees() && len(honoreeIDs) == 0 {
+		honoreeIDs = []string{userID}
+	}
 
 	var eventID string
-	err = s.db.QueryRowContext(ctx, "INSERT INTO events (creator_id, name, date, type) VALUES ($1, $2, $3, $4) RETURNING id", userID, eventName, eventDate, ChristmasEventType).Scan(&eventID)
+	err := s.withTx(ctx, func(s *store) error {
+		err := s.db.QueryRowContext(ctx, "INSERT INTO events (creator_id, name, date, description, type, recurrence, recurrence_date) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", userID, eventName, eventDate, eventDescription, eventType, recurrence, recurrence.date(recurrenceDate)).Scan(&eventID)
+		if err != nil {
+			return fmt.Errorf("failed to create event: %w", err)
+		}
+
+		var participantID string
+		err = s.db.QueryRowContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role, honoree) VALUES ($1, $2, $3, $4) RETURNING id", userID, eventID, OwnerParticipantRole, slices.Contains(honoreeIDs, userID)).Scan(&participantID)
+		if err != nil {
+			return fmt.Errorf("failed to create participant: %w", err)
+		}
+
+		for _, honoreeID := range honoreeIDs {
+			if honoreeID == userID {
+				continue
+			}
+			err = s.db.QueryRowContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role, honoree) VALUES ($1, $2, $3, true) RETURNING id", honoreeID, eventID, MemberParticipantRole).Scan(&participantID)
+			if err != nil {
+				return fmt.Errorf("failed to create honoree: %w", err)
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create event: %w", err)
+		return "", err
 	}
 
-	var participantID string
-	err = s.db.QueryRowContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role) VALUES ($1, $2, $3) RETURNING id", userID, eventID, OwnerParticipantRole).Scan(&participantID)
+	return eventID, nil
+}
+
+// UpdateEvent updates the details of an event. Yearly events then recur on
+// their new date. An event changed to a type with honorees gets its creator as
+// honoree if it has none.
+func (s *store) UpdateEvent(ctx context.Context, eventID string, eventName string, eventDate time.Time, eventDescription string, eventType EventType) error {
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(
+			ctx,
+			"UPDATE events SET name = $1, date = $2, description = $3, type = $4, recurrence_date = CASE WHEN recurrence = $5 THEN $6 ELSE recurrence_date END WHERE id = $7",
+			eventName, eventDate, eventDescription, eventType, YearlyRecurrence, RecurrenceRule(YearlyRecurrence).date(eventDate), eventID)
+		if err != nil {
+			return fmt.Errorf("failed to update event: %w", err)
+		}
+
+		if eventType.HasHonorees() {
+			_, err = s.db.ExecContext(
+				ctx,
+				`
+		UPDATE participants SET honoree = true
+		FROM events
+		WHERE participants.event_id = events.id AND participants.user_id = events.creator_id AND events.id = $1
+			AND NOT EXISTS (SELECT 1 FROM participants honorees WHERE honorees.event_id = $1 AND honorees.honoree)
+	`,
+				eventID)
+			if err != nil {
+				return fmt.Errorf("failed to set honoree: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ArchiveEvent archives an event at now, hiding it from the default listing,
+// or unarchives it when now is nil.
+func (s *store) ArchiveEvent(ctx context.Context, eventID string, now *time.Time) error {
+	var archivedAt sql.NullTime
+	if now != nil {
+		archivedAt = sql.NullTime{Time: now.UTC(), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, "UPDATE events SET archived_at = $1 WHERE id = $2", archivedAt, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to create participant: %w", err)
+		return fmt.Errorf("failed to archive event: %w", err)
 	}
+	return nil
+}
 
-	if err := txn.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+// DeleteEvent deletes an event along with its participants, gifts and their
+// comments.
+func (s *store) DeleteEvent(ctx context.Context, eventID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM events WHERE id = $1", eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreateEventHonorees(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	creatorID := createTestUser(t, s, "honorees-creator@example.com")
+	honoreeID := createTestUser(t, s, "honorees-honoree@example.com")
+
+	tests := []struct {
+		name          string
+		eventType     EventType
+		honoreeEmails []string
+		honoreeIDs    []string
+	}{
+		{"christmas has no honorees", ChristmasEventType, nil, []string{}},
+		{"birthday defaults to its creator", BirthdayEventType, nil, []string{creatorID}},
+		{"birthday of somebody else", BirthdayEventType, []string{"honorees-honoree@example.com"}, []string{honoreeID}},
+		{"registry of a couple", RegistryEventType, []string{"honorees-creator@example.com", "honorees-honoree@example.com"}, []string{creatorID, honoreeID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventID, err := s.CreateEvent(ctx, creatorID, tt.name, time.Now(), "", tt.eventType, tt.honoreeEmails, NoRecurrence, time.Time{})
+			if err != nil {
+				t.Fatalf("CreateEvent() returned %v", err)
+			}
+			event, err := s.GetEvent(ctx, eventID)
+			if err != nil || event == nil {
+				t.Fatalf("GetEvent() returned %v, %v", event, err)
+			}
+			if event.Type != tt.eventType {
+				t.Fatalf("expected type %d, got %d", tt.eventType, event.Type)
+			}
+			if len(event.HonoreeIDs) != len(tt.honoreeIDs) {
+				t.Fatalf("expected honorees %v, got %v", tt.honoreeIDs, event.HonoreeIDs)
+			}
+			for _, id := range tt.honoreeIDs {
+				if !event.IsHonoree(id) {
+					t.Fatalf("expected honorees %v, got %v", tt.honoreeIDs, event.HonoreeIDs)
+				}
+			}
+			// honorees take part in the event
+			for _, id := range tt.honoreeIDs {
+				if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", eventID, id); count != 1 {
+					t.Fatalf("expected honoree %s to participate, got %d rows", id, count)
+				}
+				// only the creator owns the event
+				want := MemberParticipantRole
+				if id == creatorID {
+					want = OwnerParticipantRole
+				}
+				if role, _, err := s.GetParticipantRole(ctx, eventID, id); err != nil || role != ParticipantRole(want) {
+					t.Fatalf("GetParticipantRole() returned %v, %v for honoree %s", role, err, id)
+				}
+			}
+		})
+	}
+
+	if _, err := s.CreateEvent(ctx, creatorID, "Unknown", time.Now(), "", BirthdayEventType, []string{"nobody@example.com"}, NoRecurrence, time.Time{}); !IsUnknownParticipantError(err) {
+		t.Fatalf("expected an unknown honoree to be refused, got %v", err)
+	}
+}
+
+func TestUpdateEventMovesYearlyRecurrence(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2025, time.December, 25, 0, 0, 0, 0, time.UTC)
+	newDate := time.Date(2025, time.December, 24, 0, 0, 0, 0, time.UTC)
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "update-event@example.com")
+
+	eventID, err := s.CreateEvent(ctx, userID, "Christmas", date, "", ChristmasEventType, nil, YearlyRecurrence, date)
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.UpdateEvent(ctx, eventID, "Christmas Eve", newDate, "At home", ChristmasEventType); err != nil {
+		t.Fatalf("UpdateEvent() returned %v", err)
+	}
+
+	event, err := s.GetEvent(ctx, eventID)
+	if err != nil || event == nil {
+		t.Fatalf("GetEvent() returned %v, %v", event, err)
+	}
+	if event.Name != "Christmas Eve" || !event.Date.Equal(newDate) || event.Description != "At home" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event.RecurrenceDate == nil || !event.RecurrenceDate.Equal(newDate) {
+		t.Fatalf("expected the event to recur on %s, got %v", newDate, event.RecurrenceDate)
+	}
+
+	// a birthday keeps recurring on the birth date
+	birthDate := time.Date(1990, time.March, 3, 0, 0, 0, 0, time.UTC)
+	birthdayID, err := s.CreateEvent(ctx, userID, "Birthday", date, "", BirthdayEventType, nil, BirthdayRecurrence, birthDate)
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.UpdateEvent(ctx, birthdayID, "Birthday", newDate, "", BirthdayEventType); err != nil {
+		t.Fatalf("UpdateEvent() returned %v", err)
+	}
+	birthday, err := s.GetEvent(ctx, birthdayID)
+	if err != nil || birthday == nil || birthday.RecurrenceDate == nil || !birthday.RecurrenceDate.Equal(birthDate) {
+		t.Fatalf("expected the birthday to recur on %s, got %+v, %v", birthDate, birthday, err)
+	}
+}
+
+func TestListEventsFilters(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "filters@example.com")
+
+	eventIDs := map[string]string{}
+	for name, date := range map[string]time.Time{
+		"upcoming": now.AddDate(0, 1, 0),
+		"past":     now.AddDate(0, -1, 0),
+		"archived": now.AddDate(0, -2, 0),
+		"deleted":  now.AddDate(0, -3, 0),
+	} {
+		eventID, err := s.CreateEvent(ctx, userID, name, date, "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+		if err != nil {
+			t.Fatalf("CreateEvent() returned %v", err)
+		}
+		eventIDs[name] = eventID
+	}
+	if err := s.ArchiveEvent(ctx, eventIDs["archived"], &now); err != nil {
+		t.Fatalf("ArchiveEvent() returned %v", err)
+	}
+	if err := s.DeleteEvent(ctx, eventIDs["deleted"]); err != nil {
+		t.Fatalf("DeleteEvent() returned %v", err)
+	}
+
+	tests := []struct {
+		filter EventFilter
+		names  []string
+	}{
+		{ActiveEventFilter, []string{"upcoming", "past"}},
+		{UpcomingEventFilter, []string{"upcoming"}},
+		{PastEventFilter, []string{"past"}},
+		{ArchivedEventFilter, []string{"archived"}},
+		{AllEventFilter, []string{"upcoming", "past", "archived"}},
+	}
+	for _, tt := range tests {
+		events, err := s.ListEvents(ctx, userID, tt.filter, now)
+		if err != nil {
+			t.Fatalf("ListEvents(%d) returned %v", tt.filter, err)
+		}
+		names := map[string]bool{}
+		for _, event := range events {
+			names[event.Name] = true
+		}
+		if len(names) != len(tt.names) {
+			t.Fatalf("ListEvents(%d) returned %v, expected %v", tt.filter, names, tt.names)
+		}
+		for _, name := range tt.names {
+			if !names[name] {
+				t.Fatalf("ListEvents(%d) returned %v, expected %v", tt.filter, names, tt.names)
+			}
+		}
+	}
+
+	// unarchived events are listed again
+	if err := s.ArchiveEvent(ctx, eventIDs["archived"], nil); err != nil {
+		t.Fatalf("ArchiveEvent() returned %v", err)
+	}
+	events, err := s.ListEvents(ctx, userID, ArchivedEventFilter, now)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no archived event left, got %v, %v", events, err)
+	}
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type DataExportStatus int
+
+const (
+	PendingDataExportStatus = iota
+	ReadyDataExportStatus
+	FailedDataExportStatus
+)
+
+// DataExport is an export of the personal data of a user, generated in the
+// background for large accounts.
+type DataExport struct {
+	ID        string
+	Status    DataExportStatus
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// UserGift is a gift along with the event it belongs to.
+type UserGift struct {
+	Gift
+	EventName string
+	EventDate time.Time
+	EventType EventType
+	// WishlistItem tells whether the gift is a wishlist item reserved in the
+	// event, in which case its ID is the one of the item and its creator is
+	// the owner of the wishlist.
+	WishlistItem bool
+}
+
+// UserComment is a comment along with the gift it was written on.
+type UserComment struct {
+	Comment
+	GiftID  string
+	EventID string
+}
+
+// CountUserData returns the number of gifts, comments and wishlist
+// reservations involving the user, to estimate how large their export is.
+func (s *store) CountUserData(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(
+		ctx,
+		`
+	SELECT
+		(SELECT count(*) FROM gifts WHERE creator_id = $1 OR content::jsonb->>'to' = $2 OR content::jsonb->>'from' = $2)
+		+ (SELECT count(*) FROM comments WHERE author_id = $1)
+		+ (SELECT count(*) FROM wishlist_reservations JOIN wishlist_items ON wishlist_reservations.item_id = wishlist_items.id WHERE wishlist_reservations.buyer_id = $1 OR wishlist_items.user_id = $1)
+`,
+		userID, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count user data: %w", err)
+	}
+	return count, nil
+}
+
+// ListUserGifts returns the gifts the user created, is the recipient of or
+// is the buyer of, across all events.
+func (s *store) ListUserGifts(ctx context.Context, userID string) ([]UserGift, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		gifts.id,
+		gifts.creator_id,
+		gifts.event_id,
+		gifts.created_at,
+		gifts.content,
+		events.name,
+		events.date,
+		events.type
+    FROM gifts
+    JOIN events ON gifts.event_id = events.id
+    WHERE gifts.creator_id = $1 OR gifts.content::jsonb->>'to' = $2 OR gifts.content::jsonb->>'from' = $2
+	ORDER BY gifts.created_at ASC
+`,
+		userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user gifts: %w", err)
+	}
+	defer rows.Close()
+
+	var gifts []UserGift
+
+	for rows.Next() {
+		var (
+			gift             UserGift
+			giftContentBytes []byte
+		)
+		err = rows.Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes, &gift.EventName, &gift.EventDate, &gift.EventType)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &gift.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, nil
+}
+
+// ListUserWishlistReservations returns the reservations of wishlist items the
+// user holds or that are on their own items, across all events. They look like
+// gifts addressed to the owner of the wishlist, see UserGift.
+func (s *store) ListUserWishlistReservations(ctx context.Context, userID string) ([]UserGift, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		wishlist_items.id,
+		wishlist_items.user_id,
+		wishlist_reservations.event_id,
+		wishlist_items.created_at,
+		jsonb_build_object(
+			'name', wishlist_items.name,
+			'status', wishlist_reservations.status,
+			'to', wishlist_items.user_id::text,
+			'from', wishlist_reservations.buyer_id::text,
+			'urls', wishlist_items.urls::jsonb
+		)::text,
+		events.name,
+		events.date,
+		events.type
+	FROM wishlist_reservations
+	JOIN wishlist_items ON wishlist_reservations.item_id = wishlist_items.id
+	JOIN events ON wishlist_reservations.event_id = events.id
+	WHERE wishlist_reservations.buyer_id = $1 OR wishlist_items.user_id = $1
+	ORDER BY wishlist_reservations.updated_at ASC
+`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user wishlist reservations: %w", err)
+	}
+	defer rows.Close()
+
+	var gifts []UserGift
+
+	for rows.Next() {
+		var (
+			gift             = UserGift{WishlistItem: true}
+			giftContentBytes []byte
+		)
+		err = rows.Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes, &gift.EventName, &gift.EventDate, &gift.EventType)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning wishlist reservation: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &gift.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal wishlist reservation: %w", err)
+		}
+
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, nil
+}
+
+// ListUserComments returns the comments written by the user.
+func (s *store) ListUserComments(ctx context.Context, userID string) ([]UserComment, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		comments.id,
+		comments.message,
+		comments.created_at,
+		comments.gift_id,
+		gifts.event_id
+    FROM comments
+    JOIN gifts ON comments.gift_id = gifts.id
+    WHERE comments.author_id = $1
+	ORDER BY comments.created_at ASC
+`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []UserComment
+
+	for rows.Next() {
+		var comment UserComment
+		err = rows.Scan(&comment.ID, &comment.Message, &comment.CreatedAt, &comment.GiftID, &comment.EventID)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning comment: %w", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// CreateDataExport starts a background export for the user, after failing
+// their exports pending since before staleBefore. It returns false if another
+// export of the user is already pending.
+func (s *store) CreateDataExport(ctx context.Context, userID string, staleBefore time.Time) (string, bool, error) {
+	var exportID string
+	err := s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(ctx, "UPDATE data_exports SET status = $1 WHERE user_id = $2 AND status = $3 AND created_at < $4", FailedDataExportStatus, userID, PendingDataExportStatus, staleBefore.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to fail stale data exports: %w", err)
+		}
+
+		// a user has at most one pending export, concurrent requests share it
+		err = s.db.QueryRowContext(
+			ctx,
+			"INSERT INTO data_exports (user_id, status, created_at) VALUES ($1, $2, $3) ON CONFLICT (user_id) WHERE status = 0 DO NOTHING RETURNING id",
+			userID, PendingDataExportStatus, time.Now().UTC()).Scan(&exportID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to create data export: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return exportID, exportID != "", nil
+}
+
+func (s *store) CompleteDataExport(ctx context.Context, exportID string, content []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE data_exports SET status = $1, content = $2, expires_at = $3 WHERE id = $4", ReadyDataExportStatus, content, expiresAt.UTC(), exportID)
+	if err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+func (s *store) FailDataExport(ctx context.Context, exportID string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE data_exports SET status = $1 WHERE id = $2", FailedDataExportStatus, exportID)
+	if err != nil {
+		return fmt.Errorf("failed to fail data export: %w", err)
+	}
+	return nil
+}
+
+// GetLatestDataExport returns the most recent export of the user, or nil.
+func (s *store) GetLatestDataExport(ctx context.Context, userID string) (*DataExport, error) {
+	var (
+		export    DataExport
+		expiresAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT id, status, created_at, expires_at FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1", userID).Scan(&export.ID, &export.Status, &export.CreatedAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+	return &export, nil
+}
+
+// GetDataExportContent returns the zip of a ready export of the user that
+// did not expire at now, or nil.
+func (s *store) GetDataExportContent(ctx context.Context, userID string, exportID string, now time.Time) ([]byte, error) {
+	var content []byte
+	err := s.db.QueryRowContext(ctx, "SELECT content FROM data_exports WHERE id = $1 AND user_id = $2 AND status = $3 AND expires_at > $4", exportID, userID, ReadyDataExportStatus, now.UTC()).Scan(&content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get data export content: %w", err)
+	}
+	return content, nil
+}
+
+// DeleteExpiredDataExports deletes the exports expired at now, along with
+// the failed ones and the ones pending since before staleBefore.
+func (s *store) DeleteExpiredDataExports(ctx context.Context, now time.Time, staleBefore time.Time) (int64, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM data_exports WHERE expires_at <= $1 OR status = $2 OR (status = $3 AND created_at < $4)",
+		now.UTC(), FailedDataExportStatus, PendingDataExportStatus, staleBefore.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired data exports: %w", err)
+	}
+	return result.RowsAffected()
+}
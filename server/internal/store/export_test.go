@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreateDataExportSharesPendingExport(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "export@example.com")
+	staleBefore := time.Now().Add(-time.Hour)
+
+	exportID, created, err := s.CreateDataExport(ctx, userID, staleBefore)
+	if err != nil || !created {
+		t.Fatalf("CreateDataExport() returned %s, %v, %v", exportID, created, err)
+	}
+	_, created, err = s.CreateDataExport(ctx, userID, staleBefore)
+	if err != nil || created {
+		t.Fatalf("expected the pending export to be shared, got %v, %v", created, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM data_exports WHERE user_id = $1", userID); count != 1 {
+		t.Fatalf("expected a single export, got %d", count)
+	}
+
+	// a stale export no longer blocks new ones
+	newExportID, created, err := s.CreateDataExport(ctx, userID, time.Now().Add(time.Hour))
+	if err != nil || !created || newExportID == exportID {
+		t.Fatalf("expected a new export once the pending one is stale, got %s, %v, %v", newExportID, created, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM data_exports WHERE id = $1 AND status = $2", exportID, FailedDataExportStatus); count != 1 {
+		t.Fatal("expected the stale export to fail")
+	}
+}
+
+func TestListUserWishlistReservations(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	strangerID := createTestUser(t, s, "wishlist-reservations-stranger@example.com")
+
+	itemID, err := s.CreateWishlistItem(ctx, event.CreatorID, "Book", []string{"https://example.com/book"})
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, event.FriendID, event.ID, itemID, BoughtGiftStatus, time.Now()); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+
+	// both the owner of the item and its buyer find the reservation
+	for _, userID := range []string{event.CreatorID, event.FriendID} {
+		reservations, err := s.ListUserWishlistReservations(ctx, userID)
+		if err != nil || len(reservations) != 1 {
+			t.Fatalf("ListUserWishlistReservations() returned %v, %v for user %s", reservations, err, userID)
+		}
+		reservation := reservations[0]
+		if !reservation.WishlistItem || reservation.ID != itemID || reservation.EventID != event.ID {
+			t.Fatalf("unexpected reservation %+v", reservation)
+		}
+		if reservation.Content.ToID != event.CreatorID || reservation.Content.FromID == nil || *reservation.Content.FromID != event.FriendID || reservation.Content.Status != BoughtGiftStatus {
+			t.Fatalf("unexpected reservation content %+v", reservation.Content)
+		}
+	}
+	if reservations, err := s.ListUserWishlistReservations(ctx, strangerID); err != nil || len(reservations) != 0 {
+		t.Fatalf("expected a stranger to find no reservation, got %v, %v", reservations, err)
+	}
+}
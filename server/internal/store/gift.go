@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"time"
 )
@@ -26,6 +27,9 @@ type Gift struct {
 	CreatorID string
 	EventID   string
 	Content   GiftContent `json:"content"`
+	// DeletedAt is when the gift was put in the trash, only set by
+	// ListTrashedGifts.
+	DeletedAt *time.Time
 }
 
 // how we serialize the content field in the gifts table
@@ -36,8 +40,44 @@ type GiftContent struct {
 	FromID *string    `json:"from"`
 	URLs   []string   `json:"urls"`
 	Secret bool       `json:"secret"`
+	// Priority tells how much the gift is wanted, from 1 to MaxGiftPriority,
+	// 0 if unset.
+	Priority int `json:"priority,omitempty"`
+	// Price is the price of the gift in cents, 0 if unknown.
+	Price int64 `json:"price,omitempty"`
+	// Idea tells whether the gift is an idea for its recipient, which they
+	// never see. Ideas are voted on until one is promoted to a gift.
+	Idea bool `json:"idea,omitempty"`
+	// Purchase tracks the gift once bought, for its buyer only.
+	Purchase *GiftPurchase `json:"purchase,omitempty"`
+	// Trashed is the gift as it was before being put in the trash, which
+	// RestoreGift brings back.
+	Trashed *TrashedGift `json:"trashed,omitempty"`
 }
 
+// TrashedGift is what a gift loses when put in the trash.
+type TrashedGift struct {
+	Status   GiftStatus    `json:"status"`
+	FromID   *string       `json:"from"`
+	Purchase *GiftPurchase `json:"purchase,omitempty"`
+}
+
+// trashGift puts a gift in the trash, keeping its status and buyer for when
+// it is restored.
+func trashGift(content *GiftContent) {
+	content.Trashed = &TrashedGift{
+		Status:   content.Status,
+		FromID:   content.FromID,
+		Purchase: content.Purchase,
+	}
+	content.Status = MarkedForDeletionGiftStatus
+	content.FromID = nil
+	content.Purchase = nil
+}
+
+// MaxGiftPriority is the priority of the most wanted gifts.
+const MaxGiftPriority = 3
+
 func (s *store) ListGifts(ctx context.Context, userID, eventID string) ([]Gift, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
@@ -109,6 +149,31 @@ func (s *store) HasGift(ctx context.Context, eventID string, giftID string) (boo
 	return true, nil
 }
 
+// GetGift returns the gift of an event with giftID, nil if there is none.
+func (s *store) GetGift(ctx context.Context, eventID string, giftID string) (*Gift, error) {
+	var (
+		gift             Gift
+		giftContentBytes []byte
+	)
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT id, creator_id, event_id, created_at, content FROM gifts WHERE id = $1 AND event_id = $2",
+		giftID, eventID).Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get gift: %w", err)
+	}
+
+	err = json.Unmarshal(giftContentBytes, &gift.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+	}
+
+	return &gift, nil
+}
+
 func (s *store) CreateGift(
 	ctx context.Context,
 	userID string,
@@ -118,14 +183,16 @@ func (s *store) CreateGift(
 	urls []string,
 	secret bool,
 ) error {
-	content := GiftContent{
+	return s.createGift(ctx, userID, eventID, GiftContent{
 		Name:   name,
 		Status: NewGiftStatus,
 		ToID:   toUserID,
 		URLs:   urls,
 		Secret: secret,
-	}
+	})
+}
 
+func (s *store) createGift(ctx context.Context, userID string, eventID string, content GiftContent) error {
 	contentMarshalled, err := json.Marshal(content)
 	if err != nil {
 		return fmt.Errorf("failed to marshal gift content: %w", err)
@@ -139,42 +206,472 @@ func (s *store) CreateGift(
 	return nil
 }
 
+// UpdateGift sets the status of a gift on behalf of userID. Reserving or
+// buying it records userID as its buyer, which the shopping list is built
+// from, while any other status releases it. A gift reserved or bought by
+// somebody else cannot be taken over.
 func (s *store) UpdateGift(ctx context.Context, userID string, giftID string, eventID string, status GiftStatus) error {
-	var contentMarshalled []byte
-	err := s.db.QueryRowContext(
-		ctx,
-		`
+	return s.withTx(ctx, func(s *store) error {
+		// lock the gift so that two users cannot both become its buyer
+		var contentMarshalled []byte
+		err := s.db.QueryRowContext(
+			ctx,
+			`
 	SELECT 
 		content
 	FROM gifts
     WHERE id = $1 AND event_id = $2
+	FOR UPDATE
 `,
-		giftID, eventID).Scan(&contentMarshalled)
+			giftID, eventID).Scan(&contentMarshalled)
+		if err != nil {
+			return fmt.Errorf("failed to get gift: %w", err)
+		}
+
+		var giftContent GiftContent
+
+		err = json.Unmarshal(contentMarshalled, &giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+
+		if giftContent.Status == MarkedForDeletionGiftStatus {
+			// trashed gifts come back through RestoreGift only
+			return errors.New("gift is in the trash")
+		}
+		if (giftContent.Status == AboutToBeBoughtGiftStatus || giftContent.Status == BoughtGiftStatus) && giftContent.FromID != nil && *giftContent.FromID != userID {
+			return errors.New("gift already has a buyer")
+		}
+		if giftContent.Idea && (status == AboutToBeBoughtGiftStatus || status == BoughtGiftStatus) {
+			// ideas are reserved by promoting them
+			return errors.New("gift is an idea")
+		}
+		switch {
+		case status == MarkedForDeletionGiftStatus:
+			trashGift(&giftContent)
+		case status == AboutToBeBoughtGiftStatus || status == BoughtGiftStatus:
+			giftContent.FromID = &userID
+		default:
+			giftContent.FromID = nil
+		}
+		if status != BoughtGiftStatus {
+			giftContent.Purchase = nil
+		}
+		giftContent.Status = status
+
+		contentMarshalled, err = json.Marshal(giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal gift content: %w", err)
+		}
+		var deletedAt *time.Time
+		if status == MarkedForDeletionGiftStatus {
+			now := time.Now().UTC()
+			deletedAt = &now
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1, deleted_at = $2 where id = $3", contentMarshalled, deletedAt, giftID)
+		if err != nil {
+			return fmt.Errorf("failed to update gift: %w", err)
+		}
+		return nil
+	})
+}
+
+// updateGiftContents applies update to the content of the gifts selected by
+// query, which must select their id and content, and saves the ones it
+// changed.
+func (s *store) updateGiftContents(ctx context.Context, update func(content *GiftContent) bool, query string, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list gifts: %w", err)
+	}
+	updated := make(map[string][]byte)
+	for rows.Next() {
+		var (
+			giftID           string
+			giftContent      GiftContent
+			giftContentBytes []byte
+		)
+		if err := rows.Scan(&giftID, &giftContentBytes); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning gift: %w", err)
+		}
+		if err := json.Unmarshal(giftContentBytes, &giftContent); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+		if !update(&giftContent) {
+			continue
+		}
+		contentMarshalled, err := json.Marshal(giftContent)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to marshal gift content: %w", err)
+		}
+		updated[giftID] = contentMarshalled
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list gifts: %w", err)
+	}
+
+	for giftID, content := range updated {
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1 WHERE id = $2", content, giftID)
+		if err != nil {
+			return fmt.Errorf("failed to update gift: %w", err)
+		}
+	}
+	return nil
+}
+
+// releaseReservation makes a gift reserved but not bought yet available
+// again.
+func releaseReservation(content *GiftContent) bool {
+	if content.Status != AboutToBeBoughtGiftStatus {
+		return false
+	}
+	content.Status = NewGiftStatus
+	content.FromID = nil
+	return true
+}
+
+// GiftTransfer tells how TransferGifts carries gifts over to another event.
+type GiftTransfer struct {
+	// Move moves the gifts, instead of copying them.
+	Move bool
+	// KeepReservations keeps who reserved or bought the gifts, provided they
+	// participate in the target event. Otherwise the gifts are available
+	// again.
+	KeepReservations bool
+	KeepURLs         bool
+	KeepComments     bool
+}
+
+// TransferGifts copies or moves the gifts with giftIDs from an event to
+// another on behalf of userID, who creates the copies. Gifts that are not in
+// the source event are skipped. It returns the IDs of the gifts in the target
+// event.
+func (s *store) TransferGifts(ctx context.Context, userID string, giftIDs []string, fromEventID string, toEventID string, transfer GiftTransfer) ([]string, error) {
+	var transferredIDs []string
+	err := s.withTx(ctx, func(s *store) error {
+		participants, err := s.GetEventParticipants(ctx, toEventID)
+		if err != nil {
+			return err
+		}
+		isParticipant := make(map[string]bool)
+		for _, participant := range participants {
+			isParticipant[participant.ID] = true
+		}
+
+		for _, giftID := range giftIDs {
+			var contentMarshalled []byte
+			// lock the gift so that its reservation does not change meanwhile
+			err := s.db.QueryRowContext(ctx, "SELECT content FROM gifts WHERE id = $1 AND event_id = $2 FOR UPDATE", giftID, fromEventID).Scan(&contentMarshalled)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				return fmt.Errorf("failed to get gift: %w", err)
+			}
+
+			var giftContent GiftContent
+			err = json.Unmarshal(contentMarshalled, &giftContent)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal gift content: %w", err)
+			}
+
+			if !transfer.KeepReservations || giftContent.FromID == nil || !isParticipant[*giftContent.FromID] {
+				if giftContent.Status == AboutToBeBoughtGiftStatus || giftContent.Status == BoughtGiftStatus {
+					giftContent.Status = NewGiftStatus
+				}
+				giftContent.FromID = nil
+				giftContent.Purchase = nil
+			}
+			if !transfer.KeepURLs {
+				giftContent.URLs = nil
+			}
+
+			contentMarshalled, err = json.Marshal(giftContent)
+			if err != nil {
+				return fmt.Errorf("failed to marshal gift content: %w", err)
+			}
+
+			if transfer.Move {
+				_, err = s.db.ExecContext(ctx, "UPDATE gifts SET event_id = $1, content = $2 WHERE id = $3", toEventID, contentMarshalled, giftID)
+				if err != nil {
+					return fmt.Errorf("failed to move gift: %w", err)
+				}
+				if !transfer.KeepComments {
+					_, err = s.db.ExecContext(ctx, "DELETE FROM comments WHERE gift_id = $1", giftID)
+					if err != nil {
+						return fmt.Errorf("failed to delete comments: %w", err)
+					}
+				}
+				transferredIDs = append(transferredIDs, giftID)
+				continue
+			}
+
+			var copyID string
+			err = s.db.QueryRowContext(ctx, "INSERT INTO gifts (creator_id, event_id, created_at, content) VALUES ($1, $2, $3, $4) RETURNING id", userID, toEventID, time.Now().UTC(), contentMarshalled).Scan(&copyID)
+			if err != nil {
+				return fmt.Errorf("failed to copy gift: %w", err)
+			}
+			if transfer.KeepComments {
+				_, err = s.db.ExecContext(
+					ctx,
+					"INSERT INTO comments (author_id, gift_id, created_at, modified_at, message) SELECT author_id, $1, created_at, modified_at, message FROM comments WHERE gift_id = $2",
+					copyID, giftID)
+				if err != nil {
+					return fmt.Errorf("failed to copy comments: %w", err)
+				}
+			}
+			transferredIDs = append(transferredIDs, copyID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transferredIDs, nil
+}
+
+// GiftEdit holds the new details of a gift. Nil fields are left unchanged.
+type GiftEdit struct {
+	Name     *string
+	URLs     *[]string
+	ToID     *string
+	Secret   *bool
+	Priority *int
+	Price    *int64
+}
+
+// EditedGift tells what EditGift did to a gift.
+type EditedGift struct {
+	Content GiftContent
+	// BuyerID is who reserved or bought the gift when details that matter to
+	// them changed, nil otherwise.
+	BuyerID *string
+	// Released tells whether the reservation of BuyerID was released.
+	Released bool
+}
+
+// EditGift changes the details of a gift. When its name, URLs or recipient
+// change after it was reserved, the reservation is released as the buyer may
+// not want to offer it anymore; a gift already bought stays bought. A gift is
+// released anyway when its buyer becomes its recipient.
+func (s *store) EditGift(ctx context.Context, giftID string, eventID string, edit GiftEdit) (*EditedGift, error) {
+	var edited EditedGift
+	err := s.withTx(ctx, func(s *store) error {
+		// lock the gift so that its reservation does not change meanwhile
+		var contentMarshalled []byte
+		err := s.db.QueryRowContext(ctx, "SELECT content FROM gifts WHERE id = $1 AND event_id = $2 FOR UPDATE", giftID, eventID).Scan(&contentMarshalled)
+		if err != nil {
+			return fmt.Errorf("failed to get gift: %w", err)
+		}
+
+		var giftContent GiftContent
+		err = json.Unmarshal(contentMarshalled, &giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+
+		material := false
+		if edit.Name != nil && *edit.Name != giftContent.Name {
+			giftContent.Name = *edit.Name
+			material = true
+		}
+		if edit.URLs != nil && !slices.Equal(*edit.URLs, giftContent.URLs) {
+			giftContent.URLs = *edit.URLs
+			material = true
+		}
+		if edit.ToID != nil && *edit.ToID != giftContent.ToID {
+			giftContent.ToID = *edit.ToID
+			material = true
+		}
+		if edit.Secret != nil {
+			giftContent.Secret = *edit.Secret
+		}
+		if edit.Priority != nil {
+			giftContent.Priority = *edit.Priority
+		}
+		if edit.Price != nil {
+			giftContent.Price = *edit.Price
+		}
 
-	var giftContent GiftContent
+		if giftContent.FromID != nil {
+			buyerID := *giftContent.FromID
+			if buyerID == giftContent.ToID {
+				giftContent.Status = NewGiftStatus
+				giftContent.FromID = nil
+				giftContent.Purchase = nil
+				edited.BuyerID = &buyerID
+				edited.Released = true
+			} else if material {
+				edited.BuyerID = &buyerID
+				edited.Released = releaseReservation(&giftContent)
+			}
+		}
+
+		contentMarshalled, err = json.Marshal(giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal gift content: %w", err)
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1 WHERE id = $2", contentMarshalled, giftID)
+		if err != nil {
+			return fmt.Errorf("failed to update gift: %w", err)
+		}
 
-	err = json.Unmarshal(contentMarshalled, &giftContent)
+		edited.Content = giftContent
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		return nil, err
 	}
 
-	if (giftContent.Status == AboutToBeBoughtGiftStatus || giftContent.Status == BoughtGiftStatus) && giftContent.FromID != nil && *giftContent.FromID != userID {
-		return errors.New("gift already has a buyer")
+	return &edited, nil
+}
+
+// trashedAt is when a trashed gift was put in the trash.
+const trashedAt = "deleted_at"
+
+// trashedCondition selects the gifts in the trash.
+var trashedCondition = fmt.Sprintf("(content::jsonb->>'status')::int = %d", MarkedForDeletionGiftStatus)
+
+// ListTrashedGifts returns the gifts of the event put in the trash since
+// since, most recently trashed first.
+func (s *store) ListTrashedGifts(ctx context.Context, eventID string, since time.Time) ([]Gift, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		id,
+		creator_id,
+		event_id,
+		created_at,
+		content,
+		`+trashedAt+`
+    FROM gifts
+    WHERE event_id = $1 AND `+trashedCondition+` AND `+trashedAt+` >= $2
+	ORDER BY `+trashedAt+` DESC
+`,
+		eventID, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed gifts: %w", err)
 	}
-	if giftContent.Status == AboutToBeBoughtGiftStatus || giftContent.Status == BoughtGiftStatus {
-		giftContent.FromID = &userID
-	} else {
+	defer rows.Close()
+
+	var gifts []Gift
+	for rows.Next() {
+		var (
+			gift             Gift
+			giftContentBytes []byte
+			deletedAt        time.Time
+		)
+		err = rows.Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes, &deletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &gift.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+		gift.DeletedAt = &deletedAt
+
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, nil
+}
+
+// RestoreGift takes a gift out of the trash, provided it was put there since
+// since. The restored gift gets back its status and buyer, unless the buyer
+// left the event since, in which case it is available again. It returns false
+// if there is no such gift in the trash.
+func (s *store) RestoreGift(ctx context.Context, giftID string, eventID string, since time.Time) (bool, error) {
+	var restored bool
+	err := s.withTx(ctx, func(s *store) error {
+		var contentMarshalled []byte
+		err := s.db.QueryRowContext(
+			ctx,
+			"SELECT content FROM gifts WHERE id = $1 AND event_id = $2 AND "+trashedCondition+" AND "+trashedAt+" >= $3 FOR UPDATE",
+			giftID, eventID, since.UTC()).Scan(&contentMarshalled)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to get gift: %w", err)
+		}
+
+		var giftContent GiftContent
+		err = json.Unmarshal(contentMarshalled, &giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+		trashed := giftContent.Trashed
+		giftContent.Trashed = nil
+		giftContent.Status = NewGiftStatus
 		giftContent.FromID = nil
+		giftContent.Purchase = nil
+		if trashed != nil && trashed.FromID != nil {
+			var participates bool
+			err = s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM participants WHERE event_id = $1 AND user_id = $2)", eventID, *trashed.FromID).Scan(&participates)
+			if err != nil {
+				return fmt.Errorf("failed to check buyer: %w", err)
+			}
+			if participates {
+				giftContent.Status = trashed.Status
+				giftContent.FromID = trashed.FromID
+				giftContent.Purchase = trashed.Purchase
+			}
+		} else if trashed != nil {
+			giftContent.Status = trashed.Status
+		}
+
+		contentMarshalled, err = json.Marshal(giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal gift content: %w", err)
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1, deleted_at = NULL WHERE id = $2", contentMarshalled, giftID)
+		if err != nil {
+			return fmt.Errorf("failed to restore gift: %w", err)
+		}
+
+		restored = true
+		return nil
+	})
+	if err != nil {
+		return false, err
 	}
-	giftContent.Status = status
 
-	contentMarshalled, err = json.Marshal(giftContent)
+	return restored, nil
+}
+
+// DeleteTrashedGift permanently deletes a gift in the trash, with its
+// comments. It returns false if there is no such gift in the trash.
+func (s *store) DeleteTrashedGift(ctx context.Context, giftID string, eventID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gifts WHERE id = $1 AND event_id = $2 AND "+trashedCondition, giftID, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal gift content: %w", err)
+		return false, fmt.Errorf("failed to delete gift: %w", err)
 	}
-	_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1 where id = $2", contentMarshalled, giftID)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to update gift: %w", err)
+		return false, fmt.Errorf("failed to delete gift: %w", err)
 	}
-	return nil
+	return affected == 1, nil
+}
+
+// PurgeTrashedGifts permanently deletes the gifts put in the trash before
+// before, with their comments. It returns the number of deleted gifts.
+func (s *store) PurgeTrashedGifts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gifts WHERE "+trashedCondition+" AND "+trashedAt+" < $1", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trashed gifts: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trashed gifts: %w", err)
+	}
+	return deleted, nil
 }
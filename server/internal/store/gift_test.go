@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdateGiftRecordsBuyer(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf")
+	eventID, creatorID, buyerID, giftID := event.ID, event.CreatorID, event.FriendID, event.GiftIDs["Scarf"]
+	otherID := createTestUser(t, s, "update-other@example.com")
+	if err := s.AddEventParticipant(ctx, eventID, "update-other@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+
+	// reserving a new gift used to look at its previous status and drop the
+	// buyer
+	if err := s.UpdateGift(ctx, buyerID, giftID, eventID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	gifts, err := s.ListGifts(ctx, creatorID, eventID)
+	if err != nil || len(gifts) != 1 || gifts[0].Content.FromID == nil || *gifts[0].Content.FromID != buyerID {
+		t.Fatalf("expected the buyer to be recorded, got %+v, %v", gifts, err)
+	}
+	if err := s.UpdateGift(ctx, otherID, giftID, eventID, BoughtGiftStatus); err == nil {
+		t.Fatal("expected the gift not to be taken over by another buyer")
+	}
+
+	if err := s.UpdateGift(ctx, buyerID, giftID, eventID, NewGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	gifts, err = s.ListGifts(ctx, creatorID, eventID)
+	if err != nil || len(gifts) != 1 || gifts[0].Content.FromID != nil {
+		t.Fatalf("expected the buyer to be cleared, got %+v, %v", gifts, err)
+	}
+}
+
+func TestTransferGifts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	christmasID, creatorID, buyerID := event.ID, event.CreatorID, event.FriendID
+
+	birthdayID, err := s.CreateEvent(ctx, creatorID, "Birthday", now, "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, birthdayID, event.FriendEmail); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+
+	if err := s.CreateGift(ctx, creatorID, "Scarf", christmasID, creatorID, []string{"https://example.com/scarf"}, false); err != nil {
+		t.Fatalf("CreateGift() returned %v", err)
+	}
+	gifts, err := s.ListGifts(ctx, creatorID, christmasID)
+	if err != nil || len(gifts) != 1 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	giftID := gifts[0].ID
+	if err := s.UpdateGift(ctx, buyerID, giftID, christmasID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if err := s.CreateComment(ctx, buyerID, giftID, "Which color?"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+
+	copyIDs, err := s.TransferGifts(ctx, creatorID, []string{giftID}, christmasID, birthdayID, GiftTransfer{KeepComments: true})
+	if err != nil || len(copyIDs) != 1 || copyIDs[0] == giftID {
+		t.Fatalf("TransferGifts() returned %v, %v", copyIDs, err)
+	}
+	gifts, err = s.ListGifts(ctx, creatorID, birthdayID)
+	if err != nil || len(gifts) != 1 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	if gifts[0].Content.Status != NewGiftStatus || gifts[0].Content.FromID != nil || gifts[0].Content.URLs != nil {
+		t.Fatalf("expected the copy to be available without URLs, got %+v", gifts[0].Content)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM comments WHERE gift_id = $1", copyIDs[0]); count != 1 {
+		t.Fatalf("expected the comments to be copied, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gifts WHERE event_id = $1", christmasID); count != 1 {
+		t.Fatalf("expected the original gift to be kept, got %d gifts", count)
+	}
+
+	movedIDs, err := s.TransferGifts(ctx, creatorID, []string{giftID}, christmasID, birthdayID, GiftTransfer{Move: true, KeepReservations: true, KeepURLs: true})
+	if err != nil || len(movedIDs) != 1 || movedIDs[0] != giftID {
+		t.Fatalf("TransferGifts() returned %v, %v", movedIDs, err)
+	}
+	gifts, err = s.ListGifts(ctx, creatorID, birthdayID)
+	if err != nil || len(gifts) != 2 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	for _, gift := range gifts {
+		if gift.ID != giftID {
+			continue
+		}
+		if gift.Content.Status != AboutToBeBoughtGiftStatus || gift.Content.FromID == nil || *gift.Content.FromID != buyerID || len(gift.Content.URLs) != 1 {
+			t.Fatalf("expected the moved gift to keep its reservation and URLs, got %+v", gift.Content)
+		}
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM comments WHERE gift_id = $1", giftID); count != 0 {
+		t.Fatalf("expected the comments of the moved gift to be deleted, got %d", count)
+	}
+}
+
+func TestEditGiftReleasesReservation(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf")
+	eventID, buyerID, giftID := event.ID, event.FriendID, event.GiftIDs["Scarf"]
+
+	if err := s.UpdateGift(ctx, buyerID, giftID, eventID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+
+	// making the gift secret does not change it for the buyer
+	secret := true
+	edited, err := s.EditGift(ctx, giftID, eventID, GiftEdit{Secret: &secret})
+	if err != nil || edited.BuyerID != nil || edited.Content.Status != AboutToBeBoughtGiftStatus {
+		t.Fatalf("EditGift() returned %+v, %v", edited, err)
+	}
+
+	name := "Red scarf"
+	edited, err = s.EditGift(ctx, giftID, eventID, GiftEdit{Name: &name})
+	if err != nil {
+		t.Fatalf("EditGift() returned %v", err)
+	}
+	if edited.BuyerID == nil || *edited.BuyerID != buyerID || !edited.Released {
+		t.Fatalf("expected the reservation of the buyer to be released, got %+v", edited)
+	}
+	if edited.Content.Name != name || edited.Content.Status != NewGiftStatus || edited.Content.FromID != nil {
+		t.Fatalf("unexpected gift content %+v", edited.Content)
+	}
+}
+
+func TestTrashedGifts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf", "Book")
+	eventID, userID := event.ID, event.CreatorID
+
+	gifts, err := s.ListGifts(ctx, userID, eventID)
+	if err != nil || len(gifts) != 2 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	for _, gift := range gifts {
+		if err := s.UpdateGift(ctx, userID, gift.ID, eventID, MarkedForDeletionGiftStatus); err != nil {
+			t.Fatalf("UpdateGift() returned %v", err)
+		}
+	}
+	if err := s.UpdateGift(ctx, userID, gifts[0].ID, eventID, NewGiftStatus); err == nil {
+		t.Fatal("expected trashed gifts not to be updated")
+	}
+
+	trashed, err := s.ListTrashedGifts(ctx, eventID, now.Add(-time.Hour))
+	if err != nil || len(trashed) != 2 || trashed[0].DeletedAt == nil {
+		t.Fatalf("ListTrashedGifts() returned %v, %v", trashed, err)
+	}
+
+	// out of the retention window
+	if restored, err := s.RestoreGift(ctx, gifts[0].ID, eventID, now.Add(time.Hour)); err != nil || restored {
+		t.Fatalf("RestoreGift() returned %v, %v", restored, err)
+	}
+	if restored, err := s.RestoreGift(ctx, gifts[0].ID, eventID, now.Add(-time.Hour)); err != nil || !restored {
+		t.Fatalf("RestoreGift() returned %v, %v", restored, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gifts WHERE id = $1 AND deleted_at IS NULL", gifts[0].ID); count != 1 {
+		t.Fatal("expected the gift to be restored")
+	}
+
+	deleted, err := s.PurgeTrashedGifts(ctx, time.Now().Add(time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("PurgeTrashedGifts() returned %v, %v", deleted, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gifts WHERE event_id = $1", eventID); count != 1 {
+		t.Fatalf("expected only the restored gift to be left, got %d gifts", count)
+	}
+}
+
+func TestRestoreGiftKeepsBuyer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf")
+	eventID, buyerID, giftID := event.ID, event.FriendID, event.GiftIDs["Scarf"]
+
+	if err := s.UpdateGift(ctx, buyerID, giftID, eventID, BoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if err := s.UpdateGift(ctx, buyerID, giftID, eventID, MarkedForDeletionGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if restored, err := s.RestoreGift(ctx, giftID, eventID, now.Add(-time.Hour)); err != nil || !restored {
+		t.Fatalf("RestoreGift() returned %v, %v", restored, err)
+	}
+
+	gifts, err := s.ListGifts(ctx, buyerID, eventID)
+	if err != nil || len(gifts) != 1 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	content := gifts[0].Content
+	if content.Status != BoughtGiftStatus || content.FromID == nil || *content.FromID != buyerID || content.Trashed != nil {
+		t.Fatalf("expected the gift to be bought again, got %+v", content)
+	}
+
+	// gifts trashed before their trashing time was recorded are not purged
+	_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = jsonb_set(content::jsonb, '{status}', $1::text::jsonb)::text, deleted_at = NULL WHERE id = $2", MarkedForDeletionGiftStatus, giftID)
+	if err != nil {
+		t.Fatalf("failed to trash gift: %v", err)
+	}
+	if _, err := s.PurgeTrashedGifts(ctx, now.Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeTrashedGifts() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gifts WHERE id = $1", giftID); count != 1 {
+		t.Fatal("expected the gift without trashing time to be kept")
+	}
+}
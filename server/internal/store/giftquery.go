@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type GiftSort int
+
+const (
+	// CreatedGiftSort sorts the newest gifts first.
+	CreatedGiftSort = iota
+	// PriorityGiftSort sorts the most wanted gifts first.
+	PriorityGiftSort
+	// NameGiftSort sorts gifts by name.
+	NameGiftSort
+	// PriceGiftSort sorts the cheapest gifts first, the ones without a price
+	// last.
+	PriceGiftSort
+)
+
+// GiftCursor is where a page of gifts starts: right after the gift with ID,
+// whose sort key is Key.
+type GiftCursor struct {
+	Key string `json:"key"`
+	ID  string `json:"id"`
+}
+
+// GiftQuery selects, sorts and pages the gifts of an event as seen by
+// ViewerID. Zero fields do not filter.
+type GiftQuery struct {
+	ViewerID string
+	// HideRecipientStatus tells whether the recipients of gifts only see
+	// them as SecretGiftStatus, so that they can only be filtered as such.
+	HideRecipientStatus bool
+	RecipientID         string
+	Status              *GiftStatus
+	BuyerID             string
+	// HasComments selects gifts with or without comments. The secret gifts
+	// of the viewer have none as far as they know.
+	HasComments *bool
+	Sort        GiftSort
+	After       *GiftCursor
+	// Limit is the maximum number of gifts returned, all of them if 0.
+	Limit int
+}
+
+// order returns the SQL expression sorting gifts by s, the type of its
+// values and whether it sorts in descending order. The details of the gifts
+// that are a surprise for the viewer, as selected by the surprise condition,
+// are hidden from them and do not sort them.
+func (s GiftSort) order(surprise string) (key string, keyType string, desc bool) {
+	switch s {
+	case PriorityGiftSort:
+		return fmt.Sprintf("CASE WHEN %s THEN 0 ELSE coalesce((gifts.content::jsonb->>'priority')::int, 0) END", surprise), "int", true
+	case NameGiftSort:
+		return fmt.Sprintf("CASE WHEN %s THEN '' ELSE lower(gifts.content::jsonb->>'name') END", surprise), "text", false
+	case PriceGiftSort:
+		return fmt.Sprintf("CASE WHEN %s THEN %d ELSE coalesce(nullif((gifts.content::jsonb->>'price')::bigint, 0), %d) END", surprise, int64(math.MaxInt64), int64(math.MaxInt64)), "bigint", false
+	default:
+		return "gifts.created_at", "timestamp", true
+	}
+}
+
+// QueryGifts returns the gifts of an event selected by query, except the
+// trashed ones and the ideas for the viewer, and the cursor of the next page
+// if there is one.
+func (s *store) QueryGifts(ctx context.Context, eventID string, query GiftQuery) ([]Gift, *GiftCursor, error) {
+	args := []any{eventID, query.ViewerID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	recipient := "gifts.content::jsonb->>'to'"
+	surprise := fmt.Sprintf("(%s = $2 AND coalesce((gifts.content::jsonb->>'secret')::boolean, false))", recipient)
+
+	conditions := []string{
+		"gifts.event_id = $1",
+		"NOT " + trashedCondition,
+		// ideas do not exist for their recipient
+		fmt.Sprintf("NOT (%s AND %s = $2)", ideaCondition, recipient),
+	}
+	if query.RecipientID != "" {
+		conditions = append(conditions, recipient+" = "+arg(query.RecipientID))
+	}
+	if query.Status != nil {
+		status := "(gifts.content::jsonb->>'status')::int"
+		if query.HideRecipientStatus {
+			status = fmt.Sprintf("CASE WHEN %s = $2 THEN %d ELSE %s END", recipient, SecretGiftStatus, status)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = %s", status, arg(int(*query.Status))))
+	}
+	if query.BuyerID != "" {
+		conditions = append(conditions, "gifts.content::jsonb->>'from' = "+arg(query.BuyerID))
+	}
+	if query.HasComments != nil {
+		// like its name, what others say about a secret gift is part of the
+		// surprise
+		hasComments := fmt.Sprintf("(NOT %s AND EXISTS (SELECT 1 FROM comments WHERE comments.gift_id = gifts.id))", surprise)
+		if !*query.HasComments {
+			hasComments = "NOT " + hasComments
+		}
+		conditions = append(conditions, hasComments)
+	}
+
+	key, keyType, desc := query.Sort.order(surprise)
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+	if query.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, gifts.id) %s (%s::%s, %s::int)", key, comparison, arg(query.After.Key), keyType, arg(query.After.ID)))
+	}
+
+	limit := ""
+	if query.Limit > 0 {
+		// one more tells whether there is a next page
+		limit = "LIMIT " + arg(query.Limit+1)
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		gifts.id,
+		gifts.creator_id,
+		gifts.event_id,
+		gifts.created_at,
+		gifts.content,
+		(`+key+`)::text
+    FROM gifts
+    WHERE `+strings.Join(conditions, " AND ")+`
+	ORDER BY `+key+` `+direction+`, gifts.id `+direction+`
+	`+limit+`
+`,
+		args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query gifts: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		gifts []Gift
+		keys  []string
+	)
+
+	for rows.Next() {
+		var (
+			gift             Gift
+			giftContentBytes []byte
+			giftKey          string
+		)
+		err = rows.Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes, &giftKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning gift: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &gift.Content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+
+		gifts = append(gifts, gift)
+		keys = append(keys, giftKey)
+	}
+
+	if query.Limit <= 0 || len(gifts) <= query.Limit {
+		return gifts, nil, nil
+	}
+
+	gifts = gifts[:query.Limit]
+	last := len(gifts) - 1
+	return gifts, &GiftCursor{Key: keys[last], ID: gifts[last].ID}, nil
+}
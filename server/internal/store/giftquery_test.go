@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQueryGifts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+
+	gifts := []struct {
+		name   string
+		to     string
+		secret bool
+		price  int64
+	}{
+		{"Book", friendID, false, 1500},
+		{"Zeppelin", friendID, true, 100},
+		{"Candle", creatorID, false, 0},
+		{"Dice", creatorID, false, 500},
+	}
+	giftIDs := make(map[string]string)
+	for _, gift := range gifts {
+		if err := s.CreateGift(ctx, creatorID, gift.name, eventID, gift.to, nil, gift.secret); err != nil {
+			t.Fatalf("CreateGift() returned %v", err)
+		}
+		created, err := s.ListGifts(ctx, creatorID, eventID)
+		if err != nil {
+			t.Fatalf("ListGifts() returned %v", err)
+		}
+		for _, c := range created {
+			if c.Content.Name == gift.name {
+				giftIDs[gift.name] = c.ID
+			}
+		}
+		if _, err := s.EditGift(ctx, giftIDs[gift.name], eventID, GiftEdit{Price: &gift.price}); err != nil {
+			t.Fatalf("EditGift() returned %v", err)
+		}
+	}
+	if err := s.UpdateGift(ctx, friendID, giftIDs["Dice"], eventID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if err := s.CreateComment(ctx, friendID, giftIDs["Candle"], "Which scent?"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+	if err := s.CreateComment(ctx, creatorID, giftIDs["Zeppelin"], "Got it!"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+
+	names := func(gifts []Gift) []string {
+		var result []string
+		for _, gift := range gifts {
+			result = append(result, gift.Content.Name)
+		}
+		return result
+	}
+	check := func(query GiftQuery, expected ...string) *GiftCursor {
+		t.Helper()
+		gifts, next, err := s.QueryGifts(ctx, eventID, query)
+		if err != nil {
+			t.Fatalf("QueryGifts() returned %v", err)
+		}
+		got := names(gifts)
+		if len(got) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, got)
+			}
+		}
+		return next
+	}
+
+	check(GiftQuery{ViewerID: creatorID, Sort: NameGiftSort}, "Book", "Candle", "Dice", "Zeppelin")
+	// the secret gift addressed to the friend sorts by neither its name nor
+	// its price
+	check(GiftQuery{ViewerID: friendID, Sort: NameGiftSort}, "Zeppelin", "Book", "Candle", "Dice")
+	check(GiftQuery{ViewerID: friendID, Sort: NameGiftSort, RecipientID: creatorID}, "Candle", "Dice")
+	check(GiftQuery{ViewerID: creatorID, Sort: PriceGiftSort}, "Zeppelin", "Dice", "Book", "Candle")
+	check(GiftQuery{ViewerID: friendID, Sort: PriceGiftSort}, "Dice", "Book", "Zeppelin", "Candle")
+
+	status := GiftStatus(AboutToBeBoughtGiftStatus)
+	check(GiftQuery{ViewerID: friendID, Status: &status}, "Dice")
+	// the creator only sees the gifts addressed to them as secret
+	check(GiftQuery{ViewerID: creatorID, Status: &status, HideRecipientStatus: true})
+	secret := GiftStatus(SecretGiftStatus)
+	check(GiftQuery{ViewerID: creatorID, Status: &secret, HideRecipientStatus: true, Sort: NameGiftSort}, "Candle", "Dice")
+	check(GiftQuery{ViewerID: friendID, BuyerID: friendID}, "Dice")
+	hasComments := true
+	check(GiftQuery{ViewerID: creatorID, HasComments: &hasComments}, "Candle", "Zeppelin")
+	// the friend does not know about the comments on their secret gift
+	check(GiftQuery{ViewerID: friendID, HasComments: &hasComments}, "Candle")
+	hasNoComments := false
+	check(GiftQuery{ViewerID: friendID, HasComments: &hasNoComments, Sort: NameGiftSort}, "Zeppelin", "Book", "Dice")
+
+	next := check(GiftQuery{ViewerID: creatorID, Limit: 3}, "Dice", "Candle", "Zeppelin")
+	if next == nil {
+		t.Fatal("expected a next page")
+	}
+	if next := check(GiftQuery{ViewerID: creatorID, Limit: 3, After: next}, "Book"); next != nil {
+		t.Fatalf("expected no next page, got %+v", next)
+	}
+	next = check(GiftQuery{ViewerID: creatorID, Sort: PriceGiftSort, Limit: 2}, "Zeppelin", "Dice")
+	check(GiftQuery{ViewerID: creatorID, Sort: PriceGiftSort, Limit: 2, After: next}, "Book", "Candle")
+}
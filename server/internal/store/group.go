@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type GroupRole int
+
+const (
+	// AdminGroupRole members manage the group and its members.
+	AdminGroupRole = iota
+	MemberGroupRole
+)
+
+// Valid tells whether r is a known group role.
+func (r GroupRole) Valid() bool {
+	return r == AdminGroupRole || r == MemberGroupRole
+}
+
+// Group is a reusable set of users, such as a household or a family, that
+// can be added to events at once.
+type Group struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the role in the group of the user listing it.
+	Role GroupRole `json:"role"`
+}
+
+type GroupMember struct {
+	User
+	Role GroupRole `json:"role"`
+}
+
+type AlreadyGroupMemberError struct {
+	error
+}
+
+func NewAlreadyGroupMemberError(err error) error {
+	return AlreadyGroupMemberError{
+		error: err,
+	}
+}
+
+func IsAlreadyGroupMemberError(err error) bool {
+	var memberErr AlreadyGroupMemberError
+	return errors.As(err, &memberErr)
+}
+
+type LastGroupAdminError struct {
+	error
+}
+
+func NewLastGroupAdminError(err error) error {
+	return LastGroupAdminError{
+		error: err,
+	}
+}
+
+func IsLastGroupAdminError(err error) bool {
+	var adminErr LastGroupAdminError
+	return errors.As(err, &adminErr)
+}
+
+// CreateGroup creates a group with userID as admin. It returns the ID of the
+// group.
+func (s *store) CreateGroup(ctx context.Context, userID string, name string) (string, error) {
+	var groupID string
+	err := s.withTx(ctx, func(s *store) error {
+		err := s.db.QueryRowContext(ctx, "INSERT INTO user_groups (name, created_at) VALUES ($1, $2) RETURNING id", name, time.Now().UTC()).Scan(&groupID)
+		if err != nil {
+			return fmt.Errorf("failed to create group: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, $3)", groupID, userID, AdminGroupRole)
+		if err != nil {
+			return fmt.Errorf("failed to create group member: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return groupID, nil
+}
+
+// ListGroups returns the groups userID is a member of.
+func (s *store) ListGroups(ctx context.Context, userID string) ([]Group, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		user_groups.id,
+		user_groups.name,
+		user_groups.created_at,
+		group_members.role
+    FROM user_groups
+    JOIN group_members ON user_groups.id = group_members.group_id
+    WHERE group_members.user_id = $1
+`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+
+	for rows.Next() {
+		var group Group
+		err = rows.Scan(&group.ID, &group.Name, &group.CreatedAt, &group.Role)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning group: %w", err)
+		}
+
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+// GetGroupRole returns the role of userID in the group, or nil if they are
+// not a member of it.
+func (s *store) GetGroupRole(ctx context.Context, groupID string, userID string) (*GroupRole, error) {
+	var role GroupRole
+	err := s.db.QueryRowContext(ctx, "SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group role: %w", err)
+	}
+	return &role, nil
+}
+
+func (s *store) GetGroupMembers(ctx context.Context, groupID string) ([]GroupMember, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		users.id,
+		users.name,
+		users.email,
+		users.picture,
+		group_members.role
+    FROM users
+    JOIN group_members ON users.id = group_members.user_id
+    WHERE group_members.group_id = $1
+`,
+		groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []GroupMember
+
+	for rows.Next() {
+		var (
+			member  GroupMember
+			picture sql.NullString
+		)
+		err = rows.Scan(&member.ID, &member.Name, &member.Email, &picture, &member.Role)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning group member: %w", err)
+		}
+
+		if picture.Valid {
+			member.Picture = picture.String
+		}
+
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	return members, nil
+}
+
+func (s *store) RenameGroup(ctx context.Context, groupID string, name string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE user_groups SET name = $1 WHERE id = $2", name, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to rename group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a group. The participants it brought to events stay in
+// them.
+func (s *store) DeleteGroup(ctx context.Context, groupID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM user_groups WHERE id = $1", groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	return nil
+}
+
+// AddGroupMember adds the user with userEmail to the group, and to the events
+// kept in sync with it.
+func (s *store) AddGroupMember(ctx context.Context, groupID string, userEmail string, role GroupRole) error {
+	userID, err := s.findParticipantByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(ctx, "INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, $3)", groupID, userID, role)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return NewAlreadyGroupMemberError(pgErr)
+			}
+			return fmt.Errorf("failed to create group member: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+	INSERT INTO participants (user_id, event_id, participant_role, source_group_id)
+	SELECT $2, event_id, $3, $1
+	FROM event_groups
+	WHERE group_id = $1 AND sync
+	ON CONFLICT (user_id, event_id) DO NOTHING
+`,
+			groupID, userID, MemberParticipantRole)
+		if err != nil {
+			return fmt.Errorf("failed to add member to synced events: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UpdateGroupMemberRole changes the role of a member of the group. The last
+// admin of a group cannot become a simple member. It returns false if the
+// user is not a member of the group.
+func (s *store) UpdateGroupMemberRole(ctx context.Context, groupID string, userID string, role GroupRole) (bool, error) {
+	var updated bool
+	err := s.withTx(ctx, func(s *store) error {
+		if role != AdminGroupRole {
+			if err := s.checkNotLastGroupAdmin(ctx, groupID, userID); err != nil {
+				return err
+			}
+		}
+
+		result, err := s.db.ExecContext(ctx, "UPDATE group_members SET role = $1 WHERE group_id = $2 AND user_id = $3", role, groupID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update group member: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update group member: %w", err)
+		}
+		updated = affected == 1
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
+// RemoveGroupMember removes a member from the group, and from the events kept
+// in sync with it that they joined through the group, except the ones they
+// created. The last admin of a group cannot leave it, they delete it instead.
+func (s *store) RemoveGroupMember(ctx context.Context, groupID string, userID string) error {
+	return s.withTx(ctx, func(s *store) error {
+		if err := s.checkNotLastGroupAdmin(ctx, groupID, userID); err != nil {
+			return err
+		}
+
+		_, err := s.db.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to remove group member: %w", err)
+		}
+
+		rows, err := s.db.QueryContext(
+			ctx,
+			`
+	SELECT event_groups.event_id
+	FROM event_groups
+	JOIN events ON event_groups.event_id = events.id
+	JOIN participants ON participants.event_id = events.id AND participants.user_id = $2
+	WHERE event_groups.group_id = $1 AND event_groups.sync AND events.creator_id != $2
+		AND participants.source_group_id = $1
+`,
+			groupID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to list synced events: %w", err)
+		}
+		var eventIDs []string
+		for rows.Next() {
+			var eventID string
+			if err := rows.Scan(&eventID); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning event: %w", err)
+			}
+			eventIDs = append(eventIDs, eventID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list synced events: %w", err)
+		}
+
+		for _, eventID := range eventIDs {
+			if _, err := s.RemoveEventParticipant(ctx, eventID, userID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// checkNotLastGroupAdmin returns a LastGroupAdminError if userID is the only
+// admin of the group.
+func (s *store) checkNotLastGroupAdmin(ctx context.Context, groupID string, userID string) error {
+	var otherAdmins int
+	// lock the admins so that two of them cannot step down concurrently
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT count(*) FROM (SELECT 1 FROM group_members WHERE group_id = $1 AND role = $2 AND user_id != $3 FOR UPDATE) admins",
+		groupID, AdminGroupRole, userID).Scan(&otherAdmins)
+	if err != nil {
+		return fmt.Errorf("failed to count group admins: %w", err)
+	}
+
+	role, err := s.GetGroupRole(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role != nil && *role == AdminGroupRole && otherAdmins == 0 {
+		return NewLastGroupAdminError(fmt.Errorf("user %s is the last admin of group %s", userID, groupID))
+	}
+	return nil
+}
+
+// AddGroupToEvent adds the members of the group to the event. When sync is
+// true, members later added to or removed from the group are also added to or
+// removed from the event.
+func (s *store) AddGroupToEvent(ctx context.Context, eventID string, groupID string, sync bool) error {
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(
+			ctx,
+			`
+	INSERT INTO participants (user_id, event_id, participant_role, source_group_id)
+	SELECT user_id, $2, $3, $1
+	FROM group_members
+	WHERE group_id = $1
+	ON CONFLICT (user_id, event_id) DO NOTHING
+`,
+			groupID, eventID, MemberParticipantRole)
+		if err != nil {
+			return fmt.Errorf("failed to add group members: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			"INSERT INTO event_groups (event_id, group_id, sync) VALUES ($1, $2, $3) ON CONFLICT (event_id, group_id) DO UPDATE SET sync = excluded.sync",
+			eventID, groupID, sync)
+		if err != nil {
+			return fmt.Errorf("failed to link group: %w", err)
+		}
+
+		return nil
+	})
+}
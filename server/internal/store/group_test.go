@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGroupSyncedWithEvent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	adminID := createTestUser(t, s, "group-admin@example.com")
+	memberID := createTestUser(t, s, "group-member@example.com")
+	lateID := createTestUser(t, s, "group-late@example.com")
+
+	groupID, err := s.CreateGroup(ctx, adminID, "Family")
+	if err != nil {
+		t.Fatalf("CreateGroup() returned %v", err)
+	}
+	if err := s.AddGroupMember(ctx, groupID, "group-member@example.com", MemberGroupRole); err != nil {
+		t.Fatalf("AddGroupMember() returned %v", err)
+	}
+
+	eventID, err := s.CreateEvent(ctx, adminID, "Christmas", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddGroupToEvent(ctx, eventID, groupID, true); err != nil {
+		t.Fatalf("AddGroupToEvent() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1", eventID); count != 2 {
+		t.Fatalf("expected the group members to participate, got %d participants", count)
+	}
+
+	if err := s.AddGroupMember(ctx, groupID, "group-late@example.com", MemberGroupRole); err != nil {
+		t.Fatalf("AddGroupMember() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", eventID, lateID); count != 1 {
+		t.Fatal("expected the new member to join the synced event")
+	}
+
+	if err := s.RemoveGroupMember(ctx, groupID, memberID); err != nil {
+		t.Fatalf("RemoveGroupMember() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", eventID, memberID); count != 0 {
+		t.Fatal("expected the removed member to leave the synced event")
+	}
+
+	// who joined the event on their own stays in it
+	ownEventID, err := s.CreateEvent(ctx, adminID, "Birthday", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, ownEventID, "group-late@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+	if err := s.AddGroupToEvent(ctx, ownEventID, groupID, true); err != nil {
+		t.Fatalf("AddGroupToEvent() returned %v", err)
+	}
+	if err := s.RemoveGroupMember(ctx, groupID, lateID); err != nil {
+		t.Fatalf("RemoveGroupMember() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", ownEventID, lateID); count != 1 {
+		t.Fatal("expected the member who joined on their own to stay in the event")
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", eventID, lateID); count != 0 {
+		t.Fatal("expected the removed member to leave the synced event")
+	}
+
+	if updated, err := s.UpdateGroupMemberRole(ctx, groupID, memberID, AdminGroupRole); err != nil || updated {
+		t.Fatalf("expected a former member not to be updated, got %v, %v", updated, err)
+	}
+
+	if err := s.RemoveGroupMember(ctx, groupID, adminID); !IsLastGroupAdminError(err) {
+		t.Fatalf("expected the last admin not to leave, got %v", err)
+	}
+}
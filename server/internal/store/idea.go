@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ideaCondition selects the gifts that are ideas.
+const ideaCondition = "coalesce((gifts.content::jsonb->>'idea')::boolean, false)"
+
+// CreateGiftIdea creates an idea of gift for toUserID, hidden from them.
+func (s *store) CreateGiftIdea(ctx context.Context, userID string, name string, eventID string, toUserID string, urls []string) error {
+	return s.createGift(ctx, userID, eventID, GiftContent{
+		Name:   name,
+		Status: NewGiftStatus,
+		ToID:   toUserID,
+		URLs:   urls,
+		Idea:   true,
+	})
+}
+
+// PromoteGiftIdea turns an idea into a gift reserved by userID. The gift is
+// made secret, so that its recipient does not learn what it is now that they
+// can see it. It returns false if the gift is not an idea of the event
+// anymore.
+func (s *store) PromoteGiftIdea(ctx context.Context, userID string, giftID string, eventID string) (bool, error) {
+	promoted := false
+	err := s.withTx(ctx, func(s *store) error {
+		var contentMarshalled []byte
+		err := s.db.QueryRowContext(ctx, "SELECT content FROM gifts WHERE id = $1 AND event_id = $2 FOR UPDATE", giftID, eventID).Scan(&contentMarshalled)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to get gift: %w", err)
+		}
+
+		var giftContent GiftContent
+		err = json.Unmarshal(contentMarshalled, &giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+		if !giftContent.Idea || giftContent.Status == MarkedForDeletionGiftStatus {
+			return nil
+		}
+
+		giftContent.Idea = false
+		giftContent.Secret = true
+		giftContent.Status = AboutToBeBoughtGiftStatus
+		giftContent.FromID = &userID
+
+		contentMarshalled, err = json.Marshal(giftContent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal gift content: %w", err)
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET content = $1 WHERE id = $2", contentMarshalled, giftID)
+		if err != nil {
+			return fmt.Errorf("failed to update gift: %w", err)
+		}
+
+		promoted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return promoted, nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGiftIdeas(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+
+	if err := s.CreateGiftIdea(ctx, friendID, "Telescope", eventID, creatorID, nil); err != nil {
+		t.Fatalf("CreateGiftIdea() returned %v", err)
+	}
+
+	gifts, _, err := s.QueryGifts(ctx, eventID, GiftQuery{ViewerID: creatorID})
+	if err != nil || len(gifts) != 0 {
+		t.Fatalf("expected the idea to be hidden from its recipient, got %v, %v", gifts, err)
+	}
+	gifts, _, err = s.QueryGifts(ctx, eventID, GiftQuery{ViewerID: friendID})
+	if err != nil || len(gifts) != 1 || !gifts[0].Content.Idea {
+		t.Fatalf("QueryGifts() returned %v, %v", gifts, err)
+	}
+	ideaID := gifts[0].ID
+	results, err := s.SearchGifts(ctx, creatorID, "telescope", 10)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected the idea not to match for its recipient, got %v, %v", results, err)
+	}
+
+	if err := s.UpdateGift(ctx, friendID, ideaID, eventID, AboutToBeBoughtGiftStatus); err == nil {
+		t.Fatal("expected reserving an idea to fail")
+	}
+
+	vote, err := s.ToggleVote(ctx, GiftReactionTarget, ideaID, friendID, 1, now)
+	if err != nil || vote != 1 {
+		t.Fatalf("ToggleVote() returned %d, %v", vote, err)
+	}
+	summary, err := s.GetReactionSummary(ctx, GiftReactionTarget, ideaID, friendID)
+	if err != nil || summary.Upvotes != 1 || summary.Vote != 1 {
+		t.Fatalf("GetReactionSummary() returned %+v, %v", summary, err)
+	}
+
+	promoted, err := s.PromoteGiftIdea(ctx, friendID, ideaID, eventID)
+	if err != nil || !promoted {
+		t.Fatalf("PromoteGiftIdea() returned %v, %v", promoted, err)
+	}
+	gift, err := s.GetGift(ctx, eventID, ideaID)
+	if err != nil || gift == nil {
+		t.Fatalf("GetGift() returned %v, %v", gift, err)
+	}
+	if gift.Content.Idea || !gift.Content.Secret || gift.Content.Status != AboutToBeBoughtGiftStatus || gift.Content.FromID == nil || *gift.Content.FromID != friendID {
+		t.Fatalf("expected a secret gift reserved by the friend, got %+v", gift.Content)
+	}
+	promoted, err = s.PromoteGiftIdea(ctx, creatorID, ideaID, eventID)
+	if err != nil || promoted {
+		t.Fatalf("expected the gift not to be promoted twice, got %v, %v", promoted, err)
+	}
+}
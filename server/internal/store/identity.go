@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Identity is an external login provider account linked to a user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityAlreadyLinkedError struct {
+	error
+}
+
+func NewIdentityAlreadyLinkedError(err error) error {
+	return IdentityAlreadyLinkedError{
+		error: err,
+	}
+}
+
+func IsIdentityAlreadyLinkedError(err error) bool {
+	var linkedErr IdentityAlreadyLinkedError
+	return errors.As(err, &linkedErr)
+}
+
+type LastLoginMethodError struct {
+	error
+}
+
+func NewLastLoginMethodError(err error) error {
+	return LastLoginMethodError{
+		error: err,
+	}
+}
+
+func IsLastLoginMethodError(err error) bool {
+	var lastErr LastLoginMethodError
+	return errors.As(err, &lastErr)
+}
+
+// FindOrCreateUserByIdentity returns the user linked to the given provider
+// identity, creating a new user if there is none, whose email is verified if
+// the provider verified it.
+// An existing account with the same email is never linked implicitly, except
+// for accounts created by the OAuth login before identities existed (no
+// password and no identity yet), which are adopted by their first login
+// provided the provider verified the email. Otherwise, an
+// EmailAlreadyUsedError is returned: whoever registered the account, possibly
+// without owning the email, must not share it with the owner of the email.
+func (s *store) FindOrCreateUserByIdentity(ctx context.Context, provider string, subject string, user *User, emailVerified bool) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	err = s.withTx(ctx, func(s *store) error {
+		err := s.db.QueryRowContext(
+			ctx,
+			`
+		SELECT
+			users.id
+	    FROM users
+	    WHERE users.email = $1
+			AND NOT EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id)
+			AND users.password_hash = ''
+			AND $2
+	`,
+			user.Email, emailVerified).Scan(&userID)
+		if err == nil {
+			_, err = s.db.ExecContext(ctx, "UPDATE users SET email_verified = true WHERE id = $1", userID)
+			if err != nil {
+				return fmt.Errorf("failed to adopt legacy user: %w", err)
+			}
+		} else {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to find legacy user: %w", err)
+			}
+
+			err = s.db.QueryRowContext(ctx, "INSERT INTO users (name, email, picture, password_hash, email_verified) VALUES ($1, $2, $3, $4, $5) RETURNING id", user.Name, user.Email, user.Picture, "", emailVerified).Scan(&userID)
+			if err != nil {
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+					return NewEmailAlreadyUsedError(pgErr)
+				}
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+		}
+
+		_, err = s.db.ExecContext(ctx, "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5)", userID, provider, subject, user.Email, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to create identity: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// LinkIdentity links a provider identity to an existing user.
+func (s *store) LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error {
+	var linkedUserID string
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&linkedUserID)
+	if err == nil {
+		if linkedUserID == userID {
+			return nil
+		}
+		return NewIdentityAlreadyLinkedError(fmt.Errorf("%s identity already linked to another user", provider))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5)", userID, provider, subject, email, time.Now().UTC())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return NewIdentityAlreadyLinkedError(pgErr)
+		}
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return nil
+}
+
+// UnlinkIdentity removes the identities of the given provider from a user.
+// It refuses to remove the last way the user has to log in.
+func (s *store) UnlinkIdentity(ctx context.Context, userID string, provider string) error {
+	var (
+		hasPassword        bool
+		otherIdentities    int
+		providerIdentities int
+	)
+	err := s.db.QueryRowContext(
+		ctx,
+		`
+	SELECT
+		users.password_hash != '',
+		(SELECT count(*) FROM user_identities WHERE user_id = users.id AND provider != $2),
+		(SELECT count(*) FROM user_identities WHERE user_id = users.id AND provider = $2)
+    FROM users
+    WHERE users.id = $1
+`,
+		userID, provider).Scan(&hasPassword, &otherIdentities, &providerIdentities)
+	if err != nil {
+		return fmt.Errorf("failed to count login methods: %w", err)
+	}
+
+	if providerIdentities == 0 {
+		return nil
+	}
+	if !hasPassword && otherIdentities == 0 {
+		return NewLastLoginMethodError(fmt.Errorf("%s is the last login method of the user", provider))
+	}
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM user_identities WHERE user_id = $1 AND provider = $2", userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	return nil
+}
+
+func (s *store) ListIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		provider,
+		email,
+		created_at
+    FROM user_identities
+    WHERE user_id = $1
+	ORDER BY created_at ASC
+`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []Identity
+
+	for rows.Next() {
+		var identity Identity
+		err = rows.Scan(&identity.Provider, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning identity: %w", err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindOrCreateUserByIdentityRefusesUnverifiedAccounts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+
+	squatterID, err := s.Signup(ctx, "Squatter", "identity-victim@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Signup() returned %v", err)
+	}
+
+	_, err = s.FindOrCreateUserByIdentity(ctx, "google", "victim-subject", &User{Name: "Victim", Email: "identity-victim@example.com"}, true)
+	if !IsEmailAlreadyUsedError(err) {
+		t.Fatalf("expected the unverified account not to be taken over, got %v", err)
+	}
+	user, err := s.GetUserByID(ctx, squatterID)
+	if err != nil || user == nil || user.EmailVerified {
+		t.Fatalf("expected the account to stay unverified, got %+v, %v", user, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM user_identities WHERE user_id = $1", squatterID); count != 0 {
+		t.Fatalf("expected no identity to be linked, got %d", count)
+	}
+}
+
+func TestFindOrCreateUserByIdentityAdoptsLegacyAccounts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	legacyID := createTestUser(t, s, "identity-legacy@example.com")
+
+	_, err := s.FindOrCreateUserByIdentity(ctx, "github", "legacy-subject", &User{Name: "Legacy", Email: "identity-legacy@example.com"}, false)
+	if !IsEmailAlreadyUsedError(err) {
+		t.Fatalf("expected an unverified email not to adopt the account, got %v", err)
+	}
+
+	userID, err := s.FindOrCreateUserByIdentity(ctx, "google", "legacy-subject", &User{Name: "Legacy", Email: "identity-legacy@example.com"}, true)
+	if err != nil || userID != legacyID {
+		t.Fatalf("FindOrCreateUserByIdentity() returned %s, %v", userID, err)
+	}
+	userID, err = s.FindOrCreateUserByIdentity(ctx, "google", "legacy-subject", &User{Name: "Legacy", Email: "identity-legacy@example.com"}, false)
+	if err != nil || userID != legacyID {
+		t.Fatalf("expected the linked identity to log in, got %s, %v", userID, err)
+	}
+}
+
+func TestFindOrCreateUserByIdentityKeepsUnverifiedEmails(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+
+	userID, err := s.FindOrCreateUserByIdentity(ctx, "github", "unverified-subject", &User{Name: "Unverified", Email: "identity-unverified@example.com"}, false)
+	if err != nil {
+		t.Fatalf("FindOrCreateUserByIdentity() returned %v", err)
+	}
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil || user == nil || user.EmailVerified {
+		t.Fatalf("expected the email the provider did not verify to stay unverified, got %+v, %v", user, err)
+	}
+}
+
+func TestLinkAndUnlinkIdentities(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	// without password, the identities are the only way to log in
+	userID := createTestUser(t, s, "identity-link@example.com")
+	otherID := createTestUser(t, s, "identity-link-other@example.com")
+
+	for _, provider := range []string{"google", "github"} {
+		if err := s.LinkIdentity(ctx, userID, provider, "link-"+provider, "identity-link@example.com"); err != nil {
+			t.Fatalf("LinkIdentity() returned %v", err)
+		}
+	}
+	// linking it again is a no-op
+	if err := s.LinkIdentity(ctx, userID, "google", "link-google", "identity-link@example.com"); err != nil {
+		t.Fatalf("LinkIdentity() returned %v for a linked identity", err)
+	}
+	if err := s.LinkIdentity(ctx, otherID, "google", "link-google", "identity-link-other@example.com"); !IsIdentityAlreadyLinkedError(err) {
+		t.Fatalf("expected the identity of another user not to be linked, got %v", err)
+	}
+
+	if err := s.UnlinkIdentity(ctx, userID, "google"); err != nil {
+		t.Fatalf("UnlinkIdentity() returned %v", err)
+	}
+	if err := s.UnlinkIdentity(ctx, userID, "github"); !IsLastLoginMethodError(err) {
+		t.Fatalf("expected the last login method not to be unlinked, got %v", err)
+	}
+	identities, err := s.ListIdentities(ctx, userID)
+	if err != nil || len(identities) != 1 || identities[0].Provider != "github" {
+		t.Fatalf("ListIdentities() returned %+v, %v", identities, err)
+	}
+
+	// the identity is free for another user once unlinked
+	if err := s.LinkIdentity(ctx, otherID, "google", "link-google", "identity-link-other@example.com"); err != nil {
+		t.Fatalf("LinkIdentity() returned %v", err)
+	}
+}
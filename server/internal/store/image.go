@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GiftImage is an image attached to a gift, such as a screenshot showing the
+// right color. Its content lives in the blob store.
+type GiftImage struct {
+	ID                   string    `json:"id"`
+	GiftID               string    `json:"gift_id"`
+	UploaderID           string    `json:"uploader_id"`
+	BlobKey              string    `json:"-"`
+	ContentType          string    `json:"content_type"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	Size                 int       `json:"size"`
+	ThumbnailKey         string    `json:"-"`
+	ThumbnailContentType string    `json:"-"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+const giftImageColumns = "id, COALESCE(gift_id::text, ''), uploader_id, blob_key, content_type, width, height, size, thumbnail_key, thumbnail_content_type, created_at"
+
+func scanGiftImage(row interface{ Scan(...any) error }) (GiftImage, error) {
+	var image GiftImage
+	err := row.Scan(&image.ID, &image.GiftID, &image.UploaderID, &image.BlobKey, &image.ContentType, &image.Width, &image.Height, &image.Size, &image.ThumbnailKey, &image.ThumbnailContentType, &image.CreatedAt)
+	return image, err
+}
+
+func (s *store) listGiftImages(ctx context.Context, query string, args ...any) ([]GiftImage, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gift images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []GiftImage{}
+	for rows.Next() {
+		image, err := scanGiftImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift image: %w", err)
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (s *store) CreateGiftImage(ctx context.Context, image GiftImage) (string, error) {
+	var imageID string
+	err := s.db.QueryRowContext(
+		ctx,
+		`
+	INSERT INTO gift_images (gift_id, uploader_id, blob_key, content_type, width, height, size, thumbnail_key, thumbnail_content_type, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id
+`,
+		image.GiftID, image.UploaderID, image.BlobKey, image.ContentType, image.Width, image.Height, image.Size, image.ThumbnailKey, image.ThumbnailContentType, time.Now().UTC()).Scan(&imageID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gift image: %w", err)
+	}
+	return imageID, nil
+}
+
+// ListGiftImages returns the images of the gift, oldest first.
+func (s *store) ListGiftImages(ctx context.Context, giftID string) ([]GiftImage, error) {
+	return s.listGiftImages(ctx, "SELECT "+giftImageColumns+" FROM gift_images WHERE gift_id = $1 ORDER BY created_at ASC", giftID)
+}
+
+// GetGiftImage returns an image of the gift, or nil if there is no such
+// image.
+func (s *store) GetGiftImage(ctx context.Context, giftID string, imageID string) (*GiftImage, error) {
+	image, err := scanGiftImage(s.db.QueryRowContext(ctx, "SELECT "+giftImageColumns+" FROM gift_images WHERE gift_id = $1 AND id = $2", giftID, imageID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get gift image: %w", err)
+	}
+	return &image, nil
+}
+
+// DetachGiftImage removes an image from its gift. Its blobs are deleted
+// later on, with those of the images of deleted gifts. It returns false if
+// there is no such image.
+func (s *store) DetachGiftImage(ctx context.Context, giftID string, imageID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE gift_images SET gift_id = NULL WHERE gift_id = $1 AND id = $2", giftID, imageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to detach gift image: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to detach gift image: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// ListDetachedGiftImages returns the images no longer attached to a gift,
+// whose blobs are to be deleted.
+func (s *store) ListDetachedGiftImages(ctx context.Context) ([]GiftImage, error) {
+	return s.listGiftImages(ctx, "SELECT "+giftImageColumns+" FROM gift_images WHERE gift_id IS NULL")
+}
+
+// DeleteGiftImage deletes an image once its blobs are deleted.
+func (s *store) DeleteGiftImage(ctx context.Context, imageID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM gift_images WHERE id = $1", imageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete gift image: %w", err)
+	}
+	return nil
+}
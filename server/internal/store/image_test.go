@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGiftImagesOfDeletedGiftsAreDetached(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "images@example.com")
+
+	eventID, err := s.CreateEvent(ctx, userID, "Christmas", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.CreateGift(ctx, userID, "Scarf", eventID, userID, nil, false); err != nil {
+		t.Fatalf("CreateGift() returned %v", err)
+	}
+	gifts, err := s.ListGifts(ctx, userID, eventID)
+	if err != nil || len(gifts) != 1 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	giftID := gifts[0].ID
+
+	var imageIDs []string
+	for _, key := range []string{"gifts/a", "gifts/b"} {
+		imageID, err := s.CreateGiftImage(ctx, GiftImage{
+			GiftID:               giftID,
+			UploaderID:           userID,
+			BlobKey:              key,
+			ContentType:          "image/png",
+			Width:                1,
+			Height:               1,
+			Size:                 1,
+			ThumbnailKey:         key + "-thumbnail",
+			ThumbnailContentType: "image/png",
+		})
+		if err != nil {
+			t.Fatalf("CreateGiftImage() returned %v", err)
+		}
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	if detached, err := s.DetachGiftImage(ctx, giftID, imageIDs[0]); err != nil || !detached {
+		t.Fatalf("DetachGiftImage() returned %v, %v", detached, err)
+	}
+	images, err := s.ListGiftImages(ctx, giftID)
+	if err != nil || len(images) != 1 || images[0].ID != imageIDs[1] {
+		t.Fatalf("ListGiftImages() returned %v, %v", images, err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM gifts WHERE id = $1", giftID); err != nil {
+		t.Fatalf("failed to delete gift: %v", err)
+	}
+	images, err = s.ListDetachedGiftImages(ctx)
+	if err != nil || len(images) != 2 || images[0].BlobKey == "" {
+		t.Fatalf("ListDetachedGiftImages() returned %v, %v", images, err)
+	}
+	for _, image := range images {
+		if err := s.DeleteGiftImage(ctx, image.ID); err != nil {
+			t.Fatalf("DeleteGiftImage() returned %v", err)
+		}
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gift_images"); count != 0 {
+		t.Fatalf("expected no image left, got %d", count)
+	}
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JoinLink lets whoever knows its token join an event.
+type JoinLink struct {
+	ID        string          `json:"id"`
+	EventID   string          `json:"event_id"`
+	Token     string          `json:"token"`
+	Role      ParticipantRole `json:"role"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	MaxUses   *int            `json:"max_uses,omitempty"`
+	Uses      int             `json:"uses"`
+}
+
+type InvalidJoinLinkError struct {
+	error
+}
+
+func NewInvalidJoinLinkError(err error) error {
+	return InvalidJoinLinkError{
+		error: err,
+	}
+}
+
+func IsInvalidJoinLinkError(err error) bool {
+	var linkErr InvalidJoinLinkError
+	return errors.As(err, &linkErr)
+}
+
+// activeJoinLinkCondition selects the join links that can be redeemed at $1.
+const activeJoinLinkCondition = "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $1) AND (max_uses IS NULL OR uses < max_uses)"
+
+func (s *store) CreateJoinLink(ctx context.Context, eventID string, userID string, token string, role ParticipantRole, expiresAt *time.Time, maxUses *int) (string, error) {
+	var linkID string
+	err := s.db.QueryRowContext(
+		ctx,
+		"INSERT INTO join_links (event_id, creator_id, token, participant_role, created_at, expires_at, max_uses) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		eventID, userID, token, role, time.Now().UTC(), expiresAt, maxUses).Scan(&linkID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create join link: %w", err)
+	}
+	return linkID, nil
+}
+
+// ListJoinLinks returns the join links of the event that can be redeemed at
+// now.
+func (s *store) ListJoinLinks(ctx context.Context, eventID string, now time.Time) ([]JoinLink, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		id,
+		event_id,
+		token,
+		participant_role,
+		created_at,
+		expires_at,
+		max_uses,
+		uses
+    FROM join_links
+    WHERE `+activeJoinLinkCondition+` AND event_id = $2
+	ORDER BY created_at DESC
+`,
+		now.UTC(), eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list join links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []JoinLink{}
+	for rows.Next() {
+		var (
+			link      JoinLink
+			expiresAt sql.NullTime
+			maxUses   sql.NullInt64
+		)
+		err = rows.Scan(&link.ID, &link.EventID, &link.Token, &link.Role, &link.CreatedAt, &expiresAt, &maxUses, &link.Uses)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning join link: %w", err)
+		}
+		if expiresAt.Valid {
+			link.ExpiresAt = &expiresAt.Time
+		}
+		if maxUses.Valid {
+			uses := int(maxUses.Int64)
+			link.MaxUses = &uses
+		}
+
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// RevokeJoinLink revokes a join link of the event at now. It returns false if
+// there is no such link.
+func (s *store) RevokeJoinLink(ctx context.Context, eventID string, linkID string, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE join_links SET revoked_at = $1 WHERE id = $2 AND event_id = $3 AND revoked_at IS NULL", now.UTC(), linkID, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke join link: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke join link: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// RedeemJoinLink makes the user join the event of the join link with token,
+// if it can be redeemed at now. Joining an event the user already participates
+// in does not use the link. It returns the ID of the event.
+func (s *store) RedeemJoinLink(ctx context.Context, token string, userID string, now time.Time) (string, error) {
+	var eventID string
+	err := s.withTx(ctx, func(s *store) error {
+		var (
+			linkID string
+			role   ParticipantRole
+		)
+		// lock the link so that concurrent redemptions cannot exceed its
+		// max uses
+		err := s.db.QueryRowContext(ctx, "SELECT id, event_id, participant_role FROM join_links WHERE "+activeJoinLinkCondition+" AND token = $2 FOR UPDATE", now.UTC(), token).Scan(&linkID, &eventID, &role)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewInvalidJoinLinkError(errors.New("no active join link with this token"))
+			}
+			return fmt.Errorf("failed to get join link: %w", err)
+		}
+
+		result, err := s.db.ExecContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role) VALUES ($1, $2, $3) ON CONFLICT (user_id, event_id) DO NOTHING", userID, eventID, role)
+		if err != nil {
+			return fmt.Errorf("failed to create participant: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to create participant: %w", err)
+		}
+		if affected == 0 {
+			return nil
+		}
+
+		_, err = s.db.ExecContext(ctx, "UPDATE join_links SET uses = uses + 1 WHERE id = $1", linkID)
+		if err != nil {
+			return fmt.Errorf("failed to use join link: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return eventID, nil
+}
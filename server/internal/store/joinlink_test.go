@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedeemJoinLink(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	creatorID := createTestUser(t, s, "link-creator@example.com")
+	firstID := createTestUser(t, s, "link-first@example.com")
+	secondID := createTestUser(t, s, "link-second@example.com")
+	thirdID := createTestUser(t, s, "link-third@example.com")
+	if _, err := s.CreateEvent(ctx, creatorID, "Family", now, "", ChristmasEventType, nil, NoRecurrence, time.Time{}); err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	var eventID string
+	if err := s.db.QueryRowContext(ctx, "SELECT id FROM events WHERE creator_id = $1", creatorID).Scan(&eventID); err != nil {
+		t.Fatalf("failed to get event: %v", err)
+	}
+
+	maxUses := 2
+	if _, err := s.CreateJoinLink(ctx, eventID, creatorID, "two-uses", MemberParticipantRole, nil, &maxUses); err != nil {
+		t.Fatalf("CreateJoinLink() returned %v", err)
+	}
+
+	joinedID, err := s.RedeemJoinLink(ctx, "two-uses", firstID, now)
+	if err != nil || joinedID != eventID {
+		t.Fatalf("RedeemJoinLink() returned %v, %v", joinedID, err)
+	}
+	// joining again does not use the link
+	if _, err := s.RedeemJoinLink(ctx, "two-uses", firstID, now); err != nil {
+		t.Fatalf("RedeemJoinLink() returned %v for a participant", err)
+	}
+	// the link gives its role, while the creator owns the event
+	if role, ok, err := s.GetParticipantRole(ctx, eventID, firstID); err != nil || !ok || role != MemberParticipantRole {
+		t.Fatalf("GetParticipantRole() returned %v, %v, %v for a member", role, ok, err)
+	}
+	if role, ok, err := s.GetParticipantRole(ctx, eventID, creatorID); err != nil || !ok || role != OwnerParticipantRole {
+		t.Fatalf("GetParticipantRole() returned %v, %v, %v for the creator", role, ok, err)
+	}
+	if _, ok, err := s.GetParticipantRole(ctx, eventID, thirdID); err != nil || ok {
+		t.Fatalf("GetParticipantRole() returned %v, %v for a stranger", ok, err)
+	}
+	// participants added by email are members as well
+	addedID := createTestUser(t, s, "link-added@example.com")
+	if err := s.AddEventParticipant(ctx, eventID, "link-added@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+	if role, ok, err := s.GetParticipantRole(ctx, eventID, addedID); err != nil || !ok || role != MemberParticipantRole {
+		t.Fatalf("GetParticipantRole() returned %v, %v, %v for an added participant", role, ok, err)
+	}
+	if _, err := s.RedeemJoinLink(ctx, "two-uses", secondID, now); err != nil {
+		t.Fatalf("RedeemJoinLink() returned %v", err)
+	}
+	if _, err := s.RedeemJoinLink(ctx, "two-uses", thirdID, now); !IsInvalidJoinLinkError(err) {
+		t.Fatalf("expected the used up link to be invalid, got %v", err)
+	}
+
+	links, err := s.ListJoinLinks(ctx, eventID, now)
+	if err != nil || len(links) != 0 {
+		t.Fatalf("expected no active link, got %v, %v", links, err)
+	}
+}
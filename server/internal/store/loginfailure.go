@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FailedLogin is an audit record of a rejected login attempt.
+type FailedLogin struct {
+	Email string
+	// UserID is empty when the attempt could not be tied to a user.
+	UserID string
+	IP     string
+	Reason string
+}
+
+func (s *store) RecordFailedLogin(ctx context.Context, attempt FailedLogin) error {
+	var userID sql.NullString
+	if attempt.UserID != "" {
+		userID = sql.NullString{String: attempt.UserID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO failed_logins (email, user_id, ip, reason, created_at) VALUES ($1, $2, $3, $4, $5)", attempt.Email, userID, attempt.IP, attempt.Reason, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record failed login: %w", err)
+	}
+	return nil
+}
+
+func (s *store) recordLoginFailure(ctx context.Context, key string, at time.Time, since time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+	INSERT INTO login_failures (key, failures, last_failure)
+	VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_failures.last_failure < $3 THEN 1 ELSE login_failures.failures + 1 END,
+		last_failure = $2
+`,
+		key, at.UTC(), since.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return nil
+}
+
+// ChargeLoginFailure adds a failure of key at time at, starting over from 1
+// if the previous failures happened before since, provided allow accepts the
+// failures so far. The row of key is locked meanwhile, so that concurrent
+// attempts are checked one after the other.
+func (s *store) ChargeLoginFailure(ctx context.Context, key string, allow func(failures int, lastFailure time.Time) bool, at time.Time, since time.Time) (bool, error) {
+	charged := false
+	err := s.withTx(ctx, func(s *store) error {
+		charged = false
+		_, err := s.db.ExecContext(ctx, "INSERT INTO login_failures (key, failures, last_failure) VALUES ($1, 0, $2) ON CONFLICT (key) DO NOTHING", key, at.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to create login failures: %w", err)
+		}
+
+		var (
+			failures    int
+			lastFailure time.Time
+		)
+		err = s.db.QueryRowContext(ctx, "SELECT failures, last_failure FROM login_failures WHERE key = $1 FOR UPDATE", key).Scan(&failures, &lastFailure)
+		if err != nil {
+			return fmt.Errorf("failed to get login failures: %w", err)
+		}
+		if !allow(failures, lastFailure) {
+			return nil
+		}
+
+		if err := s.recordLoginFailure(ctx, key, at, since); err != nil {
+			return err
+		}
+		charged = true
+		return nil
+	})
+	return charged, err
+}
+
+func (s *store) RefundLoginFailure(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_failures SET failures = failures - 1 WHERE key = $1 AND failures > 0", key)
+	if err != nil {
+		return fmt.Errorf("failed to refund login failure: %w", err)
+	}
+	return nil
+}
+
+func (s *store) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE key = $1", key)
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func (s *store) GetEventParticipants(ctx context.Context, eventID string) ([]User, error) {
@@ -68,21 +71,176 @@ func IsUnknownParticipantError(err error) bool {
 	return errors.As(err, &unknownErr)
 }
 
-func (s *store) AddEventParticipant(ctx context.Context, eventID string, userEmail string) error {
-	var userID string
-	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1", userEmail).Scan(&userID)
+type UnverifiedParticipantError struct {
+	error
+}
+
+func NewUnverifiedParticipantError(err error) error {
+	return UnverifiedParticipantError{
+		error: err,
+	}
+}
+
+func IsUnverifiedParticipantError(err error) bool {
+	var unverifiedErr UnverifiedParticipantError
+	return errors.As(err, &unverifiedErr)
+}
+
+type AlreadyParticipantError struct {
+	error
+}
+
+func NewAlreadyParticipantError(err error) error {
+	return AlreadyParticipantError{
+		error: err,
+	}
+}
+
+func IsAlreadyParticipantError(err error) bool {
+	var participantErr AlreadyParticipantError
+	return errors.As(err, &participantErr)
+}
+
+type CreatorCannotLeaveError struct {
+	error
+}
+
+func NewCreatorCannotLeaveError(err error) error {
+	return CreatorCannotLeaveError{
+		error: err,
+	}
+}
+
+func IsCreatorCannotLeaveError(err error) bool {
+	var creatorErr CreatorCannotLeaveError
+	return errors.As(err, &creatorErr)
+}
+
+// findParticipantByEmail returns the user that can be added to an event
+// through their email.
+func (s *store) findParticipantByEmail(ctx context.Context, userEmail string) (string, error) {
+	var (
+		userID        string
+		emailVerified bool
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT id, email_verified FROM users WHERE email = $1", userEmail).Scan(&userID, &emailVerified)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return NewUnknownParticipantError(fmt.Errorf("no user with email %s", userEmail))
+			return "", NewUnknownParticipantError(fmt.Errorf("no user with email %s", userEmail))
 		}
-		return fmt.Errorf("failed to get user: %w", err)
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if !emailVerified {
+		// anybody can sign up with any email, so an unverified account
+		// must not be mistaken for the owner of the email
+		return "", NewUnverifiedParticipantError(fmt.Errorf("user with email %s is not verified", userEmail))
+	}
+
+	return userID, nil
+}
+
+func (s *store) AddEventParticipant(ctx context.Context, eventID string, userEmail string) error {
+	userID, err := s.findParticipantByEmail(ctx, userEmail)
+	if err != nil {
+		return err
 	}
 
 	var participantID string
-	err = s.db.QueryRowContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role) VALUES ($1, $2, $3) RETURNING id", userID, eventID, OwnerParticipantRole).Scan(&participantID)
+	err = s.db.QueryRowContext(ctx, "INSERT INTO participants (user_id, event_id, participant_role) VALUES ($1, $2, $3) RETURNING id", userID, eventID, MemberParticipantRole).Scan(&participantID)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return NewAlreadyParticipantError(pgErr)
+		}
 		return fmt.Errorf("failed to create participant: %w", err)
 	}
 
 	return nil
 }
+
+// GetParticipantRole returns the role of the user in an event. It returns
+// false if they do not participate in it.
+func (s *store) GetParticipantRole(ctx context.Context, eventID string, userID string) (ParticipantRole, bool, error) {
+	var role ParticipantRole
+	err := s.db.QueryRowContext(ctx, "SELECT participant_role FROM participants WHERE event_id = $1 AND user_id = $2", eventID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get participant role: %w", err)
+	}
+	return role, true, nil
+}
+
+// RemoveEventParticipant removes a user from an event. The creator of the
+// event cannot be removed, they delete the event instead. What the user leaves
+// behind in the event is handled so that nobody waits on them:
+//   - gifts and wishlist items they reserved but did not buy yet are
+//     released, bought ones are kept,
+//   - gifts addressed to them are put in the trash, as nobody is to offer
+//     them anymore,
+//   - gifts and comments they created for others are kept.
+//
+// It returns false if the user did not participate in the event.
+func (s *store) RemoveEventParticipant(ctx context.Context, eventID string, userID string) (bool, error) {
+	var removed bool
+	err := s.withTx(ctx, func(s *store) error {
+		var creatorID string
+		// lock the event so that its creator does not change meanwhile
+		err := s.db.QueryRowContext(ctx, "SELECT creator_id FROM events WHERE id = $1 FOR UPDATE", eventID).Scan(&creatorID)
+		if err != nil {
+			return fmt.Errorf("failed to get event: %w", err)
+		}
+		if creatorID == userID {
+			return NewCreatorCannotLeaveError(fmt.Errorf("user %s created event %s", userID, eventID))
+		}
+
+		result, err := s.db.ExecContext(ctx, "DELETE FROM participants WHERE event_id = $1 AND user_id = $2", eventID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to remove participant: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to remove participant: %w", err)
+		}
+		if affected == 0 {
+			return nil
+		}
+		removed = true
+
+		err = s.updateGiftContents(ctx, releaseReservation, "SELECT id, content FROM gifts WHERE event_id = $1 AND content::jsonb->>'from' = $2", eventID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to release reservations: %w", err)
+		}
+
+		err = s.updateGiftContents(
+			ctx,
+			func(content *GiftContent) bool {
+				if content.Status == MarkedForDeletionGiftStatus {
+					return false
+				}
+				trashGift(content)
+				return true
+			},
+			"SELECT id, content FROM gifts WHERE event_id = $1 AND content::jsonb->>'to' = $2", eventID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete gifts to participant: %w", err)
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE gifts SET deleted_at = $3 WHERE event_id = $1 AND content::jsonb->>'to' = $2 AND deleted_at IS NULL", eventID, userID, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to delete gifts to participant: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_reservations WHERE event_id = $1 AND buyer_id = $2 AND status = $3", eventID, userID, AboutToBeBoughtGiftStatus)
+		if err != nil {
+			return fmt.Errorf("failed to release wishlist reservations: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return removed, nil
+}
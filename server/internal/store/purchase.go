@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GiftPurchase tracks a bought gift until it is delivered. Only its buyer
+// sees it.
+type GiftPurchase struct {
+	PurchasedAt    *time.Time `json:"purchased_at,omitempty"`
+	Store          string     `json:"store,omitempty"`
+	OrderReference string     `json:"order_reference,omitempty"`
+	Carrier        string     `json:"carrier,omitempty"`
+	TrackingNumber string     `json:"tracking_number,omitempty"`
+	TrackingURL    string     `json:"tracking_url,omitempty"`
+	// DeliveredAt is when the gift was delivered, nil until then.
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// ThankYouNote is the note of the recipient of a gift to its buyer.
+type ThankYouNote struct {
+	// GiftID is the ID of the gift, or of the wishlist item for the notes on
+	// wishlist items.
+	GiftID     string     `json:"gift_id"`
+	AuthorID   string     `json:"author_id"`
+	Message    string     `json:"message"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+}
+
+// UpdateGiftPurchase sets the purchase of a gift userID bought. It returns
+// false if userID did not buy the gift.
+func (s *store) UpdateGiftPurchase(ctx context.Context, userID string, giftID string, eventID string, purchase GiftPurchase) (bool, error) {
+	updated := false
+	err := s.withTx(ctx, func(s *store) error {
+		updated = false
+		setPurchase := func(content *GiftContent) bool {
+			if content.Status != BoughtGiftStatus {
+				return false
+			}
+			content.Purchase = &purchase
+			updated = true
+			return true
+		}
+		// lock the gift so that its buyer does not change meanwhile
+		return s.updateGiftContents(ctx, setPurchase, "SELECT id, content FROM gifts WHERE id = $1 AND event_id = $2 AND content::jsonb->>'from' = $3 FOR UPDATE", giftID, eventID, userID)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update purchase: %w", err)
+	}
+
+	return updated, nil
+}
+
+// SetThankYouNote writes the thank-you note of userID for a gift, replacing
+// the one they already wrote.
+func (s *store) SetThankYouNote(ctx context.Context, userID string, giftID string, message string, now time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`
+	INSERT INTO thank_you_notes (gift_id, author_id, message, created_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (gift_id) DO UPDATE SET author_id = excluded.author_id, message = excluded.message, modified_at = excluded.created_at
+`,
+		giftID, userID, message, now.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to set thank-you note: %w", err)
+	}
+
+	return nil
+}
+
+// GetThankYouNote returns the thank-you note for a gift, nil if there is
+// none.
+func (s *store) GetThankYouNote(ctx context.Context, giftID string) (*ThankYouNote, error) {
+	var note ThankYouNote
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT gift_id, author_id, message, created_at, modified_at FROM thank_you_notes WHERE gift_id = $1",
+		giftID).Scan(&note.GiftID, &note.AuthorID, &note.Message, &note.CreatedAt, &note.ModifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get thank-you note: %w", err)
+	}
+
+	return &note, nil
+}
+
+// SetWishlistThankYouNote writes the thank-you note of userID for an item of
+// their wishlist bought in the event, replacing the one they already wrote.
+// It returns false if the item was not bought in the event.
+func (s *store) SetWishlistThankYouNote(ctx context.Context, userID string, eventID string, itemID string, message string, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`
+	INSERT INTO wishlist_thank_you_notes (reservation_id, author_id, message, created_at)
+	SELECT wishlist_reservations.id, wishlist_items.user_id, $4, $5
+	FROM wishlist_reservations
+	JOIN wishlist_items ON wishlist_reservations.item_id = wishlist_items.id
+	WHERE wishlist_reservations.item_id = $1 AND wishlist_reservations.event_id = $2
+		AND wishlist_items.user_id = $3 AND wishlist_reservations.status = $6
+	ON CONFLICT (reservation_id) DO UPDATE SET message = excluded.message, modified_at = excluded.created_at
+`,
+		itemID, eventID, userID, message, now.UTC(), BoughtGiftStatus)
+	if err != nil {
+		return false, fmt.Errorf("failed to set thank-you note: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to set thank-you note: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// GetWishlistThankYouNote returns the thank-you note for a wishlist item
+// bought in the event, nil if there is none.
+func (s *store) GetWishlistThankYouNote(ctx context.Context, eventID string, itemID string) (*ThankYouNote, error) {
+	var note ThankYouNote
+	err := s.db.QueryRowContext(
+		ctx,
+		`
+	SELECT wishlist_reservations.item_id, wishlist_thank_you_notes.author_id, wishlist_thank_you_notes.message, wishlist_thank_you_notes.created_at, wishlist_thank_you_notes.modified_at
+	FROM wishlist_thank_you_notes
+	JOIN wishlist_reservations ON wishlist_thank_you_notes.reservation_id = wishlist_reservations.id
+	WHERE wishlist_reservations.item_id = $1 AND wishlist_reservations.event_id = $2
+`,
+		itemID, eventID).Scan(&note.GiftID, &note.AuthorID, &note.Message, &note.CreatedAt, &note.ModifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get thank-you note: %w", err)
+	}
+
+	return &note, nil
+}
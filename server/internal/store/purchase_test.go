@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGiftPurchase(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf")
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+	giftID := event.GiftIDs["Scarf"]
+
+	purchase := GiftPurchase{Store: "Corner shop", TrackingNumber: "1Z999", DeliveredAt: &now}
+	if err := s.UpdateGift(ctx, friendID, giftID, eventID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	updated, err := s.UpdateGiftPurchase(ctx, friendID, giftID, eventID, purchase)
+	if err != nil || updated {
+		t.Fatalf("expected reserved gifts not to be tracked, got %v, %v", updated, err)
+	}
+	if err := s.UpdateGift(ctx, friendID, giftID, eventID, BoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	updated, err = s.UpdateGiftPurchase(ctx, creatorID, giftID, eventID, purchase)
+	if err != nil || updated {
+		t.Fatalf("expected only the buyer to track the gift, got %v, %v", updated, err)
+	}
+	updated, err = s.UpdateGiftPurchase(ctx, friendID, giftID, eventID, purchase)
+	if err != nil || !updated {
+		t.Fatalf("UpdateGiftPurchase() returned %v, %v", updated, err)
+	}
+	gift, err := s.GetGift(ctx, eventID, giftID)
+	if err != nil || gift == nil || gift.Content.Purchase == nil || gift.Content.Purchase.Store != "Corner shop" || gift.Content.Purchase.DeliveredAt == nil {
+		t.Fatalf("GetGift() returned %+v, %v", gift, err)
+	}
+
+	note, err := s.GetThankYouNote(ctx, giftID)
+	if err != nil || note != nil {
+		t.Fatalf("GetThankYouNote() returned %v, %v", note, err)
+	}
+	for _, message := range []string{"Thanks!", "Thanks, it is lovely!"} {
+		if err := s.SetThankYouNote(ctx, creatorID, giftID, message, now); err != nil {
+			t.Fatalf("SetThankYouNote() returned %v", err)
+		}
+	}
+	note, err = s.GetThankYouNote(ctx, giftID)
+	if err != nil || note == nil || note.Message != "Thanks, it is lovely!" || note.AuthorID != creatorID || note.ModifiedAt == nil {
+		t.Fatalf("GetThankYouNote() returned %+v, %v", note, err)
+	}
+
+	if err := s.UpdateGift(ctx, friendID, giftID, eventID, NewGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	gift, err = s.GetGift(ctx, eventID, giftID)
+	if err != nil || gift == nil || gift.Content.Purchase != nil {
+		t.Fatalf("expected the purchase to be cleared, got %+v, %v", gift, err)
+	}
+}
+
+func TestWishlistThankYouNote(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+
+	itemID, err := s.CreateWishlistItem(ctx, creatorID, "Book", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, friendID, eventID, itemID, AboutToBeBoughtGiftStatus, now); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+	// a reserved item may still not be bought
+	if set, err := s.SetWishlistThankYouNote(ctx, creatorID, eventID, itemID, "Thanks!", now); err != nil || set {
+		t.Fatalf("expected reserved items not to be thanked for, got %v, %v", set, err)
+	}
+	if err := s.ReserveWishlistItem(ctx, friendID, eventID, itemID, BoughtGiftStatus, now); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+	if set, err := s.SetWishlistThankYouNote(ctx, friendID, eventID, itemID, "Thanks!", now); err != nil || set {
+		t.Fatalf("expected only the owner of the item to thank for it, got %v, %v", set, err)
+	}
+
+	for _, message := range []string{"Thanks!", "Thanks, it is lovely!"} {
+		if set, err := s.SetWishlistThankYouNote(ctx, creatorID, eventID, itemID, message, now); err != nil || !set {
+			t.Fatalf("SetWishlistThankYouNote() returned %v, %v", set, err)
+		}
+	}
+	note, err := s.GetWishlistThankYouNote(ctx, eventID, itemID)
+	if err != nil || note == nil || note.GiftID != itemID || note.Message != "Thanks, it is lovely!" || note.AuthorID != creatorID || note.ModifiedAt == nil {
+		t.Fatalf("GetWishlistThankYouNote() returned %+v, %v", note, err)
+	}
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReactionTarget is what users vote and react on.
+type ReactionTarget int
+
+const (
+	GiftReactionTarget = iota
+	CommentReactionTarget
+)
+
+// tables returns the tables of the votes and reactions on t, and the column
+// referencing what they are on.
+func (t ReactionTarget) tables() (votes string, reactions string, column string) {
+	if t == CommentReactionTarget {
+		return "comment_votes", "comment_reactions", "comment_id"
+	}
+	return "gift_votes", "gift_reactions", "gift_id"
+}
+
+// ReactionCount counts the users who reacted with an emoji.
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	// Reacted tells whether the user asking is one of them.
+	Reacted bool `json:"reacted"`
+}
+
+// ReactionSummary aggregates the votes and reactions on a gift or comment.
+type ReactionSummary struct {
+	Upvotes   int `json:"upvotes"`
+	Downvotes int `json:"downvotes"`
+	// Vote is the vote of the user asking: 1, -1, or 0 if they did not vote.
+	Vote      int             `json:"vote"`
+	Reactions []ReactionCount `json:"reactions"`
+}
+
+// ToggleVote sets the vote of userID on the target with targetID to value, 1
+// or -1, or removes it if they already voted so. It returns their vote now,
+// 0 if removed.
+func (s *store) ToggleVote(ctx context.Context, target ReactionTarget, targetID string, userID string, value int, now time.Time) (int, error) {
+	votes, _, column := target.tables()
+
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND user_id = $2 AND value = $3", votes, column), targetID, userID, value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete vote: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete vote: %w", err)
+	}
+	if deleted > 0 {
+		return 0, nil
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (%s, user_id, value, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (%s, user_id) DO UPDATE SET value = excluded.value, created_at = excluded.created_at", votes, column, column),
+		targetID, userID, value, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create vote: %w", err)
+	}
+
+	return value, nil
+}
+
+// ToggleReaction adds the reaction of userID with emoji on the target with
+// targetID, or removes it if they already reacted so. It returns whether
+// they react so now.
+func (s *store) ToggleReaction(ctx context.Context, target ReactionTarget, targetID string, userID string, emoji string, now time.Time) (bool, error) {
+	_, reactions, column := target.tables()
+
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND user_id = $2 AND emoji = $3", reactions, column), targetID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	if deleted > 0 {
+		return false, nil
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (%s, user_id, emoji, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (%s, user_id, emoji) DO NOTHING", reactions, column, column),
+		targetID, userID, emoji, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to create reaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetReactionSummary aggregates the votes and reactions on the target with
+// targetID, as seen by userID. Reactions come in the order they were first
+// used.
+func (s *store) GetReactionSummary(ctx context.Context, target ReactionTarget, targetID string, userID string) (ReactionSummary, error) {
+	summaries, err := s.GetReactionSummaries(ctx, target, []string{targetID}, userID)
+	if err != nil {
+		return ReactionSummary{Reactions: []ReactionCount{}}, err
+	}
+	return summaries[targetID], nil
+}
+
+// GetReactionSummaries aggregates the votes and reactions on the targets
+// with targetIDs at once, like GetReactionSummary. It returns the summaries
+// by target ID, with one for every target.
+func (s *store) GetReactionSummaries(ctx context.Context, target ReactionTarget, targetIDs []string, userID string) (map[string]ReactionSummary, error) {
+	votes, reactions, column := target.tables()
+	summaries := make(map[string]ReactionSummary, len(targetIDs))
+	for _, targetID := range targetIDs {
+		summaries[targetID] = ReactionSummary{Reactions: []ReactionCount{}}
+	}
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+	SELECT
+		%s,
+		count(*) FILTER (WHERE value > 0),
+		count(*) FILTER (WHERE value < 0),
+		coalesce(max(value) FILTER (WHERE user_id::text = $2), 0)
+	FROM %s
+	WHERE %s = ANY($1::text[]::int[])
+	GROUP BY %s
+`, column, votes, column, column),
+		targetIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			targetID string
+			summary  = ReactionSummary{Reactions: []ReactionCount{}}
+		)
+		err = rows.Scan(&targetID, &summary.Upvotes, &summary.Downvotes, &summary.Vote)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning votes: %w", err)
+		}
+		summaries[targetID] = summary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+
+	rows, err = s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+	SELECT %s, emoji, count(*), bool_or(user_id::text = $2)
+	FROM %s
+	WHERE %s = ANY($1::text[]::int[])
+	GROUP BY %s, emoji
+	ORDER BY %s, min(created_at), emoji
+`, column, reactions, column, column, column),
+		targetIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			targetID string
+			reaction ReactionCount
+		)
+		err = rows.Scan(&targetID, &reaction.Emoji, &reaction.Count, &reaction.Reacted)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reaction: %w", err)
+		}
+
+		summary := summaries[targetID]
+		summary.Reactions = append(summary.Reactions, reaction)
+		summaries[targetID] = summary
+	}
+
+	return summaries, nil
+}
+
+// ToggleGiftVote adds the up vote of userID for a gift, or removes it if they
+// already voted for it. It returns whether they vote for the gift now.
+//
+// Deprecated: use ToggleVote, which also takes down votes.
+func (s *store) ToggleGiftVote(ctx context.Context, userID string, giftID string, now time.Time) (bool, error) {
+	vote, err := s.ToggleVote(ctx, GiftReactionTarget, giftID, userID, 1, now)
+	if err != nil {
+		return false, err
+	}
+	return vote == 1, nil
+}
+
+// CountGiftVotes returns the number of up votes for a gift and whether
+// userID is one of the voters.
+//
+// Deprecated: use GetReactionSummary, which also counts down votes.
+func (s *store) CountGiftVotes(ctx context.Context, giftID string, userID string) (int, bool, error) {
+	summary, err := s.GetReactionSummary(ctx, GiftReactionTarget, giftID, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	return summary.Upvotes, summary.Vote == 1, nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestToggleReactions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf")
+	creatorID, friendID, giftID := event.CreatorID, event.FriendID, event.GiftIDs["Scarf"]
+
+	vote, err := s.ToggleVote(ctx, GiftReactionTarget, giftID, friendID, 1, now)
+	if err != nil || vote != 1 {
+		t.Fatalf("ToggleVote() returned %d, %v", vote, err)
+	}
+	vote, err = s.ToggleVote(ctx, GiftReactionTarget, giftID, friendID, -1, now)
+	if err != nil || vote != -1 {
+		t.Fatalf("ToggleVote() returned %d, %v", vote, err)
+	}
+	summary, err := s.GetReactionSummary(ctx, GiftReactionTarget, giftID, friendID)
+	if err != nil || summary.Upvotes != 0 || summary.Downvotes != 1 || summary.Vote != -1 {
+		t.Fatalf("GetReactionSummary() returned %+v, %v", summary, err)
+	}
+	vote, err = s.ToggleVote(ctx, GiftReactionTarget, giftID, friendID, -1, now)
+	if err != nil || vote != 0 {
+		t.Fatalf("ToggleVote() returned %d, %v", vote, err)
+	}
+
+	if err := s.CreateComment(ctx, creatorID, giftID, "Blue please"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+	comments, err := s.ListComments(ctx, giftID)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("ListComments() returned %v, %v", comments, err)
+	}
+	commentID := comments[0].ID
+
+	for _, userID := range []string{creatorID, friendID} {
+		reacted, err := s.ToggleReaction(ctx, CommentReactionTarget, commentID, userID, "🎉", now)
+		if err != nil || !reacted {
+			t.Fatalf("ToggleReaction() returned %v, %v", reacted, err)
+		}
+	}
+	reacted, err := s.ToggleReaction(ctx, CommentReactionTarget, commentID, friendID, "🎉", now)
+	if err != nil || reacted {
+		t.Fatalf("ToggleReaction() returned %v, %v", reacted, err)
+	}
+	summary, err = s.GetReactionSummary(ctx, CommentReactionTarget, commentID, creatorID)
+	if err != nil || len(summary.Reactions) != 1 || summary.Reactions[0].Count != 1 || !summary.Reactions[0].Reacted {
+		t.Fatalf("GetReactionSummary() returned %+v, %v", summary, err)
+	}
+}
+
+func TestGetReactionSummaries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf", "Hat", "Gloves")
+	friendID, giftIDs := event.FriendID, event.GiftIDs
+
+	// the former votes on ideas are up votes
+	voted, err := s.ToggleGiftVote(ctx, friendID, giftIDs["Scarf"], now)
+	if err != nil || !voted {
+		t.Fatalf("ToggleGiftVote() returned %v, %v", voted, err)
+	}
+	votes, voted, err := s.CountGiftVotes(ctx, giftIDs["Scarf"], friendID)
+	if err != nil || votes != 1 || !voted {
+		t.Fatalf("CountGiftVotes() returned %d, %v, %v", votes, voted, err)
+	}
+	if _, err := s.ToggleReaction(ctx, GiftReactionTarget, giftIDs["Hat"], friendID, "❤️", now); err != nil {
+		t.Fatalf("ToggleReaction() returned %v", err)
+	}
+
+	summaries, err := s.GetReactionSummaries(ctx, GiftReactionTarget, []string{giftIDs["Scarf"], giftIDs["Hat"], giftIDs["Gloves"]}, friendID)
+	if err != nil || len(summaries) != 3 {
+		t.Fatalf("GetReactionSummaries() returned %+v, %v", summaries, err)
+	}
+	if summary := summaries[giftIDs["Scarf"]]; summary.Upvotes != 1 || summary.Vote != 1 || len(summary.Reactions) != 0 {
+		t.Fatalf("unexpected summary of the voted gift: %+v", summary)
+	}
+	if summary := summaries[giftIDs["Hat"]]; summary.Upvotes != 0 || len(summary.Reactions) != 1 || summary.Reactions[0].Emoji != "❤️" {
+		t.Fatalf("unexpected summary of the gift reacted on: %+v", summary)
+	}
+	if summary := summaries[giftIDs["Gloves"]]; summary.Upvotes != 0 || summary.Reactions == nil || len(summary.Reactions) != 0 {
+		t.Fatalf("unexpected summary of the gift without reactions: %+v", summary)
+	}
+}
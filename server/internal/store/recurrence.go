@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RecurrenceRule int
+
+const (
+	NoRecurrence = iota
+	// YearlyRecurrence repeats the event every year on the same date.
+	YearlyRecurrence
+	// BirthdayRecurrence repeats a birthday event on every birthday of its
+	// honoree, the recurrence date being their birth date.
+	BirthdayRecurrence
+)
+
+// Valid tells whether r is a known recurrence rule.
+func (r RecurrenceRule) Valid() bool {
+	return r >= NoRecurrence && r <= BirthdayRecurrence
+}
+
+func (r RecurrenceRule) date(recurrenceDate time.Time) sql.NullTime {
+	if r == NoRecurrence {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: recurrenceDate, Valid: true}
+}
+
+// anniversary returns the occurrence of recurrenceDate in year. Occurrences of
+// February 29th fall on February 28th in common years.
+func anniversary(recurrenceDate time.Time, year int) time.Time {
+	month, day := recurrenceDate.Month(), recurrenceDate.Day()
+	if month == time.February && day == 29 && time.Date(year, time.March, 0, 0, 0, 0, 0, time.UTC).Day() != 29 {
+		day = 28
+	}
+	return time.Date(year, month, day, recurrenceDate.Hour(), recurrenceDate.Minute(), recurrenceDate.Second(), 0, recurrenceDate.Location())
+}
+
+// NextOccurrence returns the first anniversary of recurrenceDate after after.
+func NextOccurrence(recurrenceDate time.Time, after time.Time) time.Time {
+	for year := after.Year(); ; year++ {
+		if date := anniversary(recurrenceDate, year); date.After(after) {
+			return date
+		}
+	}
+}
+
+// nextOccurrenceName returns the name of the occurrence of an event on date,
+// updating the year it may mention.
+func nextOccurrenceName(name string, previousDate time.Time, date time.Time) string {
+	return strings.ReplaceAll(name, strconv.Itoa(previousDate.Year()), strconv.Itoa(date.Year()))
+}
+
+func latest(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+type NotRecurringEventError struct {
+	error
+}
+
+func NewNotRecurringEventError(err error) error {
+	return NotRecurringEventError{
+		error: err,
+	}
+}
+
+func IsNotRecurringEventError(err error) bool {
+	var recurringErr NotRecurringEventError
+	return errors.As(err, &recurringErr)
+}
+
+type AlreadyRolledOverError struct {
+	error
+}
+
+func NewAlreadyRolledOverError(err error) error {
+	return AlreadyRolledOverError{
+		error: err,
+	}
+}
+
+func IsAlreadyRolledOverError(err error) bool {
+	var rolledOverErr AlreadyRolledOverError
+	return errors.As(err, &rolledOverErr)
+}
+
+// ListEventsToRollOver returns the recurring events that took place before
+// before and were not rolled over yet. Archived events are left alone, their
+// owners archived them on purpose.
+func (s *store) ListEventsToRollOver(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM events WHERE recurrence != $1 AND next_event_id IS NULL AND archived_at IS NULL AND date < $2", NoRecurrence, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events to roll over: %w", err)
+	}
+	defer rows.Close()
+
+	var eventIDs []string
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("error scanning event: %w", err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list events to roll over: %w", err)
+	}
+
+	return eventIDs, nil
+}
+
+// RollOverEvent creates the next occurrence of a recurring event, with the same
+// participants and groups. Gifts not bought yet are carried over to it along with their
+// comments, while bought and deleted ones stay in the previous occurrence,
+// which is archived as their history. The new occurrence is the first one after
+// both the event and now, so that long past events do not roll over one year at
+// a time. It returns the ID of the new occurrence.
+func (s *store) RollOverEvent(ctx context.Context, eventID string, now time.Time) (string, error) {
+	var newEventID string
+	err := s.withTx(ctx, func(s *store) error {
+		var (
+			creatorID      string
+			name           string
+			description    string
+			date           time.Time
+			eventType      EventType
+			recurrence     RecurrenceRule
+			recurrenceDate sql.NullTime
+			nextEventID    sql.NullString
+		)
+		// lock the event so that it cannot be rolled over twice concurrently
+		err := s.db.QueryRowContext(ctx, "SELECT creator_id, name, date, description, type, recurrence, recurrence_date, next_event_id FROM events WHERE id = $1 FOR UPDATE", eventID).Scan(&creatorID, &name, &date, &description, &eventType, &recurrence, &recurrenceDate, &nextEventID)
+		if err != nil {
+			return fmt.Errorf("failed to get event: %w", err)
+		}
+		if recurrence == NoRecurrence || !recurrenceDate.Valid {
+			return NewNotRecurringEventError(fmt.Errorf("event %s does not recur", eventID))
+		}
+		if nextEventID.Valid {
+			return NewAlreadyRolledOverError(fmt.Errorf("event %s already rolled over to %s", eventID, nextEventID.String))
+		}
+
+		nextDate := NextOccurrence(recurrenceDate.Time, latest(date, now))
+
+		err = s.db.QueryRowContext(ctx, "INSERT INTO events (creator_id, name, date, description, type, recurrence, recurrence_date) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", creatorID, nextOccurrenceName(name, date, nextDate), nextDate, description, eventType, recurrence, recurrenceDate).Scan(&newEventID)
+		if err != nil {
+			return fmt.Errorf("failed to create next occurrence: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+		INSERT INTO participants (user_id, event_id, participant_role, honoree, source_group_id)
+		SELECT user_id, $2, participant_role, honoree, source_group_id
+		FROM participants
+		WHERE event_id = $1
+		ORDER BY id ASC
+	`,
+			eventID, newEventID)
+		if err != nil {
+			return fmt.Errorf("failed to copy participants: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "INSERT INTO event_groups (event_id, group_id, sync) SELECT $2, group_id, sync FROM event_groups WHERE event_id = $1", eventID, newEventID)
+		if err != nil {
+			return fmt.Errorf("failed to copy groups: %w", err)
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			"UPDATE gifts SET event_id = $2 WHERE event_id = $1 AND (content::jsonb->>'status')::int IN ($3, $4)",
+			eventID, newEventID, NewGiftStatus, AboutToBeBoughtGiftStatus)
+		if err != nil {
+			return fmt.Errorf("failed to carry over gifts: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "UPDATE events SET next_event_id = $1, archived_at = coalesce(archived_at, $2) WHERE id = $3", newEventID, now.UTC(), eventID)
+		if err != nil {
+			return fmt.Errorf("failed to link next occurrence: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return newEventID, nil
+}
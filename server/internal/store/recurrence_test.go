@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRollOverEventCarriesOverUnboughtGifts(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, time.December, 25, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, time.January, 10, 0, 0, 0, 0, time.UTC)
+	s := newTestStore(t, 0)
+	creatorID := createTestUser(t, s, "carry-creator@example.com")
+	buyerID := createTestUser(t, s, "carry-buyer@example.com")
+
+	eventID, err := s.CreateEvent(ctx, creatorID, "Christmas 2024", date, "", ChristmasEventType, nil, YearlyRecurrence, date)
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, eventID, "carry-buyer@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+	for _, name := range []string{"Book", "Scarf"} {
+		if err := s.CreateGift(ctx, buyerID, name, eventID, creatorID, nil, false); err != nil {
+			t.Fatalf("CreateGift() returned %v", err)
+		}
+	}
+	gifts, err := s.ListGifts(ctx, buyerID, eventID)
+	if err != nil || len(gifts) != 2 {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	var boughtID string
+	for _, gift := range gifts {
+		if gift.Content.Name == "Scarf" {
+			boughtID = gift.ID
+		}
+	}
+	if err := s.UpdateGift(ctx, buyerID, boughtID, eventID, BoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	groupID, err := s.CreateGroup(ctx, creatorID, "Family")
+	if err != nil {
+		t.Fatalf("CreateGroup() returned %v", err)
+	}
+	if err := s.AddGroupToEvent(ctx, eventID, groupID, true); err != nil {
+		t.Fatalf("AddGroupToEvent() returned %v", err)
+	}
+
+	// archived events do not roll over
+	archivedID, err := s.CreateEvent(ctx, creatorID, "Christmas 2023", date.AddDate(-1, 0, 0), "", ChristmasEventType, nil, YearlyRecurrence, date)
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.ArchiveEvent(ctx, archivedID, &now); err != nil {
+		t.Fatalf("ArchiveEvent() returned %v", err)
+	}
+
+	eventIDs, err := s.ListEventsToRollOver(ctx, now)
+	if err != nil {
+		t.Fatalf("ListEventsToRollOver() returned %v", err)
+	}
+	found := false
+	for _, id := range eventIDs {
+		found = found || id == eventID
+		if id == archivedID {
+			t.Fatalf("expected archived event %s not to roll over", archivedID)
+		}
+	}
+	if !found {
+		t.Fatalf("expected event %s to roll over, got %v", eventID, eventIDs)
+	}
+
+	newEventID, err := s.RollOverEvent(ctx, eventID, now)
+	if err != nil {
+		t.Fatalf("RollOverEvent() returned %v", err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1", newEventID); count != 2 {
+		t.Fatalf("expected the participants to be copied, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM event_groups WHERE event_id = $1 AND group_id = $2 AND sync", newEventID, groupID); count != 1 {
+		t.Fatalf("expected the groups to be copied, got %d", count)
+	}
+
+	carried, err := s.ListGifts(ctx, buyerID, newEventID)
+	if err != nil || len(carried) != 1 || carried[0].Content.Name != "Book" {
+		t.Fatalf("expected the unbought gift to be carried over, got %+v, %v", carried, err)
+	}
+	kept, err := s.ListGifts(ctx, buyerID, eventID)
+	if err != nil || len(kept) != 1 || kept[0].ID != boughtID {
+		t.Fatalf("expected the bought gift to stay behind, got %+v, %v", kept, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE id = $1 AND archived_at IS NOT NULL", eventID); count != 1 {
+		t.Fatal("expected the previous occurrence to be archived")
+	}
+
+	if _, err := s.RollOverEvent(ctx, eventID, now); !IsAlreadyRolledOverError(err) {
+		t.Fatalf("expected a second rollover to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// GiftSearchResult is a gift matching a search, with the highlighted parts
+// that matched. Highlights are HTML: the matched words are wrapped in <mark>
+// tags and the rest of the text is escaped.
+type GiftSearchResult struct {
+	Gift      Gift
+	EventName string
+	EventType EventType
+	// NameHighlight is the name of the gift.
+	NameHighlight string
+	// MatchedURLs are the URLs of the gift whose words matched.
+	MatchedURLs []string
+	// CommentHighlight are the fragments of the comments that matched, if
+	// any.
+	CommentHighlight *string
+}
+
+// searchHighlightOptions are the ts_headline options of the highlighted
+// gift names, shown in full.
+const searchHighlightOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+
+// searchFragmentOptions are the ts_headline options of the highlighted
+// comments, shown as fragments around the matches.
+const searchFragmentOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+
+// escapeHTML returns the SQL expression escaping the HTML special characters
+// of expr, so that highlights only contain the tags added by ts_headline.
+func escapeHTML(expr string) string {
+	return fmt.Sprintf("replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')", expr)
+}
+
+// searchWords returns the SQL expression splitting the words of expr, such as
+// the host and path of URLs, which the parser would keep whole.
+func searchWords(expr string) string {
+	return fmt.Sprintf("regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')", expr)
+}
+
+// SearchGifts returns the gifts of the events userID participates in whose
+// name, URLs or comments match query, best matches first, at most limit of
+// them. The query uses the web search syntax: quoted phrases, "or" and "-"
+// to exclude words. Trashed gifts are left out, and so are the gifts that
+// are a surprise for userID: secret gifts and ideas addressed to them never
+// match, and the comments of the gifts addressed to them are not searched.
+func (s *store) SearchGifts(ctx context.Context, userID string, query string, limit int) ([]GiftSearchResult, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		matches.id,
+		matches.creator_id,
+		matches.event_id,
+		matches.created_at,
+		matches.content,
+		matches.event_name,
+		matches.event_type,
+		ts_headline('simple', `+escapeHTML("matches.name")+`, matches.query, '`+searchHighlightOptions+`'),
+		(
+			SELECT coalesce(jsonb_agg(url), '[]'::jsonb)
+			FROM jsonb_array_elements_text(matches.urls) url
+			WHERE to_tsvector('simple', `+searchWords("url")+`) @@ matches.query
+		),
+		CASE WHEN to_tsvector('simple', matches.messages) @@ matches.query
+			THEN ts_headline('simple', `+escapeHTML("matches.messages")+`, matches.query, '`+searchFragmentOptions+`')
+		END
+	FROM (
+		SELECT
+			gifts.id,
+			gifts.creator_id,
+			gifts.event_id,
+			gifts.created_at,
+			gifts.content,
+			events.name AS event_name,
+			events.type AS event_type,
+			fields.name,
+			fields.urls,
+			fields.messages,
+			search.query,
+			ts_rank(documents.document, search.query) AS rank
+		FROM gifts
+		JOIN events ON gifts.event_id = events.id
+		JOIN participants ON participants.event_id = gifts.event_id AND participants.user_id = $1
+		CROSS JOIN websearch_to_tsquery('simple', $3) AS search(query)
+		CROSS JOIN LATERAL (
+			SELECT
+				coalesce(gifts.content::jsonb->>'name', '') AS name,
+				CASE WHEN jsonb_typeof(gifts.content::jsonb->'urls') = 'array' THEN gifts.content::jsonb->'urls' ELSE '[]'::jsonb END AS urls,
+				-- what others say about a gift is part of the surprise
+				CASE WHEN gifts.content::jsonb->>'to' = $2 THEN '' ELSE coalesce((
+					SELECT string_agg(comments.message, E'\n' ORDER BY comments.created_at)
+					FROM comments
+					WHERE comments.gift_id = gifts.id
+				), '') END AS messages
+		) fields
+		CROSS JOIN LATERAL (
+			SELECT
+				setweight(to_tsvector('simple', fields.name), 'A') ||
+				setweight(to_tsvector('simple', fields.messages), 'B') ||
+				setweight(to_tsvector('simple', `+searchWords("fields.urls::text")+`), 'C') AS document
+		) documents
+		WHERE NOT `+trashedCondition+`
+			AND NOT (gifts.content::jsonb->>'to' = $2 AND (coalesce((gifts.content::jsonb->>'secret')::boolean, false) OR `+ideaCondition+`))
+			AND documents.document @@ search.query
+		ORDER BY rank DESC, gifts.created_at DESC, gifts.id
+		LIMIT $4
+	) matches
+	ORDER BY matches.rank DESC, matches.created_at DESC, matches.id
+`,
+		userID, userID, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search gifts: %w", err)
+	}
+	defer rows.Close()
+
+	var results []GiftSearchResult
+
+	for rows.Next() {
+		var (
+			result           GiftSearchResult
+			giftContentBytes []byte
+			matchedURLsBytes []byte
+		)
+		err = rows.Scan(
+			&result.Gift.ID,
+			&result.Gift.CreatorID,
+			&result.Gift.EventID,
+			&result.Gift.CreatedAt,
+			&giftContentBytes,
+			&result.EventName,
+			&result.EventType,
+			&result.NameHighlight,
+			&matchedURLsBytes,
+			&result.CommentHighlight,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &result.Gift.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+		err = json.Unmarshal(matchedURLsBytes, &result.MatchedURLs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal matched URLs: %w", err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
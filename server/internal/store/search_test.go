@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSearchGifts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s)
+	eventID, creatorID, friendID := event.ID, event.CreatorID, event.FriendID
+	outsiderID := createTestUser(t, s, "search-outsider@example.com")
+
+	gifts := []struct {
+		name   string
+		to     string
+		urls   []string
+		secret bool
+	}{
+		{"Red <b>scarf</b>", creatorID, []string{"https://shop.example.com/knitted-scarf"}, false},
+		{"Blue scarf", friendID, nil, true},
+		{"Green hat", friendID, []string{"https://shop.example.com/hat"}, false},
+	}
+	for _, gift := range gifts {
+		if err := s.CreateGift(ctx, creatorID, gift.name, eventID, gift.to, gift.urls, gift.secret); err != nil {
+			t.Fatalf("CreateGift() returned %v", err)
+		}
+	}
+	created, err := s.ListGifts(ctx, creatorID, eventID)
+	if err != nil {
+		t.Fatalf("ListGifts() returned %v", err)
+	}
+	giftIDs := make(map[string]string)
+	for _, gift := range created {
+		giftIDs[gift.Content.Name] = gift.ID
+	}
+	if err := s.CreateComment(ctx, friendID, giftIDs["Red <b>scarf</b>"], "I found it cheaper at the market"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+	if err := s.CreateComment(ctx, creatorID, giftIDs["Green hat"], "Bought at the market"); err != nil {
+		t.Fatalf("CreateComment() returned %v", err)
+	}
+
+	// the creator sees the secret gift they made
+	results, err := s.SearchGifts(ctx, creatorID, "scarf", 10)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("SearchGifts() returned %+v, %v", results, err)
+	}
+
+	// the friend never finds the secret gift addressed to them
+	results, err = s.SearchGifts(ctx, friendID, "scarf", 10)
+	if err != nil || len(results) != 1 || results[0].Gift.ID != giftIDs["Red <b>scarf</b>"] {
+		t.Fatalf("SearchGifts() returned %+v, %v", results, err)
+	}
+	if results[0].NameHighlight != "Red &lt;b&gt;<mark>scarf</mark>&lt;/b&gt;" {
+		t.Fatalf("unexpected name highlight %q", results[0].NameHighlight)
+	}
+	if len(results[0].MatchedURLs) != 1 || results[0].CommentHighlight != nil {
+		t.Fatalf("expected the URL to match and not the comment, got %+v", results[0])
+	}
+
+	// nor the comments on the gifts addressed to them
+	results, err = s.SearchGifts(ctx, friendID, "market", 10)
+	if err != nil || len(results) != 1 || results[0].Gift.ID != giftIDs["Red <b>scarf</b>"] {
+		t.Fatalf("SearchGifts() returned %+v, %v", results, err)
+	}
+	if results[0].CommentHighlight == nil {
+		t.Fatal("expected the comment to be highlighted")
+	}
+
+	results, err = s.SearchGifts(ctx, creatorID, "knitted", 10)
+	if err != nil || len(results) != 1 || results[0].MatchedURLs[0] != "https://shop.example.com/knitted-scarf" {
+		t.Fatalf("SearchGifts() returned %+v, %v", results, err)
+	}
+
+	results, err = s.SearchGifts(ctx, outsiderID, "scarf", 10)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected no results outside of the events of the user, got %+v, %v", results, err)
+	}
+}
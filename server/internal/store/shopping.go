@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ListShoppingList returns the gifts and wishlist items userID reserved or
+// bought and that are not trashed, across all events, by event and recipient.
+func (s *store) ListShoppingList(ctx context.Context, userID string) ([]UserGift, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT id, creator_id, event_id, created_at, content, event_name, event_date, event_type, wishlist_item
+	FROM (
+		SELECT
+			gifts.id,
+			gifts.creator_id,
+			gifts.event_id,
+			gifts.created_at,
+			gifts.content,
+			events.name AS event_name,
+			events.date AS event_date,
+			events.type AS event_type,
+			false AS wishlist_item
+		FROM gifts
+		JOIN events ON gifts.event_id = events.id
+		WHERE gifts.content::jsonb->>'from' = $1
+			AND (gifts.content::jsonb->>'status')::int IN ($2, $3)
+		UNION ALL
+		-- wishlist items look like gifts addressed to the owner of the wishlist
+		SELECT
+			wishlist_items.id,
+			wishlist_items.user_id,
+			wishlist_reservations.event_id,
+			wishlist_items.created_at,
+			jsonb_build_object(
+				'name', wishlist_items.name,
+				'status', wishlist_reservations.status,
+				'to', wishlist_items.user_id::text,
+				'from', wishlist_reservations.buyer_id::text,
+				'urls', wishlist_items.urls::jsonb
+			)::text,
+			events.name,
+			events.date,
+			events.type,
+			true
+		FROM wishlist_reservations
+		JOIN wishlist_items ON wishlist_reservations.item_id = wishlist_items.id
+		JOIN events ON wishlist_reservations.event_id = events.id
+		WHERE wishlist_reservations.buyer_id::text = $1
+			AND wishlist_reservations.status IN ($2, $3)
+	) shopping
+	ORDER BY event_date DESC, event_id, content::jsonb->>'to', created_at
+`,
+		userID, AboutToBeBoughtGiftStatus, BoughtGiftStatus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shopping list: %w", err)
+	}
+	defer rows.Close()
+
+	var gifts []UserGift
+
+	for rows.Next() {
+		var (
+			gift             UserGift
+			giftContentBytes []byte
+		)
+		err = rows.Scan(&gift.ID, &gift.CreatorID, &gift.EventID, &gift.CreatedAt, &giftContentBytes, &gift.EventName, &gift.EventDate, &gift.EventType, &gift.WishlistItem)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift: %w", err)
+		}
+
+		err = json.Unmarshal(giftContentBytes, &gift.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal gift content: %w", err)
+		}
+
+		gifts = append(gifts, gift)
+	}
+
+	return gifts, nil
+}
+
+// MarkGiftsBought marks the gifts with giftIDs that userID reserved as
+// bought. The other gifts, including the ones userID already bought, are
+// skipped. It returns the IDs of the gifts it marked.
+func (s *store) MarkGiftsBought(ctx context.Context, userID string, giftIDs []string) ([]string, error) {
+	var markedIDs []string
+	err := s.withTx(ctx, func(s *store) error {
+		markedIDs = nil
+		for _, giftID := range giftIDs {
+			marked := false
+			markBought := func(content *GiftContent) bool {
+				if content.Status != AboutToBeBoughtGiftStatus {
+					return false
+				}
+				content.Status = BoughtGiftStatus
+				marked = true
+				return true
+			}
+			// lock the gift so that its reservation does not change meanwhile
+			err := s.updateGiftContents(ctx, markBought, "SELECT id, content FROM gifts WHERE id = $1 AND content::jsonb->>'from' = $2 FOR UPDATE", giftID, userID)
+			if err != nil {
+				return err
+			}
+			if marked {
+				markedIDs = append(markedIDs, giftID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return markedIDs, nil
+}
+
+// WishlistReservation identifies the reservation of a wishlist item in an
+// event.
+type WishlistReservation struct {
+	EventID string `json:"event_id"`
+	ItemID  string `json:"item_id"`
+}
+
+// MarkWishlistItemsBought marks the wishlist items that userID reserved in
+// the events of reservations as bought, like MarkGiftsBought. It returns the
+// reservations it marked.
+func (s *store) MarkWishlistItemsBought(ctx context.Context, userID string, reservations []WishlistReservation) ([]WishlistReservation, error) {
+	var marked []WishlistReservation
+	err := s.withTx(ctx, func(s *store) error {
+		marked = nil
+		now := time.Now().UTC()
+		for _, reservation := range reservations {
+			// lock the item like ReserveWishlistItem does
+			_, err := s.db.ExecContext(ctx, "SELECT 1 FROM wishlist_items WHERE id = $1 FOR UPDATE", reservation.ItemID)
+			if err != nil {
+				return fmt.Errorf("failed to lock wishlist item: %w", err)
+			}
+
+			result, err := s.db.ExecContext(
+				ctx,
+				"UPDATE wishlist_reservations SET status = $1, updated_at = $2 WHERE item_id = $3 AND event_id = $4 AND buyer_id = $5 AND status = $6",
+				BoughtGiftStatus, now, reservation.ItemID, reservation.EventID, userID, AboutToBeBoughtGiftStatus)
+			if err != nil {
+				return fmt.Errorf("failed to mark wishlist item bought: %w", err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to mark wishlist item bought: %w", err)
+			}
+			if affected == 1 {
+				marked = append(marked, reservation)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return marked, nil
+}
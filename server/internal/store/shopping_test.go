@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShoppingList(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	event := seedEvent(t, s, "Scarf", "Hat", "Gloves")
+	eventID, creatorID, buyerID, giftIDs := event.ID, event.CreatorID, event.FriendID, event.GiftIDs
+
+	if err := s.UpdateGift(ctx, buyerID, giftIDs["Scarf"], eventID, AboutToBeBoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	if err := s.UpdateGift(ctx, buyerID, giftIDs["Hat"], eventID, BoughtGiftStatus); err != nil {
+		t.Fatalf("UpdateGift() returned %v", err)
+	}
+	// a released gift leaves the shopping list of its former buyer
+	for _, status := range []GiftStatus{AboutToBeBoughtGiftStatus, NewGiftStatus} {
+		if err := s.UpdateGift(ctx, buyerID, giftIDs["Gloves"], eventID, status); err != nil {
+			t.Fatalf("UpdateGift() returned %v", err)
+		}
+	}
+
+	itemID, err := s.CreateWishlistItem(ctx, creatorID, "Book", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, buyerID, eventID, itemID, AboutToBeBoughtGiftStatus, time.Now()); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+
+	list, err := s.ListShoppingList(ctx, buyerID)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("ListShoppingList() returned %v, %v", list, err)
+	}
+	if list[0].EventName != "Christmas" {
+		t.Fatalf("expected the event of the gifts, got %q", list[0].EventName)
+	}
+	var items []UserGift
+	for _, gift := range list {
+		if gift.WishlistItem {
+			items = append(items, gift)
+		}
+	}
+	if len(items) != 1 || items[0].ID != itemID || items[0].Content.Name != "Book" || items[0].Content.ToID != creatorID || items[0].Content.Status != AboutToBeBoughtGiftStatus {
+		t.Fatalf("expected the reserved wishlist item, got %+v", items)
+	}
+
+	reservation := WishlistReservation{EventID: eventID, ItemID: itemID}
+	markedItems, err := s.MarkWishlistItemsBought(ctx, buyerID, []WishlistReservation{reservation})
+	if err != nil || len(markedItems) != 1 || markedItems[0] != reservation {
+		t.Fatalf("MarkWishlistItemsBought() returned %v, %v", markedItems, err)
+	}
+	if markedItems, err := s.MarkWishlistItemsBought(ctx, creatorID, []WishlistReservation{reservation}); err != nil || len(markedItems) != 0 {
+		t.Fatalf("expected the wishlist item of another buyer not to be marked, got %v, %v", markedItems, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM wishlist_reservations WHERE item_id = $1 AND status = $2", itemID, BoughtGiftStatus); count != 1 {
+		t.Fatal("expected the wishlist item to be bought")
+	}
+
+	marked, err := s.MarkGiftsBought(ctx, buyerID, []string{giftIDs["Scarf"], giftIDs["Hat"], giftIDs["Gloves"]})
+	if err != nil || len(marked) != 1 || marked[0] != giftIDs["Scarf"] {
+		t.Fatalf("MarkGiftsBought() returned %v, %v", marked, err)
+	}
+	gifts, err := s.ListGifts(ctx, creatorID, eventID)
+	if err != nil {
+		t.Fatalf("ListGifts() returned %v", err)
+	}
+	for _, gift := range gifts {
+		bought := gift.Content.Status == BoughtGiftStatus
+		if bought != (gift.Content.Name != "Gloves") {
+			t.Fatalf("unexpected status of %s: %d", gift.Content.Name, gift.Content.Status)
+		}
+	}
+
+	list, err = s.ListShoppingList(ctx, creatorID)
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected an empty shopping list, got %v, %v", list, err)
+	}
+}
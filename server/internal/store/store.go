@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -23,34 +24,159 @@ type Store interface {
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
+	// WithTx runs fn with a store whose methods all run in a single
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	// Calls nested in fn join the transaction.
+	WithTx(ctx context.Context, fn func(Store) error) error
+
 	// user stuff
-	FindOrCreateUser(ctx context.Context, user *User) (string, error)
 	Signup(ctx context.Context, userName string, userEmail string, password string) (string, error)
 	Login(ctx context.Context, userEmail string, password string) (string, error)
 	GetUserByID(ctx context.Context, userID string) (*User, error)
+	VerifyEmail(ctx context.Context, userID string, email string) (bool, error)
+	UpdateUserProfile(ctx context.Context, userID string, name string, picture string) error
+	ChangePassword(ctx context.Context, userID string, password string) error
+	GetSessionVersion(ctx context.Context, userID string) (int, bool, error)
+	RequestEmailChange(ctx context.Context, userID string, email string) error
+	ConfirmEmailChange(ctx context.Context, userID string, email string) (bool, error)
+	DeleteAccount(ctx context.Context, userID string) error
 	UserIDToName(ctx context.Context, userID string, userIDToName map[string]string) (string, error)
 
+	// identity stuff
+	FindOrCreateUserByIdentity(ctx context.Context, provider string, subject string, user *User, emailVerified bool) (string, error)
+	LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error
+	UnlinkIdentity(ctx context.Context, userID string, provider string) error
+	ListIdentities(ctx context.Context, userID string) ([]Identity, error)
+
+	// two factor stuff
+	GetTwoFactor(ctx context.Context, userID string) (*TwoFactor, error)
+	StartTwoFactorEnrollment(ctx context.Context, userID string, secret string, recoveryCodeHashes []string) error
+	EnableTwoFactor(ctx context.Context, userID string) error
+	DisableTwoFactor(ctx context.Context, userID string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error)
+	CheckPassword(ctx context.Context, userID string, password string) (bool, error)
+
+	// login attempts stuff
+	RecordFailedLogin(ctx context.Context, attempt FailedLogin) error
+	ResetLoginFailures(ctx context.Context, key string) error
+	ChargeLoginFailure(ctx context.Context, key string, allow func(failures int, lastFailure time.Time) bool, at time.Time, since time.Time) (bool, error)
+	RefundLoginFailure(ctx context.Context, key string) error
+
+	// data export stuff
+	CountUserData(ctx context.Context, userID string) (int, error)
+	ListUserGifts(ctx context.Context, userID string) ([]UserGift, error)
+	ListUserWishlistReservations(ctx context.Context, userID string) ([]UserGift, error)
+	ListUserComments(ctx context.Context, userID string) ([]UserComment, error)
+	CreateDataExport(ctx context.Context, userID string, staleBefore time.Time) (string, bool, error)
+	CompleteDataExport(ctx context.Context, exportID string, content []byte, expiresAt time.Time) error
+	FailDataExport(ctx context.Context, exportID string) error
+	GetLatestDataExport(ctx context.Context, userID string) (*DataExport, error)
+	GetDataExportContent(ctx context.Context, userID string, exportID string, now time.Time) ([]byte, error)
+	DeleteExpiredDataExports(ctx context.Context, now time.Time, staleBefore time.Time) (int64, error)
+
 	// event stuff
-	ListEvents(ctx context.Context, userID string) ([]Event, error)
-	CreateEvent(ctx context.Context, userID string, eventName string, eventDate time.Time) error
+	ListEvents(ctx context.Context, userID string, filter EventFilter, now time.Time) ([]Event, error)
+	GetEvent(ctx context.Context, eventID string) (*Event, error)
+	CreateEvent(ctx context.Context, userID string, eventName string, eventDate time.Time, eventDescription string, eventType EventType, honoreeEmails []string, recurrence RecurrenceRule, recurrenceDate time.Time) (string, error)
+	UpdateEvent(ctx context.Context, eventID string, eventName string, eventDate time.Time, eventDescription string, eventType EventType) error
+	ArchiveEvent(ctx context.Context, eventID string, now *time.Time) error
+	DeleteEvent(ctx context.Context, eventID string) error
+	ListEventsToRollOver(ctx context.Context, before time.Time) ([]string, error)
+	RollOverEvent(ctx context.Context, eventID string, now time.Time) (string, error)
 
 	// participants stuff
 	GetEventParticipants(ctx context.Context, eventID string) ([]User, error)
+	GetParticipantRole(ctx context.Context, eventID string, userID string) (ParticipantRole, bool, error)
 	AddEventParticipant(ctx context.Context, eventID string, userEmail string) error
+	RemoveEventParticipant(ctx context.Context, eventID string, userID string) (bool, error)
+
+	// groups stuff
+	CreateGroup(ctx context.Context, userID string, name string) (string, error)
+	ListGroups(ctx context.Context, userID string) ([]Group, error)
+	GetGroupRole(ctx context.Context, groupID string, userID string) (*GroupRole, error)
+	GetGroupMembers(ctx context.Context, groupID string) ([]GroupMember, error)
+	RenameGroup(ctx context.Context, groupID string, name string) error
+	DeleteGroup(ctx context.Context, groupID string) error
+	AddGroupMember(ctx context.Context, groupID string, userEmail string, role GroupRole) error
+	UpdateGroupMemberRole(ctx context.Context, groupID string, userID string, role GroupRole) (bool, error)
+	RemoveGroupMember(ctx context.Context, groupID string, userID string) error
+	AddGroupToEvent(ctx context.Context, eventID string, groupID string, sync bool) error
+
+	// join links stuff
+	CreateJoinLink(ctx context.Context, eventID string, userID string, token string, role ParticipantRole, expiresAt *time.Time, maxUses *int) (string, error)
+	ListJoinLinks(ctx context.Context, eventID string, now time.Time) ([]JoinLink, error)
+	RevokeJoinLink(ctx context.Context, eventID string, linkID string, now time.Time) (bool, error)
+	RedeemJoinLink(ctx context.Context, token string, userID string, now time.Time) (string, error)
 
 	// gift stuff
 	CreateGift(ctx context.Context, userID string, name string, eventID string, toUserID string, urls []string, secret bool) error
 	HasGift(ctx context.Context, eventID string, giftID string) (bool, error)
+	GetGift(ctx context.Context, eventID string, giftID string) (*Gift, error)
 	ListGifts(ctx context.Context, userID, eventID string) ([]Gift, error)
+	QueryGifts(ctx context.Context, eventID string, query GiftQuery) ([]Gift, *GiftCursor, error)
 	UpdateGift(ctx context.Context, userID string, giftID string, eventID string, status GiftStatus) error
+	ListTrashedGifts(ctx context.Context, eventID string, since time.Time) ([]Gift, error)
+	RestoreGift(ctx context.Context, giftID string, eventID string, since time.Time) (bool, error)
+	DeleteTrashedGift(ctx context.Context, giftID string, eventID string) (bool, error)
+	PurgeTrashedGifts(ctx context.Context, before time.Time) (int64, error)
+	EditGift(ctx context.Context, giftID string, eventID string, edit GiftEdit) (*EditedGift, error)
+	TransferGifts(ctx context.Context, userID string, giftIDs []string, fromEventID string, toEventID string, transfer GiftTransfer) ([]string, error)
+	CreateGiftIdea(ctx context.Context, userID string, name string, eventID string, toUserID string, urls []string) error
+	PromoteGiftIdea(ctx context.Context, userID string, giftID string, eventID string) (bool, error)
+	ToggleVote(ctx context.Context, target ReactionTarget, targetID string, userID string, value int, now time.Time) (int, error)
+	ToggleReaction(ctx context.Context, target ReactionTarget, targetID string, userID string, emoji string, now time.Time) (bool, error)
+	GetReactionSummary(ctx context.Context, target ReactionTarget, targetID string, userID string) (ReactionSummary, error)
+	GetReactionSummaries(ctx context.Context, target ReactionTarget, targetIDs []string, userID string) (map[string]ReactionSummary, error)
+	ToggleGiftVote(ctx context.Context, userID string, giftID string, now time.Time) (bool, error)
+	CountGiftVotes(ctx context.Context, giftID string, userID string) (int, bool, error)
+	UpdateGiftPurchase(ctx context.Context, userID string, giftID string, eventID string, purchase GiftPurchase) (bool, error)
+	SetThankYouNote(ctx context.Context, userID string, giftID string, message string, now time.Time) error
+	GetThankYouNote(ctx context.Context, giftID string) (*ThankYouNote, error)
+	SetWishlistThankYouNote(ctx context.Context, userID string, eventID string, itemID string, message string, now time.Time) (bool, error)
+	GetWishlistThankYouNote(ctx context.Context, eventID string, itemID string) (*ThankYouNote, error)
+	SearchGifts(ctx context.Context, userID string, query string, limit int) ([]GiftSearchResult, error)
+	ListShoppingList(ctx context.Context, userID string) ([]UserGift, error)
+	MarkGiftsBought(ctx context.Context, userID string, giftIDs []string) ([]string, error)
+	MarkWishlistItemsBought(ctx context.Context, userID string, reservations []WishlistReservation) ([]WishlistReservation, error)
+	ListRecipientCoverage(ctx context.Context, eventID string) ([]RecipientCoverage, error)
+
+	// gift images stuff
+	CreateGiftImage(ctx context.Context, image GiftImage) (string, error)
+	ListGiftImages(ctx context.Context, giftID string) ([]GiftImage, error)
+	GetGiftImage(ctx context.Context, giftID string, imageID string) (*GiftImage, error)
+	DetachGiftImage(ctx context.Context, giftID string, imageID string) (bool, error)
+	ListDetachedGiftImages(ctx context.Context) ([]GiftImage, error)
+	DeleteGiftImage(ctx context.Context, imageID string) error
+
+	// wishlist stuff
+	ListWishlistItems(ctx context.Context, userID string) ([]WishlistItem, error)
+	CreateWishlistItem(ctx context.Context, userID string, name string, urls []string) (string, error)
+	UpdateWishlistItem(ctx context.Context, userID string, itemID string, name string, urls []string) (bool, error)
+	RelistWishlistItem(ctx context.Context, userID string, itemID string, now time.Time) (bool, error)
+	DeleteWishlistItem(ctx context.Context, userID string, itemID string) (bool, error)
+	ListEventWishlistItems(ctx context.Context, eventID string) ([]EventWishlistItem, error)
+	ReserveWishlistItem(ctx context.Context, userID string, eventID string, itemID string, status GiftStatus, now time.Time) error
 
 	// comments stuff
 	CreateComment(ctx context.Context, userID string, giftID string, message string) error
 	ListComments(ctx context.Context, giftID string) ([]Comment, error)
 }
 
+// querier runs statements on the database, or in a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type store struct {
-	db *sql.DB
+	// conn is the connection pool, nil for stores scoped to a transaction.
+	conn *sql.DB
+	db   querier
+	// wrapTx wraps the transactions started by the store, for tests to
+	// inject failures.
+	wrapTx func(querier) querier
 }
 
 var (
@@ -86,7 +212,8 @@ func New(isProduction bool) Store {
 		log.Fatal(err)
 	}
 	dbInstance = &store{
-		db: db,
+		conn: db,
+		db:   db,
 	}
 	return dbInstance
 }
@@ -99,8 +226,14 @@ func (s *store) Health() map[string]string {
 
 	stats := make(map[string]string)
 
+	if s.conn == nil {
+		stats["status"] = "down"
+		stats["error"] = "store scoped to a transaction"
+		return stats
+	}
+
 	// Ping the database
-	err := s.db.PingContext(ctx)
+	err := s.conn.PingContext(ctx)
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
@@ -113,7 +246,7 @@ func (s *store) Health() map[string]string {
 	stats["message"] = "It's healthy"
 
 	// Get database stats (like open connections, in use, idle, etc.)
-	dbStats := s.db.Stats()
+	dbStats := s.conn.Stats()
 	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
 	stats["in_use"] = strconv.Itoa(dbStats.InUse)
 	stats["idle"] = strconv.Itoa(dbStats.Idle)
@@ -147,6 +280,52 @@ func (s *store) Health() map[string]string {
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *store) Close() error {
+	if s.conn == nil {
+		return errors.New("cannot close a store scoped to a transaction")
+	}
 	log.Printf("Disconnected from database: %s", database)
-	return s.db.Close()
+	return s.conn.Close()
+}
+
+func (s *store) WithTx(ctx context.Context, fn func(Store) error) error {
+	return s.withTx(ctx, func(s *store) error {
+		return fn(s)
+	})
+}
+
+// withTx runs fn with a store scoped to a transaction, committed if fn
+// returns nil and rolled back otherwise. Stores already scoped to a
+// transaction run fn in it.
+func (s *store) withTx(ctx context.Context, fn func(s *store) error) (finalErr error) {
+	if s.conn == nil {
+		return fn(s)
+	}
+
+	txn, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	defer func() {
+		if finalErr != nil {
+			// a failed commit already rolled back
+			if errRollback := txn.Rollback(); errRollback != nil && !errors.Is(errRollback, sql.ErrTxDone) {
+				finalErr = fmt.Errorf("error rolling back transaction: %w (after %w)", errRollback, finalErr)
+			}
+		}
+	}()
+
+	var q querier = txn
+	if s.wrapTx != nil {
+		q = s.wrapTx(q)
+	}
+	if err := fn(&store{db: q}); err != nil {
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"log"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ func mustStartPostgresContainer() (func(context.Context, ...testcontainers.Termi
 		postgres.WithDatabase(dbName),
 		postgres.WithUsername(dbUser),
 		postgres.WithPassword(dbPwd),
+		postgres.WithInitScripts(filepath.Join("..", "..", "sql", "create_tables.sql")),
 		testcontainers.WithWaitStrategy(
 			wait.ForLog("database system is ready to accept connections").
 				WithOccurrence(2).
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TwoFactor is the TOTP configuration of a user.
+type TwoFactor struct {
+	// Secret is empty when the user never started an enrollment.
+	Secret string
+	// Enabled is false while the enrollment is not confirmed.
+	Enabled bool
+}
+
+func (s *store) GetTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	var (
+		twoFactor TwoFactor
+		secret    sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1", userID).Scan(&secret, &twoFactor.Enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get two factor: %w", err)
+	}
+	if secret.Valid {
+		twoFactor.Secret = secret.String
+	}
+	return &twoFactor, nil
+}
+
+// StartTwoFactorEnrollment saves a new, not yet enabled, TOTP secret for the
+// user along with the hashes of their recovery codes, replacing any previous
+// pending enrollment.
+func (s *store) StartTwoFactorEnrollment(ctx context.Context, userID string, secret string, recoveryCodeHashes []string) error {
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = $1, totp_enabled = false, totp_last_step = NULL WHERE id = $2", secret, userID)
+		if err != nil {
+			return fmt.Errorf("failed to save totp secret: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		for _, hash := range recoveryCodeHashes {
+			_, err = s.db.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+			if err != nil {
+				return fmt.Errorf("failed to create recovery code: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *store) EnableTwoFactor(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_enabled = true WHERE id = $1 AND totp_secret IS NOT NULL", userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable two factor: %w", err)
+	}
+	return nil
+}
+
+func (s *store) DisableTwoFactor(ctx context.Context, userID string) error {
+	return s.withTx(ctx, func(s *store) error {
+		_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL WHERE id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to disable two factor: %w", err)
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UseTOTPStep records that the TOTP code of the given time step was used.
+// It returns false if a code of this step or a later one was already used,
+// so a code cannot be replayed.
+func (s *store) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)", step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to use totp step: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use totp step: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// UseRecoveryCode consumes the recovery code with the given hash. It returns
+// false if the user has no such unused code.
+func (s *store) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL", time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// CheckPassword tells whether password is the password of the user. Users
+// without a password (OAuth only) never match.
+func (s *store) CheckPassword(ctx context.Context, userID string, password string) (bool, error) {
+	var passwordHashInDB []byte
+	err := s.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1 and password_hash != $2", userID, "").Scan(&passwordHashInDB)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check password: %w", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(passwordHashInDB, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check password: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,316 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingQuerier fails the failAt-th statement run through it.
+type failingQuerier struct {
+	querier
+	failAt int
+	count  int
+}
+
+func (q *failingQuerier) fail() bool {
+	q.count++
+	return q.count == q.failAt
+}
+
+func (q *failingQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if q.fail() {
+		return nil, errInjected
+	}
+	return q.querier.ExecContext(ctx, query, args...)
+}
+
+func (q *failingQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if q.fail() {
+		return nil, errInjected
+	}
+	return q.querier.QueryContext(ctx, query, args...)
+}
+
+func (q *failingQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if q.fail() {
+		// a *sql.Row cannot carry an error of our own, run a failing
+		// statement instead
+		return q.querier.QueryRowContext(ctx, "SELECT 1 / 0")
+	}
+	return q.querier.QueryRowContext(ctx, query, args...)
+}
+
+// newTestStore returns a store on its own connection pool, whose
+// transactions fail at their failAt-th statement if failAt is not 0.
+func newTestStore(t *testing.T, failAt int) *store {
+	t.Helper()
+
+	connStr := fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s timezone=UTC sslmode=disable",
+		host, port, username, password, database,
+	)
+	db, err := sql.Open("pgx", connStr)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	s := &store{conn: db, db: db}
+	if failAt != 0 {
+		s.wrapTx = func(q querier) querier {
+			return &failingQuerier{querier: q, failAt: failAt}
+		}
+	}
+	return s
+}
+
+func createTestUser(t *testing.T, s *store, email string) string {
+	t.Helper()
+
+	var userID string
+	err := s.db.QueryRowContext(context.Background(), "INSERT INTO users (name, email, password_hash) VALUES ($1, $2, '') RETURNING id", email, email).Scan(&userID)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func countRows(t *testing.T, s *store, query string, args ...any) int {
+	t.Helper()
+
+	var count int
+	if err := s.db.QueryRowContext(context.Background(), query, args...).Scan(&count); err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	return count
+}
+
+// testEvent is a Christmas event seeded by seedEvent.
+type testEvent struct {
+	ID          string
+	CreatorID   string
+	FriendID    string
+	FriendEmail string
+	// GiftIDs are the IDs of the gifts of the event by name.
+	GiftIDs map[string]string
+}
+
+// seedEvent creates a Christmas event of a creator and a friend, users of the
+// test only, with the gifts named giftNames the creator wishes for.
+func seedEvent(t *testing.T, s *store, giftNames ...string) testEvent {
+	t.Helper()
+	ctx := context.Background()
+
+	prefix := strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-"))
+	event := testEvent{
+		CreatorID:   createTestUser(t, s, prefix+"-creator@example.com"),
+		FriendEmail: prefix + "-friend@example.com",
+		GiftIDs:     make(map[string]string),
+	}
+	event.FriendID = createTestUser(t, s, event.FriendEmail)
+
+	var err error
+	event.ID, err = s.CreateEvent(ctx, event.CreatorID, "Christmas", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, event.ID, event.FriendEmail); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+	for _, name := range giftNames {
+		if err := s.CreateGift(ctx, event.CreatorID, name, event.ID, event.CreatorID, nil, false); err != nil {
+			t.Fatalf("CreateGift() returned %v", err)
+		}
+	}
+	gifts, err := s.ListGifts(ctx, event.CreatorID, event.ID)
+	if err != nil || len(gifts) != len(giftNames) {
+		t.Fatalf("ListGifts() returned %v, %v", gifts, err)
+	}
+	for _, gift := range gifts {
+		event.GiftIDs[gift.Content.Name] = gift.ID
+	}
+	return event
+}
+
+func TestWithTxCommits(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "commit@example.com")
+
+	err := s.WithTx(ctx, func(tx Store) error {
+		if err := tx.UpdateUserProfile(ctx, userID, "Committed", ""); err != nil {
+			return err
+		}
+		// nested calls join the transaction
+		return tx.WithTx(ctx, func(tx Store) error {
+			_, err := tx.CreateEvent(ctx, userID, "Committed event", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() returned %v", err)
+	}
+
+	if count := countRows(t, s, "SELECT count(*) FROM users WHERE id = $1 AND name = 'Committed'", userID); count != 1 {
+		t.Fatalf("expected the profile update to be committed")
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE creator_id = $1", userID); count != 1 {
+		t.Fatalf("expected the event to be committed, got %d events", count)
+	}
+}
+
+func TestWithTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	userID := createTestUser(t, s, "rollback@example.com")
+
+	err := s.WithTx(ctx, func(tx Store) error {
+		if err := tx.UpdateUserProfile(ctx, userID, "Rolled back", ""); err != nil {
+			return err
+		}
+		return errInjected
+	})
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("expected WithTx() to return the error of fn, got %v", err)
+	}
+
+	if count := countRows(t, s, "SELECT count(*) FROM users WHERE id = $1 AND name = 'Rolled back'", userID); count != 0 {
+		t.Fatalf("expected the profile update to be rolled back")
+	}
+}
+
+func TestCreateEventRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	// fail when inserting the creator as participant, after the event
+	s := newTestStore(t, 2)
+	userID := createTestUser(t, s, "create-event@example.com")
+
+	_, err := s.CreateEvent(ctx, userID, "Ownerless", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err == nil {
+		t.Fatal("expected CreateEvent() to fail")
+	}
+
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE creator_id = $1", userID); count != 0 {
+		t.Fatalf("expected no event to be left behind, got %d", count)
+	}
+}
+
+func TestRollOverEventRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, time.December, 25, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	// fail when moving the gifts, after the next occurrence, its participants
+	// and its groups were created
+	s := newTestStore(t, 5)
+	userID := createTestUser(t, s, "rollover@example.com")
+	if _, err := s.CreateEvent(ctx, userID, "Christmas 2024", date, "", ChristmasEventType, nil, YearlyRecurrence, date); err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	var eventID string
+	if err := s.db.QueryRowContext(ctx, "SELECT id FROM events WHERE creator_id = $1", userID).Scan(&eventID); err != nil {
+		t.Fatalf("failed to get event: %v", err)
+	}
+	if err := s.CreateGift(ctx, userID, "Book", eventID, userID, nil, false); err != nil {
+		t.Fatalf("CreateGift() returned %v", err)
+	}
+
+	if _, err := s.RollOverEvent(ctx, eventID, now); err == nil {
+		t.Fatal("expected RollOverEvent() to fail")
+	}
+
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE creator_id = $1", userID); count != 1 {
+		t.Fatalf("expected no next occurrence to be left behind, got %d events", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE id = $1 AND next_event_id IS NULL AND archived_at IS NULL", eventID); count != 1 {
+		t.Fatal("expected the event to be left untouched")
+	}
+
+	s.wrapTx = nil
+	newEventID, err := s.RollOverEvent(ctx, eventID, now)
+	if err != nil {
+		t.Fatalf("RollOverEvent() returned %v", err)
+	}
+	event, err := s.GetEvent(ctx, newEventID)
+	if err != nil || event == nil {
+		t.Fatalf("GetEvent() returned %v, %v", event, err)
+	}
+	if event.Name != "Christmas 2025" || !event.Date.Equal(date.AddDate(1, 0, 0)) {
+		t.Fatalf("unexpected next occurrence %s on %s", event.Name, event.Date)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM gifts WHERE event_id = $1", newEventID); count != 1 {
+		t.Fatalf("expected the gift to be carried over, got %d gifts", count)
+	}
+}
+
+func TestDeleteAccountRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	// fail when anonymizing the user, after everything else
+	s := newTestStore(t, 16)
+	userID := createTestUser(t, s, "delete-account@example.com")
+	if _, err := s.CreateEvent(ctx, userID, "Solo", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{}); err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+
+	if err := s.DeleteAccount(ctx, userID); err == nil {
+		t.Fatal("expected DeleteAccount() to fail")
+	}
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		t.Fatalf("expected the user to be kept, got %v, %v", user, err)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM events WHERE creator_id = $1", userID); count != 1 {
+		t.Fatalf("expected the event to be kept, got %d", count)
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE user_id = $1", userID); count != 1 {
+		t.Fatalf("expected the participation to be kept, got %d", count)
+	}
+}
+
+func TestRemoveEventParticipantRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	// fail when listing the gifts addressed to the participant, after their
+	// removal and the release of their reservations
+	s := newTestStore(t, 4)
+	creatorID := createTestUser(t, s, "remove-creator@example.com")
+	participantID := createTestUser(t, s, "remove-participant@example.com")
+	if _, err := s.CreateEvent(ctx, creatorID, "Party", time.Now(), "", ChristmasEventType, nil, NoRecurrence, time.Time{}); err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	var eventID string
+	if err := s.db.QueryRowContext(ctx, "SELECT id FROM events WHERE creator_id = $1", creatorID).Scan(&eventID); err != nil {
+		t.Fatalf("failed to get event: %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, eventID, "remove-participant@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, eventID, "remove-participant@example.com"); !IsAlreadyParticipantError(err) {
+		t.Fatalf("expected AddEventParticipant() to refuse duplicates, got %v", err)
+	}
+
+	if _, err := s.RemoveEventParticipant(ctx, eventID, participantID); err == nil {
+		t.Fatal("expected RemoveEventParticipant() to fail")
+	}
+	if count := countRows(t, s, "SELECT count(*) FROM participants WHERE event_id = $1 AND user_id = $2", eventID, participantID); count != 1 {
+		t.Fatalf("expected the participant to be kept, got %d", count)
+	}
+
+	s.wrapTx = nil
+	if _, err := s.RemoveEventParticipant(ctx, eventID, creatorID); !IsCreatorCannotLeaveError(err) {
+		t.Fatalf("expected the creator not to be removed, got %v", err)
+	}
+	removed, err := s.RemoveEventParticipant(ctx, eventID, participantID)
+	if err != nil || !removed {
+		t.Fatalf("RemoveEventParticipant() returned %v, %v", removed, err)
+	}
+}
@@ -25,10 +25,14 @@ func IsEmailAlreadyUsedError(err error) bool {
 }
 
 type User struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Picture string `json:"picture"`
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	Picture          string `json:"picture"`
+	EmailVerified    bool   `json:"email_verified"`
+	PendingEmail     string `json:"pending_email,omitempty"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	HasPassword      bool   `json:"has_password"`
 }
 
 // HashPassword generates a bcrypt hash for the given password.
@@ -37,20 +41,6 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
-func (s *store) FindOrCreateUser(ctx context.Context, user *User) (string, error) {
-	var userID string
-	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1", user.Email).Scan(&userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			err = s.db.QueryRowContext(ctx, "INSERT INTO users (name, email, picture, password_hash) VALUES ($1, $2, $3, $4) RETURNING id", user.Name, user.Email, user.Picture, "").Scan(&userID)
-		}
-	}
-	if err != nil {
-		return "", fmt.Errorf("failed to find or create user: %w", err)
-	}
-	return userID, nil
-}
-
 func (s *store) Login(ctx context.Context, userEmail string, password string) (string, error) {
 	var (
 		userID           string
@@ -66,6 +56,9 @@ func (s *store) Login(ctx context.Context, userEmail string, password string) (s
 
 	err = bcrypt.CompareHashAndPassword(passwordHashInDB, []byte(password))
 	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return "", nil
+		}
 		return "", fmt.Errorf("failed to login user: %w", err)
 	}
 
@@ -79,7 +72,7 @@ func (s *store) Signup(ctx context.Context, userName string, userEmail string, p
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	err = s.db.QueryRowContext(ctx, "INSERT INTO users (name, email, password_hash) VALUES ($1, $2, $3) RETURNING id", userName, userEmail, hash).Scan(&userID)
+	err = s.db.QueryRowContext(ctx, "INSERT INTO users (name, email, password_hash, email_verified) VALUES ($1, $2, $3, false) RETURNING id", userName, userEmail, hash).Scan(&userID)
 
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -92,18 +85,36 @@ func (s *store) Signup(ctx context.Context, userName string, userEmail string, p
 	return userID, nil
 }
 
+// VerifyEmail marks email as verified for the user, provided it is still
+// their email. It returns false otherwise.
+func (s *store) VerifyEmail(ctx context.Context, userID string, email string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET email_verified = true WHERE id = $1 AND email = $2", userID, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify email: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to verify email: %w", err)
+	}
+	return affected == 1, nil
+}
+
 func (s *store) GetUserByID(ctx context.Context, userID string) (*User, error) {
 	var (
-		user    User
-		picture sql.NullString
+		user         User
+		picture      sql.NullString
+		pendingEmail sql.NullString
 	)
-	err := s.db.QueryRowContext(ctx, "SELECT id, name, email, picture FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Name, &user.Email, &picture)
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, email, picture, email_verified, pending_email, totp_enabled, password_hash != '' FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&user.ID, &user.Name, &user.Email, &picture, &user.EmailVerified, &pendingEmail, &user.TwoFactorEnabled, &user.HasPassword)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if picture.Valid {
 		user.Picture = picture.String
 	}
+	if pendingEmail.Valid {
+		user.PendingEmail = pendingEmail.String
+	}
 	return &user, err
 }
 
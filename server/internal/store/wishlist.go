@@ -0,0 +1,322 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WishlistItem is something a user wishes for, maintained once and offered in
+// every event where they can receive gifts.
+type WishlistItem struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	URLs      []string  `json:"urls"`
+	CreatedAt time.Time `json:"created_at"`
+	// ListedAt is when the item was last (re-)listed: it is offered again in
+	// other events once bought in one, only if re-listed after that.
+	ListedAt time.Time `json:"listed_at"`
+}
+
+// EventWishlistItem is a wishlist item in the context of an event, with its
+// reservation in that event.
+type EventWishlistItem struct {
+	WishlistItem
+	Status  GiftStatus
+	BuyerID *string
+	// Deleted tells whether its owner deleted the item after it was bought in
+	// the event, which keeps it for its buyer.
+	Deleted bool
+}
+
+type WishlistItemUnavailableError struct {
+	error
+}
+
+func NewWishlistItemUnavailableError(err error) error {
+	return WishlistItemUnavailableError{
+		error: err,
+	}
+}
+
+func IsWishlistItemUnavailableError(err error) bool {
+	var itemErr WishlistItemUnavailableError
+	return errors.As(err, &itemErr)
+}
+
+// boughtElsewhereCondition selects the wishlist items bought in another event
+// than $1 since they were last listed.
+const boughtElsewhereCondition = `EXISTS (
+		SELECT 1 FROM wishlist_reservations other
+		WHERE other.item_id = wishlist_items.id AND other.event_id != $1
+			AND other.status = $2 AND other.updated_at >= wishlist_items.listed_at
+	)`
+
+func scanWishlistItem(row interface{ Scan(...any) error }, item *WishlistItem, dest ...any) error {
+	var urls []byte
+	err := row.Scan(append([]any{&item.ID, &item.UserID, &item.Name, &urls, &item.CreatedAt, &item.ListedAt}, dest...)...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(urls, &item.URLs); err != nil {
+		return fmt.Errorf("failed to unmarshal wishlist item urls: %w", err)
+	}
+	return nil
+}
+
+// ListWishlistItems returns the wishlist of the user.
+func (s *store) ListWishlistItems(ctx context.Context, userID string) ([]WishlistItem, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT id, user_id, name, urls, created_at, listed_at
+    FROM wishlist_items
+    WHERE user_id = $1 AND deleted_at IS NULL
+	ORDER BY created_at ASC
+`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wishlist items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []WishlistItem{}
+	for rows.Next() {
+		var item WishlistItem
+		if err := scanWishlistItem(rows, &item); err != nil {
+			return nil, fmt.Errorf("error scanning wishlist item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (s *store) CreateWishlistItem(ctx context.Context, userID string, name string, urls []string) (string, error) {
+	urlsMarshalled, err := json.Marshal(urls)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal wishlist item urls: %w", err)
+	}
+
+	now := time.Now().UTC()
+	var itemID string
+	err = s.db.QueryRowContext(
+		ctx,
+		"INSERT INTO wishlist_items (user_id, name, urls, created_at, listed_at) VALUES ($1, $2, $3, $4, $4) RETURNING id",
+		userID, name, urlsMarshalled, now).Scan(&itemID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create wishlist item: %w", err)
+	}
+	return itemID, nil
+}
+
+// UpdateWishlistItem updates an item of the wishlist of the user. It returns
+// false if they have no such item.
+func (s *store) UpdateWishlistItem(ctx context.Context, userID string, itemID string, name string, urls []string) (bool, error) {
+	urlsMarshalled, err := json.Marshal(urls)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal wishlist item urls: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, "UPDATE wishlist_items SET name = $1, urls = $2 WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL", name, urlsMarshalled, itemID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update wishlist item: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update wishlist item: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// RelistWishlistItem offers an item of the wishlist of the user again in the
+// events where it was not bought, e.g. because they wish for it once more. It
+// returns false if they have no such item.
+func (s *store) RelistWishlistItem(ctx context.Context, userID string, itemID string, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE wishlist_items SET listed_at = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL", now.UTC(), itemID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to relist wishlist item: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to relist wishlist item: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// DeleteWishlistItem deletes an item of the wishlist of the user, releasing
+// its reservations. An item bought in some event is only marked as deleted,
+// so that its buyer keeps it in their purchases without the surprise being
+// spoiled. It returns false if they have no such item.
+func (s *store) DeleteWishlistItem(ctx context.Context, userID string, itemID string) (bool, error) {
+	var deleted bool
+	err := s.withTx(ctx, func(s *store) error {
+		// lock the item first, so that the reservations checked next cannot
+		// change meanwhile
+		_, err := s.db.ExecContext(ctx, "SELECT 1 FROM wishlist_items WHERE id = $1 AND user_id = $2 FOR UPDATE", itemID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to lock wishlist item: %w", err)
+		}
+
+		result, err := s.db.ExecContext(
+			ctx,
+			`
+		UPDATE wishlist_items SET deleted_at = $3
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM wishlist_reservations WHERE item_id = wishlist_items.id AND status = $4)
+	`,
+			itemID, userID, time.Now().UTC(), BoughtGiftStatus)
+		if err != nil {
+			return fmt.Errorf("failed to delete wishlist item: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to delete wishlist item: %w", err)
+		}
+		if affected == 1 {
+			deleted = true
+			_, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_reservations WHERE item_id = $1 AND status != $2", itemID, BoughtGiftStatus)
+			if err != nil {
+				return fmt.Errorf("failed to release wishlist item: %w", err)
+			}
+			return nil
+		}
+
+		result, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_items WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", itemID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete wishlist item: %w", err)
+		}
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to delete wishlist item: %w", err)
+		}
+		deleted = affected == 1
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// ListEventWishlistItems returns the wishlist items of the participants of the
+// event, with their reservation in the event. Items bought in another event
+// since they were last listed are left out, unless they are also reserved in
+// this one, and so are deleted items, unless they were bought in this one.
+func (s *store) ListEventWishlistItems(ctx context.Context, eventID string) ([]EventWishlistItem, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+	SELECT
+		wishlist_items.id,
+		wishlist_items.user_id,
+		wishlist_items.name,
+		wishlist_items.urls,
+		wishlist_items.created_at,
+		wishlist_items.listed_at,
+		wishlist_reservations.status,
+		wishlist_reservations.buyer_id,
+		wishlist_items.deleted_at IS NOT NULL
+    FROM wishlist_items
+    JOIN participants ON participants.user_id = wishlist_items.user_id AND participants.event_id = $1
+    LEFT JOIN wishlist_reservations ON wishlist_reservations.item_id = wishlist_items.id AND wishlist_reservations.event_id = $1
+    WHERE (wishlist_items.deleted_at IS NULL OR wishlist_reservations.status = $2)
+		AND (wishlist_reservations.id IS NOT NULL OR NOT `+boughtElsewhereCondition+`)
+	ORDER BY wishlist_items.created_at ASC
+`,
+		eventID, BoughtGiftStatus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event wishlist items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []EventWishlistItem
+	for rows.Next() {
+		var (
+			item    EventWishlistItem
+			status  sql.NullInt64
+			buyerID sql.NullString
+		)
+		if err := scanWishlistItem(rows, &item.WishlistItem, &status, &buyerID, &item.Deleted); err != nil {
+			return nil, fmt.Errorf("error scanning wishlist item: %w", err)
+		}
+		if status.Valid {
+			item.Status = GiftStatus(status.Int64)
+		}
+		if buyerID.Valid {
+			item.BuyerID = &buyerID.String
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ReserveWishlistItem sets the status of a wishlist item in the event on
+// behalf of userID: reserving or buying it makes them its buyer in this event,
+// setting it back to new releases it. It fails with a
+// WishlistItemUnavailableError if somebody else is its buyer in this event, if
+// it was bought in another event since it was last listed, or if it was
+// deleted.
+func (s *store) ReserveWishlistItem(ctx context.Context, userID string, eventID string, itemID string, status GiftStatus, now time.Time) error {
+	return s.withTx(ctx, func(s *store) error {
+		// lock the item, whether reserved yet or not, so that two users
+		// cannot both become its buyer and it cannot be bought in two events
+		var deleted bool
+		err := s.db.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM wishlist_items WHERE id = $1 FOR UPDATE", itemID).Scan(&deleted)
+		if err != nil {
+			return fmt.Errorf("failed to get wishlist item: %w", err)
+		}
+		if deleted {
+			return NewWishlistItemUnavailableError(errors.New("wishlist item was deleted"))
+		}
+
+		// checked once locked, to see the reservations made meanwhile
+		var available bool
+		err = s.db.QueryRowContext(
+			ctx,
+			"SELECT NOT "+boughtElsewhereCondition+" FROM wishlist_items WHERE id = $3",
+			eventID, BoughtGiftStatus, itemID).Scan(&available)
+		if err != nil {
+			return fmt.Errorf("failed to get wishlist item: %w", err)
+		}
+
+		var buyerID string
+		err = s.db.QueryRowContext(ctx, "SELECT buyer_id FROM wishlist_reservations WHERE item_id = $1 AND event_id = $2", itemID, eventID).Scan(&buyerID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get wishlist reservation: %w", err)
+		}
+		reserved := err == nil
+		if reserved && buyerID != userID {
+			return NewWishlistItemUnavailableError(errors.New("wishlist item already has a buyer"))
+		}
+		if !reserved && !available {
+			return NewWishlistItemUnavailableError(errors.New("wishlist item was bought in another event"))
+		}
+
+		if status == NewGiftStatus {
+			_, err = s.db.ExecContext(ctx, "DELETE FROM wishlist_reservations WHERE item_id = $1 AND event_id = $2", itemID, eventID)
+			if err != nil {
+				return fmt.Errorf("failed to release wishlist item: %w", err)
+			}
+			return nil
+		}
+
+		_, err = s.db.ExecContext(
+			ctx,
+			`
+		INSERT INTO wishlist_reservations (item_id, event_id, buyer_id, status, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (item_id, event_id) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at
+	`,
+			itemID, eventID, userID, status, now.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to reserve wishlist item: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWishlistReservationsArePerEvent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	ownerID := createTestUser(t, s, "wishlist-owner@example.com")
+	buyerID := createTestUser(t, s, "wishlist-buyer@example.com")
+	otherID := createTestUser(t, s, "wishlist-other@example.com")
+
+	var eventIDs []string
+	for _, name := range []string{"Christmas", "Birthday"} {
+		eventID, err := s.CreateEvent(ctx, ownerID, name, now, "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+		if err != nil {
+			t.Fatalf("CreateEvent() returned %v", err)
+		}
+		for _, email := range []string{"wishlist-buyer@example.com", "wishlist-other@example.com"} {
+			if err := s.AddEventParticipant(ctx, eventID, email); err != nil {
+				t.Fatalf("AddEventParticipant() returned %v", err)
+			}
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	christmasID, birthdayID := eventIDs[0], eventIDs[1]
+
+	itemID, err := s.CreateWishlistItem(ctx, ownerID, "Book", []string{"https://example.com/book"})
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+
+	if err := s.ReserveWishlistItem(ctx, buyerID, christmasID, itemID, AboutToBeBoughtGiftStatus, now); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, otherID, christmasID, itemID, BoughtGiftStatus, now); !IsWishlistItemUnavailableError(err) {
+		t.Fatalf("expected the item to be reserved in the event, got %v", err)
+	}
+
+	// a reservation does not make the item unavailable elsewhere
+	items, err := s.ListEventWishlistItems(ctx, birthdayID)
+	if err != nil || len(items) != 1 || items[0].BuyerID != nil {
+		t.Fatalf("expected the item to be available for the birthday, got %v, %v", items, err)
+	}
+
+	boughtAt := now.Add(time.Minute)
+	if err := s.ReserveWishlistItem(ctx, buyerID, christmasID, itemID, BoughtGiftStatus, boughtAt); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+	items, err = s.ListEventWishlistItems(ctx, birthdayID)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected the bought item to be left out of the birthday, got %v, %v", items, err)
+	}
+	if err := s.ReserveWishlistItem(ctx, otherID, birthdayID, itemID, AboutToBeBoughtGiftStatus, boughtAt); !IsWishlistItemUnavailableError(err) {
+		t.Fatalf("expected the bought item not to be reservable, got %v", err)
+	}
+	items, err = s.ListEventWishlistItems(ctx, christmasID)
+	if err != nil || len(items) != 1 || items[0].Status != BoughtGiftStatus {
+		t.Fatalf("expected the item to be bought for Christmas, got %v, %v", items, err)
+	}
+
+	if relisted, err := s.RelistWishlistItem(ctx, ownerID, itemID, boughtAt.Add(time.Minute)); err != nil || !relisted {
+		t.Fatalf("RelistWishlistItem() returned %v, %v", relisted, err)
+	}
+	items, err = s.ListEventWishlistItems(ctx, birthdayID)
+	if err != nil || len(items) != 1 || items[0].BuyerID != nil {
+		t.Fatalf("expected the relisted item to be available for the birthday, got %v, %v", items, err)
+	}
+	if err := s.ReserveWishlistItem(ctx, otherID, birthdayID, itemID, AboutToBeBoughtGiftStatus, boughtAt); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+}
+
+func TestReserveWishlistItemConcurrently(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	ownerID := createTestUser(t, s, "concurrent-owner@example.com")
+
+	// the item is bought in several events at once
+	var eventIDs, buyerIDs []string
+	for i, email := range []string{"concurrent-first@example.com", "concurrent-second@example.com", "concurrent-third@example.com"} {
+		buyerIDs = append(buyerIDs, createTestUser(t, s, email))
+		eventID, err := s.CreateEvent(ctx, ownerID, fmt.Sprintf("Event %d", i), now, "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+		if err != nil {
+			t.Fatalf("CreateEvent() returned %v", err)
+		}
+		if err := s.AddEventParticipant(ctx, eventID, email); err != nil {
+			t.Fatalf("AddEventParticipant() returned %v", err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	itemID, err := s.CreateWishlistItem(ctx, ownerID, "Bike", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+
+	errs := make(chan error, len(eventIDs))
+	for i := range eventIDs {
+		go func() {
+			errs <- s.ReserveWishlistItem(ctx, buyerIDs[i], eventIDs[i], itemID, BoughtGiftStatus, now)
+		}()
+	}
+	bought := 0
+	for range eventIDs {
+		err := <-errs
+		if err == nil {
+			bought++
+		} else if !IsWishlistItemUnavailableError(err) {
+			t.Fatalf("ReserveWishlistItem() returned %v", err)
+		}
+	}
+	if bought != 1 {
+		t.Fatalf("expected the item to be bought once, got %d", bought)
+	}
+}
+
+func TestDeleteBoughtWishlistItem(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := newTestStore(t, 0)
+	ownerID := createTestUser(t, s, "deleted-owner@example.com")
+	buyerID := createTestUser(t, s, "deleted-buyer@example.com")
+	eventID, err := s.CreateEvent(ctx, ownerID, "Christmas", now, "", ChristmasEventType, nil, NoRecurrence, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned %v", err)
+	}
+	if err := s.AddEventParticipant(ctx, eventID, "deleted-buyer@example.com"); err != nil {
+		t.Fatalf("AddEventParticipant() returned %v", err)
+	}
+
+	boughtID, err := s.CreateWishlistItem(ctx, ownerID, "Bought", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	reservedID, err := s.CreateWishlistItem(ctx, ownerID, "Reserved", nil)
+	if err != nil {
+		t.Fatalf("CreateWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, buyerID, eventID, boughtID, BoughtGiftStatus, now); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+	if err := s.ReserveWishlistItem(ctx, buyerID, eventID, reservedID, AboutToBeBoughtGiftStatus, now); err != nil {
+		t.Fatalf("ReserveWishlistItem() returned %v", err)
+	}
+
+	for _, itemID := range []string{boughtID, reservedID} {
+		if deleted, err := s.DeleteWishlistItem(ctx, ownerID, itemID); err != nil || !deleted {
+			t.Fatalf("DeleteWishlistItem() returned %v, %v", deleted, err)
+		}
+		if deleted, err := s.DeleteWishlistItem(ctx, ownerID, itemID); err != nil || deleted {
+			t.Fatalf("expected the item to be deleted once, got %v, %v", deleted, err)
+		}
+	}
+
+	wishlist, err := s.ListWishlistItems(ctx, ownerID)
+	if err != nil || len(wishlist) != 0 {
+		t.Fatalf("expected the wishlist to be empty, got %v, %v", wishlist, err)
+	}
+	// the bought item stays for its buyer, the reserved one is released
+	items, err := s.ListEventWishlistItems(ctx, eventID)
+	if err != nil || len(items) != 1 || items[0].ID != boughtID || !items[0].Deleted || items[0].Status != BoughtGiftStatus {
+		t.Fatalf("expected only the bought item to be kept, got %+v, %v", items, err)
+	}
+	if err := s.ReserveWishlistItem(ctx, buyerID, eventID, boughtID, NewGiftStatus, now); !IsWishlistItemUnavailableError(err) {
+		t.Fatalf("expected the deleted item not to change, got %v", err)
+	}
+}
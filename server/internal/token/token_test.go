@@ -0,0 +1,43 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2025, 12, 24, 20, 0, 0, 0, time.UTC)
+	signer := NewSigner([]byte("secret"), func() time.Time { return now })
+
+	tok, err := signer.Sign(Claims{Purpose: "verify_email", UserID: "42", Value: "me@example.com"}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, err := signer.Verify("verify_email", tok)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.UserID != "42" || claims.Value != "me@example.com" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := signer.Verify("export", tok); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected token of another purpose to be invalid, got %v", err)
+	}
+
+	other := NewSigner([]byte("other secret"), func() time.Time { return now })
+	if _, err := other.Verify("verify_email", tok); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected token signed with another secret to be invalid, got %v", err)
+	}
+
+	if _, err := signer.Verify("verify_email", tok+"x"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected tampered token to be invalid, got %v", err)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if _, err := signer.Verify("verify_email", tok); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected token to be expired, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(rfcSecret, time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != test.code {
+			t.Errorf("expected code %s at %d, got %s", test.code, test.unix, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	clock := time.Unix(1234567890, 0)
+
+	step, ok := Validate(rfcSecret, "005924", clock)
+	if !ok {
+		t.Fatalf("expected code to be valid")
+	}
+	if step != Step(clock) {
+		t.Errorf("expected step %d, got %d", Step(clock), step)
+	}
+
+	// one period of drift is tolerated in both directions
+	if _, ok := Validate(rfcSecret, "005924", clock.Add(30*time.Second)); !ok {
+		t.Errorf("expected code to be valid one period later")
+	}
+	if _, ok := Validate(rfcSecret, "005924", clock.Add(-30*time.Second)); !ok {
+		t.Errorf("expected code to be valid one period earlier")
+	}
+
+	if _, ok := Validate(rfcSecret, "005924", clock.Add(2*time.Minute)); ok {
+		t.Errorf("expected code to be expired")
+	}
+	if _, ok := Validate(rfcSecret, "123456", clock); ok {
+		t.Errorf("expected wrong code to be invalid")
+	}
+	if _, ok := Validate(rfcSecret, "", clock); ok {
+		t.Errorf("expected empty code to be invalid")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clock := time.Unix(1700000000, 0)
+	code, err := Code(secret, clock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := Validate(secret, code, clock); !ok {
+		t.Errorf("expected generated code to be valid")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Gifter", "me@example.com", rfcSecret)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Gifter:me@example.com?") {
+		t.Errorf("unexpected uri prefix: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Errorf("expected uri to contain the secret: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate recovery code %s", code)
+		}
+		seen[code] = true
+	}
+
+	code := codes[0]
+	typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+	if HashRecoveryCode(code) != HashRecoveryCode(typed) {
+		t.Errorf("expected hash to ignore case and dashes")
+	}
+}
@@ -2,8 +2,51 @@ CREATE TABLE users (
     id      serial PRIMARY KEY,
     name    text NOT NULL,
     email   text NOT NULL UNIQUE,
+    email_verified boolean NOT NULL DEFAULT true,
+    pending_email text,
     picture text,
-    password_hash text NOT NULL
+    password_hash text NOT NULL,
+    totp_secret text,
+    totp_enabled boolean NOT NULL DEFAULT false,
+    totp_last_step bigint,
+    -- bumped to end every session of the user
+    session_version int NOT NULL DEFAULT 0,
+    deleted_at timestamp
+);
+
+CREATE TABLE recovery_codes (
+    id serial PRIMARY KEY,
+    user_id serial not null,
+    code_hash text not null,
+    used_at timestamp,
+    foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE user_identities (
+    id serial PRIMARY KEY,
+    user_id serial not null,
+    provider text not null,
+    subject text not null,
+    email text not null,
+    created_at timestamp not null,
+    unique (provider, subject),
+    foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE login_failures (
+    key text PRIMARY KEY,
+    failures int not null,
+    last_failure timestamp not null
+);
+
+CREATE TABLE failed_logins (
+    id serial PRIMARY KEY,
+    email text not null,
+    user_id int,
+    ip text not null,
+    reason text not null,
+    created_at timestamp not null,
+    foreign key (user_id) references users(id) on delete set null
 );
 
 CREATE TABLE events (
@@ -12,7 +55,13 @@ CREATE TABLE events (
    name text not null,
    date timestamp not null,
    type int not null,
-   foreign key (creator_id) references users(id) on delete cascade
+   description text not null default '',
+   archived_at timestamp,
+   recurrence int not null default 0,
+   recurrence_date timestamp,
+   next_event_id int,
+   foreign key (creator_id) references users(id) on delete cascade,
+   foreign key (next_event_id) references events(id) on delete set null
 );
 
 CREATE TABLE participants(
@@ -20,20 +69,136 @@ CREATE TABLE participants(
     user_id serial not null,
     event_id serial not null,
     participant_role int not null,
+    honoree boolean not null default false,
+    -- the group the participant joined through, null if they joined on their own
+    source_group_id int,
+    unique (user_id, event_id),
     foreign key (user_id) references users(id) on delete cascade,
     foreign key (event_id) references events(id) on delete cascade
 );
 
+CREATE TABLE user_groups (
+    id serial PRIMARY KEY,
+    name text not null,
+    created_at timestamp not null
+);
+
+ALTER TABLE participants ADD FOREIGN KEY (source_group_id) REFERENCES user_groups(id) ON DELETE SET NULL;
+
+CREATE TABLE group_members (
+    id serial PRIMARY KEY,
+    group_id serial not null,
+    user_id serial not null,
+    role int not null,
+    unique (group_id, user_id),
+    foreign key (group_id) references user_groups(id) on delete cascade,
+    foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE event_groups (
+    id serial PRIMARY KEY,
+    event_id serial not null,
+    group_id serial not null,
+    sync boolean not null,
+    unique (event_id, group_id),
+    foreign key (event_id) references events(id) on delete cascade,
+    foreign key (group_id) references user_groups(id) on delete cascade
+);
+
+CREATE TABLE join_links (
+    id serial PRIMARY KEY,
+    event_id serial not null,
+    creator_id serial not null,
+    token text not null unique,
+    participant_role int not null,
+    created_at timestamp not null,
+    expires_at timestamp,
+    max_uses int,
+    uses int not null default 0,
+    revoked_at timestamp,
+    foreign key (event_id) references events(id) on delete cascade,
+    foreign key (creator_id) references users(id) on delete cascade
+);
+
 CREATE TABLE gifts (
    id serial PRIMARY KEY,
    creator_id serial not null,
    event_id serial not null,
    created_at timestamp not null,
    content text not null,
+   deleted_at timestamp,
    foreign key (creator_id) references users(id) on delete cascade,
    foreign key (event_id) references events(id) on delete cascade
 );
 
+-- finds the gifts a user reserved or bought, across events
+CREATE INDEX gifts_buyer_idx ON gifts ((content::jsonb->>'from'));
+
+CREATE TABLE gift_images (
+   id serial PRIMARY KEY,
+   -- images of deleted gifts are detached, their blobs are purged later on
+   gift_id int,
+   uploader_id serial not null,
+   blob_key text not null,
+   content_type text not null,
+   width int not null,
+   height int not null,
+   size int not null,
+   thumbnail_key text not null,
+   thumbnail_content_type text not null,
+   created_at timestamp not null,
+   foreign key (gift_id) references gifts(id) on delete set null,
+   foreign key (uploader_id) references users(id) on delete cascade
+);
+
+CREATE TABLE gift_votes (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   user_id serial not null,
+   -- 1 for up votes, -1 for down votes
+   value int not null,
+   created_at timestamp not null,
+   unique (gift_id, user_id),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE gift_reactions (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   user_id serial not null,
+   emoji text not null,
+   created_at timestamp not null,
+   unique (gift_id, user_id, emoji),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE wishlist_items (
+   id serial PRIMARY KEY,
+   user_id serial not null,
+   name text not null,
+   urls text not null,
+   created_at timestamp not null,
+   listed_at timestamp not null,
+   -- deleted items are kept while bought in some event
+   deleted_at timestamp,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE wishlist_reservations (
+   id serial PRIMARY KEY,
+   item_id serial not null,
+   event_id serial not null,
+   buyer_id serial not null,
+   status int not null,
+   updated_at timestamp not null,
+   unique (item_id, event_id),
+   foreign key (item_id) references wishlist_items(id) on delete cascade,
+   foreign key (event_id) references events(id) on delete cascade,
+   foreign key (buyer_id) references users(id) on delete cascade
+);
+
 CREATE TABLE comments (
    id serial PRIMARY KEY,
    author_id serial not null,
@@ -44,3 +209,66 @@ CREATE TABLE comments (
    foreign key (author_id) references users(id) on delete cascade,
    foreign key (gift_id) references gifts(id) on delete cascade
 );
+
+CREATE TABLE comment_votes (
+   id serial PRIMARY KEY,
+   comment_id serial not null,
+   user_id serial not null,
+   -- 1 for up votes, -1 for down votes
+   value int not null,
+   created_at timestamp not null,
+   unique (comment_id, user_id),
+   foreign key (comment_id) references comments(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE comment_reactions (
+   id serial PRIMARY KEY,
+   comment_id serial not null,
+   user_id serial not null,
+   emoji text not null,
+   created_at timestamp not null,
+   unique (comment_id, user_id, emoji),
+   foreign key (comment_id) references comments(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+-- thank-you notes of recipients to the buyers of their gifts, one per gift
+CREATE TABLE thank_you_notes (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   author_id serial not null,
+   message text not null,
+   created_at timestamp not null,
+   modified_at timestamp,
+   unique (gift_id),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (author_id) references users(id) on delete cascade
+);
+
+-- thank-you notes of the owners of wishlist items to their buyers, one per
+-- bought item and event
+CREATE TABLE wishlist_thank_you_notes (
+   id serial PRIMARY KEY,
+   reservation_id serial not null,
+   author_id serial not null,
+   message text not null,
+   created_at timestamp not null,
+   modified_at timestamp,
+   unique (reservation_id),
+   foreign key (reservation_id) references wishlist_reservations(id) on delete cascade,
+   foreign key (author_id) references users(id) on delete cascade
+);
+
+CREATE TABLE data_exports (
+   id serial PRIMARY KEY,
+   user_id serial not null,
+   status int not null,
+   created_at timestamp not null,
+   expires_at timestamp,
+   content bytea,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+-- a user has at most one pending export (status 0)
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports (user_id) WHERE status = 0;
\ No newline at end of file
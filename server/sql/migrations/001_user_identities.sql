@@ -0,0 +1,12 @@
+-- Upgrades databases created before users could log in with several
+-- providers. create_tables.sql already includes this change for new databases.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id serial PRIMARY KEY,
+    user_id serial not null,
+    provider text not null,
+    subject text not null,
+    email text not null,
+    created_at timestamp not null,
+    unique (provider, subject),
+    foreign key (user_id) references users(id) on delete cascade
+);
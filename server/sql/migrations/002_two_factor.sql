@@ -0,0 +1,13 @@
+-- Upgrades databases created before two factor authentication.
+-- create_tables.sql already includes this change for new databases.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id serial PRIMARY KEY,
+    user_id serial not null,
+    code_hash text not null,
+    used_at timestamp,
+    foreign key (user_id) references users(id) on delete cascade
+);
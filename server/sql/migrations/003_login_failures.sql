@@ -0,0 +1,17 @@
+-- Upgrades databases created before failed logins were throttled and audited.
+-- create_tables.sql already includes this change for new databases.
+CREATE TABLE IF NOT EXISTS login_failures (
+    key text PRIMARY KEY,
+    failures int not null,
+    last_failure timestamp not null
+);
+
+CREATE TABLE IF NOT EXISTS failed_logins (
+    id serial PRIMARY KEY,
+    email text not null,
+    user_id int,
+    ip text not null,
+    reason text not null,
+    created_at timestamp not null,
+    foreign key (user_id) references users(id) on delete set null
+);
@@ -0,0 +1,4 @@
+-- Upgrades databases created before emails were verified. create_tables.sql
+-- already includes this change for new databases. Existing users keep
+-- logging in as before, their emails count as verified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT true;
@@ -0,0 +1,6 @@
+-- Upgrades databases created before users could change their email, end their
+-- sessions and delete their account. create_tables.sql already includes this
+-- change for new databases.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version int NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at timestamp;
@@ -0,0 +1,19 @@
+-- Upgrades databases created before data exports. create_tables.sql already
+-- includes this change for new databases.
+CREATE TABLE IF NOT EXISTS data_exports (
+   id serial PRIMARY KEY,
+   user_id serial not null,
+   status int not null,
+   created_at timestamp not null,
+   expires_at timestamp,
+   content bytea,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+-- Only the latest pending export of each user stays pending.
+UPDATE data_exports SET status = 2
+WHERE status = 0 AND EXISTS (
+   SELECT 1 FROM data_exports newer
+   WHERE newer.user_id = data_exports.user_id AND newer.status = 0 AND newer.id > data_exports.id
+);
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (user_id) WHERE status = 0;
@@ -0,0 +1,3 @@
+-- Upgrades databases created before events had honorees. create_tables.sql
+-- already includes this change for new databases.
+ALTER TABLE participants ADD COLUMN IF NOT EXISTS honoree boolean NOT NULL DEFAULT false;
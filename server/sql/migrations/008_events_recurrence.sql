@@ -0,0 +1,6 @@
+-- Upgrades databases created before events could recur. create_tables.sql
+-- already includes this change for new databases. Existing events do not
+-- recur (0).
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recurrence int NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recurrence_date timestamp;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS next_event_id int REFERENCES events(id) ON DELETE SET NULL;
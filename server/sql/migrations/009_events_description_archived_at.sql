@@ -0,0 +1,4 @@
+-- Upgrades databases created before events had a description and could be
+-- archived. create_tables.sql already includes this change for new databases.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS archived_at timestamp;
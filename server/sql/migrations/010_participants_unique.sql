@@ -0,0 +1,22 @@
+-- Upgrades databases created before a user could take part in an event only
+-- once. create_tables.sql already includes this change for new databases.
+-- The first participation of each user is kept, with the highest role (owners
+-- are 0) and honoree flag of their duplicates.
+UPDATE participants SET
+   participant_role = duplicates.participant_role,
+   honoree = duplicates.honoree
+FROM (
+   SELECT min(id) AS id, min(participant_role) AS participant_role, bool_or(honoree) AS honoree
+   FROM participants
+   GROUP BY user_id, event_id
+   HAVING count(*) > 1
+) duplicates
+WHERE participants.id = duplicates.id;
+
+DELETE FROM participants
+WHERE EXISTS (
+   SELECT 1 FROM participants first
+   WHERE first.user_id = participants.user_id AND first.event_id = participants.event_id AND first.id < participants.id
+);
+
+ALTER TABLE participants ADD CONSTRAINT participants_user_id_event_id_key UNIQUE (user_id, event_id);
@@ -0,0 +1,16 @@
+-- Upgrades databases created before join links. create_tables.sql already
+-- includes this change for new databases.
+CREATE TABLE IF NOT EXISTS join_links (
+    id serial PRIMARY KEY,
+    event_id serial not null,
+    creator_id serial not null,
+    token text not null unique,
+    participant_role int not null,
+    created_at timestamp not null,
+    expires_at timestamp,
+    max_uses int,
+    uses int not null default 0,
+    revoked_at timestamp,
+    foreign key (event_id) references events(id) on delete cascade,
+    foreign key (creator_id) references users(id) on delete cascade
+);
@@ -0,0 +1,31 @@
+-- Upgrades databases created before groups. create_tables.sql already
+-- includes this change for new databases. Existing participants are
+-- considered to have joined on their own, so that leaving a group never
+-- removes them from an event.
+CREATE TABLE IF NOT EXISTS user_groups (
+    id serial PRIMARY KEY,
+    name text not null,
+    created_at timestamp not null
+);
+
+ALTER TABLE participants ADD COLUMN IF NOT EXISTS source_group_id int REFERENCES user_groups(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id serial PRIMARY KEY,
+    group_id serial not null,
+    user_id serial not null,
+    role int not null,
+    unique (group_id, user_id),
+    foreign key (group_id) references user_groups(id) on delete cascade,
+    foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE IF NOT EXISTS event_groups (
+    id serial PRIMARY KEY,
+    event_id serial not null,
+    group_id serial not null,
+    sync boolean not null,
+    unique (event_id, group_id),
+    foreign key (event_id) references events(id) on delete cascade,
+    foreign key (group_id) references user_groups(id) on delete cascade
+);
@@ -0,0 +1,26 @@
+-- Upgrades databases created before wishlists. create_tables.sql already
+-- includes this change for new databases.
+CREATE TABLE IF NOT EXISTS wishlist_items (
+   id serial PRIMARY KEY,
+   user_id serial not null,
+   name text not null,
+   urls text not null,
+   created_at timestamp not null,
+   listed_at timestamp not null,
+   -- deleted items are kept while bought in some event
+   deleted_at timestamp,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE IF NOT EXISTS wishlist_reservations (
+   id serial PRIMARY KEY,
+   item_id serial not null,
+   event_id serial not null,
+   buyer_id serial not null,
+   status int not null,
+   updated_at timestamp not null,
+   unique (item_id, event_id),
+   foreign key (item_id) references wishlist_items(id) on delete cascade,
+   foreign key (event_id) references events(id) on delete cascade,
+   foreign key (buyer_id) references users(id) on delete cascade
+);
@@ -0,0 +1,8 @@
+-- Upgrades databases created before the time gifts were put in the trash was
+-- recorded. create_tables.sql already includes this change for new databases.
+-- The retention of gifts already in the trash starts with the upgrade, instead
+-- of them being purged right away. Status 3 marks the gifts in the trash.
+ALTER TABLE gifts ADD COLUMN IF NOT EXISTS deleted_at timestamp;
+
+UPDATE gifts SET deleted_at = now() AT TIME ZONE 'UTC'
+WHERE (content::jsonb->>'status')::int = 3 AND deleted_at IS NULL;
@@ -0,0 +1,18 @@
+-- Upgrades databases created before gift images. create_tables.sql already
+-- includes this change for new databases.
+CREATE TABLE IF NOT EXISTS gift_images (
+   id serial PRIMARY KEY,
+   -- images of deleted gifts are detached, their blobs are purged later on
+   gift_id int,
+   uploader_id serial not null,
+   blob_key text not null,
+   content_type text not null,
+   width int not null,
+   height int not null,
+   size int not null,
+   thumbnail_key text not null,
+   thumbnail_content_type text not null,
+   created_at timestamp not null,
+   foreign key (gift_id) references gifts(id) on delete set null,
+   foreign key (uploader_id) references users(id) on delete cascade
+);
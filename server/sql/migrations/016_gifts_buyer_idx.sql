@@ -0,0 +1,3 @@
+-- Upgrades databases created before the shopping list. create_tables.sql
+-- already includes this change for new databases.
+CREATE INDEX IF NOT EXISTS gifts_buyer_idx ON gifts ((content::jsonb->>'from'));
@@ -0,0 +1,12 @@
+-- Upgrades databases created before votes on gift ideas. create_tables.sql
+-- already includes this change, with the value added next, for new
+-- databases.
+CREATE TABLE IF NOT EXISTS gift_votes (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   user_id serial not null,
+   created_at timestamp not null,
+   unique (gift_id, user_id),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
@@ -0,0 +1,39 @@
+-- Upgrades databases created before gifts and comments had up and down votes
+-- and emoji reactions. Former votes, on ideas, were all up votes.
+-- create_tables.sql already includes this change for new databases.
+ALTER TABLE gift_votes ADD COLUMN IF NOT EXISTS value int NOT NULL DEFAULT 1;
+ALTER TABLE gift_votes ALTER COLUMN value DROP DEFAULT;
+
+CREATE TABLE IF NOT EXISTS gift_reactions (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   user_id serial not null,
+   emoji text not null,
+   created_at timestamp not null,
+   unique (gift_id, user_id, emoji),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+   id serial PRIMARY KEY,
+   comment_id serial not null,
+   user_id serial not null,
+   -- 1 for up votes, -1 for down votes
+   value int not null,
+   created_at timestamp not null,
+   unique (comment_id, user_id),
+   foreign key (comment_id) references comments(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
+
+CREATE TABLE IF NOT EXISTS comment_reactions (
+   id serial PRIMARY KEY,
+   comment_id serial not null,
+   user_id serial not null,
+   emoji text not null,
+   created_at timestamp not null,
+   unique (comment_id, user_id, emoji),
+   foreign key (comment_id) references comments(id) on delete cascade,
+   foreign key (user_id) references users(id) on delete cascade
+);
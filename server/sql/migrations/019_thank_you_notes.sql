@@ -0,0 +1,26 @@
+-- Upgrades databases created before recipients could thank the buyers of
+-- their gifts and wishlist items. create_tables.sql already includes this
+-- change for new databases.
+CREATE TABLE IF NOT EXISTS thank_you_notes (
+   id serial PRIMARY KEY,
+   gift_id serial not null,
+   author_id serial not null,
+   message text not null,
+   created_at timestamp not null,
+   modified_at timestamp,
+   unique (gift_id),
+   foreign key (gift_id) references gifts(id) on delete cascade,
+   foreign key (author_id) references users(id) on delete cascade
+);
+
+CREATE TABLE IF NOT EXISTS wishlist_thank_you_notes (
+   id serial PRIMARY KEY,
+   reservation_id serial not null,
+   author_id serial not null,
+   message text not null,
+   created_at timestamp not null,
+   modified_at timestamp,
+   unique (reservation_id),
+   foreign key (reservation_id) references wishlist_reservations(id) on delete cascade,
+   foreign key (author_id) references users(id) on delete cascade
+);